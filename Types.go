@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -10,28 +11,53 @@ import (
 
 // Mark represents a specific point in time during a roasting session, usually to mark an event.
 type Mark struct {
-	SessionId string  `json:"session_id,omitempty"` // The ID of the session this mark belongs to.
-	MarkName  string  `json:"mark_name"`            // The name of the mark (e.g., "First Crack").
-	CreatedAt int64   `json:"create_at"`            // The timestamp when the mark was created (in milliseconds).
-	OnTemp    float64 `json:"on_temp"`              // The temperature at which the mark was made.
+	Id        int64              `json:"id"`                   // The unique ID of the mark.
+	SessionId string             `json:"session_id,omitempty"` // The ID of the session this mark belongs to.
+	MarkName  string             `json:"mark_name"`            // The name of the mark (e.g., "First Crack").
+	CreatedAt int64              `json:"create_at"`            // The timestamp when the mark was created (in milliseconds).
+	OnTemp    float64            `json:"on_temp"`              // The temperature at which the mark was made.
+	CreatedBy string             `json:"created_by,omitempty"` // The user who created the mark.
+	Channels  map[string]float64 `json:"channels,omitempty"`   // The reading of every channel, for marks taken from the live stream.
+	RoR       *float64           `json:"ror,omitempty"`        // The rate of rise in degrees per minute, for marks taken from the live stream.
 }
 
 // SessionData represents the data of a roasting session that is stored in the database.
 type SessionData struct {
-	Id       string `json:"id"`        // The unique ID of the session.
-	Name     string `json:"name"`      // The name of the session.
-	CreateAt int64  `json:"create_at"` // The timestamp when the session was created (in milliseconds).
-	EndAt    int64  `json:"end_at"`    // The timestamp when the session ended (in milliseconds).
+	Id            string   `json:"id"`                   // The unique ID of the session.
+	Name          string   `json:"name"`                 // The name of the session.
+	CreateAt      int64    `json:"create_at"`            // The timestamp when the session was created (in milliseconds).
+	EndAt         int64    `json:"end_at"`               // The timestamp when the session ended (in milliseconds).
+	StartedBy     string   `json:"started_by,omitempty"` // The user who started the session.
+	StoppedBy     string   `json:"stopped_by,omitempty"` // The user who stopped the session.
+	DeletedAt     int64    `json:"deleted_at,omitempty"` // When the session was moved to the trash (in milliseconds), 0 if it is not.
+	DeletedBy     string   `json:"deleted_by,omitempty"` // The user who moved it to the trash.
+	Coffee        string   `json:"coffee"`               // The coffee (green lot) roasted.
+	Roaster       string   `json:"roaster"`              // The roaster machine used.
+	Tags          []string `json:"tags"`                 // Free form labels, lowercase.
+	Score         float64  `json:"score"`                // The cupping score, 0 if not scored.
+	Notes         string   `json:"notes"`                // Free form notes.
+	GreenWeight   float64  `json:"green_weight"`         // The charged green coffee, in grams.
+	RoastedWeight float64  `json:"roasted_weight"`       // The dropped roasted coffee, in grams.
+	Version       int64    `json:"version"`              // Increased on every edit, for optimistic concurrency.
 }
 
-// Session represents an active roasting session.
+// Session represents an active roasting session. It is read from every goroutine;
+// starting and stopping it go through StartSession and StopSession.
 type Session struct {
+	mu        sync.RWMutex
 	id        string // The unique ID of the session.
 	active    bool   // Whether the session is currently active.
 	name      string // The name of the session.
 	create_at int64  // The timestamp when the session was created (in milliseconds).
 }
 
+// ActiveSession is a consistent copy of the active session.
+type ActiveSession struct {
+	Id       string
+	Name     string
+	CreateAt int64
+}
+
 // NewSession creates a new, inactive session.
 func NewSession() *Session {
 
@@ -39,20 +65,61 @@ func NewSession() *Session {
 
 }
 
+// Active returns the active session, and false when there is none. Use it instead of
+// IsActive followed by GetId, which may see different sessions.
+func (t *Session) Active() (ActiveSession, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return ActiveSession{Id: t.id, Name: t.name, CreateAt: t.create_at}, t.active
+}
+
+// IsCurrent returns true if session_id is the active session.
+func (t *Session) IsCurrent(session_id string) bool {
+	active, ok := t.Active()
+	return ok && active.Id == session_id
+}
+
 // IsActive returns true if the session is currently active.
-func (t Session) IsActive() bool { return t.active }
+func (t *Session) IsActive() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.active
+}
 
 // GetName returns the name of the session.
-func (t Session) GetName() string { return t.name }
+func (t *Session) GetName() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.name
+}
 
 // GetId returns the ID of the session.
-func (t Session) GetId() string { return t.id }
+func (t *Session) GetId() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.id
+}
 
 // GetCreatedAt returns the creation timestamp of the session.
-func (t Session) GetCreatedAt() int64 { return t.create_at }
+func (t *Session) GetCreatedAt() int64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.create_at
+}
+
+// Rename renames the session if it is still session_id.
+func (t *Session) Rename(session_id string, name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.active && t.id == session_id {
+		t.name = name
+	}
+}
 
 // Start begins a new roasting session.
 func (t *Session) Start(name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	if t.active {
 		log.Printf("ya existe una sesion de tostado iniciada: %s\n", t.name)
 		return errors.New("ya esta iniciada la session.")
@@ -68,11 +135,13 @@ func (t *Session) Start(name string) error {
 
 // Stop ends the current roasting session.
 func (t *Session) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	if !t.active {
 		log.Println("no hay session que detener.")
 	} else {
 		log.Printf("session %s terminada\n", t.name)
-		*t = *NewSession()
+		t.id, t.active, t.name, t.create_at = "", false, "", 0
 	}
 
 }
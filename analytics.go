@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// consistency_metrics are the metrics compared across batches, in report order.
+var consistency_metrics = []string{
+	"charge_temp", "tp_s", "tp_temp", "dry_end_s", "fc_s", "fc_temp", "drop_temp", "dtr", "total_s", "weight_loss_pct",
+}
+
+// consistency_group_by are the ways sessions are grouped into batches of the same roast.
+var consistency_group_by = []string{"coffee", "roaster", "recipe", "tag"}
+
+const (
+	consistency_max_sessions  = 1000
+	consistency_default_sigma = 3
+	consistency_run_length    = 7 // Consecutive batches on the same side of the mean that flag a shift.
+)
+
+// batch_number matches the batch number at the end of a session name ("Guji natural #2", "Huila lote 14").
+var batch_number = regexp.MustCompile(`(?i)\s*(#|n[º°o]\.?|lote|batch)?\s*\d+$`)
+
+// MetricStats is the distribution of a metric in a group, with its control limits.
+type MetricStats struct {
+	N      int     `json:"n"`
+	Mean   float64 `json:"mean"`
+	Stdev  float64 `json:"stdev"` // The sample standard deviation.
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Sigma  float64 `json:"sigma"` // The process sigma estimated from the moving range, used for the limits.
+	UCL    float64 `json:"ucl"`   // Upper control limit.
+	LCL    float64 `json:"lcl"`   // Lower control limit.
+	Trend  float64 `json:"trend"` // Change per batch of the least squares line.
+	values []float64
+}
+
+// ConsistencyFlag marks a batch metric out of tolerance.
+type ConsistencyFlag struct {
+	Metric string  `json:"metric"`
+	Value  float64 `json:"value"`
+	Rule   string  `json:"rule"` // "out_of_control" beyond the limits, "warning" beyond two thirds of them, "shift" for a run on one side of the mean.
+}
+
+// ConsistencyPoint is a session of a group with its metrics.
+type ConsistencyPoint struct {
+	SessionId string             `json:"session_id"`
+	Name      string             `json:"name"`
+	CreateAt  int64              `json:"create_at"`
+	Metrics   map[string]float64 `json:"metrics"`
+	Flags     []ConsistencyFlag  `json:"flags"`
+}
+
+// ConsistencyGroup is the analysis of the batches of a coffee, roaster, recipe or tag.
+type ConsistencyGroup struct {
+	Key      string                  `json:"key"`
+	Sessions int                     `json:"sessions"`
+	Metrics  map[string]*MetricStats `json:"metrics"`
+	Points   []ConsistencyPoint      `json:"points"` // Oldest first.
+}
+
+// recipeOf returns the recipe of a session: its name without the batch number.
+func recipeOf(name string) string {
+	return strings.ToLower(strings.TrimSpace(batch_number.ReplaceAllString(strings.TrimSpace(name), "")))
+}
+
+// consistencyKeys returns the groups a session belongs to.
+func consistencyKeys(s SessionData, group_by string) []string {
+	var key string
+	switch group_by {
+	case "coffee":
+		key = strings.ToLower(strings.TrimSpace(s.Coffee))
+	case "roaster":
+		key = strings.ToLower(strings.TrimSpace(s.Roaster))
+	case "recipe":
+		key = recipeOf(s.Name)
+	case "tag":
+		return s.Tags
+	}
+	if key == "" {
+		return nil
+	}
+	return []string{key}
+}
+
+// consistencyMetrics returns the metrics of a roast that could be measured.
+func consistencyMetrics(p *RoastProfile) map[string]float64 {
+	phases := p.Phases()
+	metrics := map[string]float64{
+		"charge_temp": phases.ChargeTemp,
+		"drop_temp":   phases.DropTemp,
+		"total_s":     phases.TotalS,
+	}
+	if tp, ok := p.Events["turning_point"]; ok {
+		metrics["tp_s"] = tp.T
+		metrics["tp_temp"] = tp.Temp
+	}
+	if dry, ok := p.Events["dry_end"]; ok {
+		metrics["dry_end_s"] = dry.T
+	}
+	if fc, ok := p.Events["first_crack"]; ok {
+		metrics["fc_s"] = fc.T
+		metrics["fc_temp"] = fc.Temp
+	}
+	if phases.DevelopmentPct != nil {
+		metrics["dtr"] = *phases.DevelopmentPct
+	}
+	if green, roasted := p.Session.GreenWeight, p.Session.RoastedWeight; green > 0 && roasted > 0 {
+		metrics["weight_loss_pct"] = (green - roasted) / green * 100
+	}
+	return metrics
+}
+
+// newMetricStats computes the distribution and the individuals chart limits of values,
+// given in batch order.
+func newMetricStats(values []float64, sigmas float64) *MetricStats {
+	n := len(values)
+	stats := &MetricStats{N: n, Min: values[0], Max: values[0], values: values}
+	for _, v := range values {
+		stats.Mean += v
+		stats.Min = math.Min(stats.Min, v)
+		stats.Max = math.Max(stats.Max, v)
+	}
+	stats.Mean /= float64(n)
+	if n < 2 {
+		stats.UCL, stats.LCL = stats.Mean, stats.Mean
+		return stats
+	}
+
+	var squares, moving_range, sum_x, sum_xy, sum_xx float64
+	for i, v := range values {
+		squares += (v - stats.Mean) * (v - stats.Mean)
+		if i > 0 {
+			moving_range += math.Abs(v - values[i-1])
+		}
+		x := float64(i)
+		sum_x += x
+		sum_xy += x * v
+		sum_xx += x * x
+	}
+	stats.Stdev = math.Sqrt(squares / float64(n-1))
+	// d2 for moving ranges of two batches.
+	stats.Sigma = moving_range / float64(n-1) / 1.128
+	stats.UCL = stats.Mean + sigmas*stats.Sigma
+	stats.LCL = stats.Mean - sigmas*stats.Sigma
+	if d := float64(n)*sum_xx - sum_x*sum_x; d != 0 {
+		stats.Trend = (float64(n)*sum_xy - sum_x*stats.Mean*float64(n)) / d
+	}
+	return stats
+}
+
+// flag returns the flag of the i-th value, if any. Limits need at least three batches.
+func (s *MetricStats) flag(metric string, i int, sigmas float64) *ConsistencyFlag {
+	if s.N < 3 || s.Sigma == 0 {
+		return nil
+	}
+	v := s.values[i]
+	switch {
+	case v > s.UCL || v < s.LCL:
+		return &ConsistencyFlag{Metric: metric, Value: v, Rule: "out_of_control"}
+	case math.Abs(v-s.Mean) > sigmas*s.Sigma*2/3:
+		return &ConsistencyFlag{Metric: metric, Value: v, Rule: "warning"}
+	}
+
+	// A run ending at this batch.
+	run := 0
+	for j := i; j >= 0 && (s.values[j] > s.Mean) == (v > s.Mean) && s.values[j] != s.Mean; j-- {
+		run++
+	}
+	if run >= consistency_run_length {
+		return &ConsistencyFlag{Metric: metric, Value: v, Rule: "shift"}
+	}
+	return nil
+}
+
+// analyzeConsistency computes the stats and flags of a group.
+func analyzeConsistency(key string, points []ConsistencyPoint, sigmas float64) ConsistencyGroup {
+	group := ConsistencyGroup{Key: key, Sessions: len(points), Metrics: map[string]*MetricStats{}, Points: points}
+
+	for _, metric := range consistency_metrics {
+		var values []float64
+		var indexes []int
+		for i, p := range points {
+			if v, ok := p.Metrics[metric]; ok {
+				values = append(values, v)
+				indexes = append(indexes, i)
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+		stats := newMetricStats(values, sigmas)
+		group.Metrics[metric] = stats
+		for j, i := range indexes {
+			if flag := stats.flag(metric, j, sigmas); flag != nil {
+				points[i].Flags = append(points[i].Flags, *flag)
+			}
+		}
+	}
+	return group
+}
+
+// newestSessions returns the newest n sessions matching the query, oldest first, and
+// whether older ones were left out.
+func newestSessions(query SessionQuery, n int) ([]SessionData, bool) {
+	query.Sort, query.Desc, query.Limit, query.Cursor = "created_at", true, min(n, session_page_max), nil
+
+	var sessions []SessionData
+	truncated := false
+	for {
+		page := session_data_provider.QuerySessions(query)
+		sessions = append(sessions, page.Sessions...)
+		if len(sessions) >= n {
+			truncated = len(sessions) > n || page.NextCursor != ""
+			sessions = sessions[:n]
+			break
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor, _ = DecodeSessionCursor(page.NextCursor)
+	}
+	slices.Reverse(sessions)
+	return sessions, truncated
+}
+
+// consistencyHandler aggregates the sessions matching the session list filters (from,
+// to, coffee, roaster, user, tag, q) by group_by and returns the distribution of the
+// roast metrics of every group, with individuals control chart limits at sigma
+// sigmas and the batches out of tolerance.
+func consistencyHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+
+	values := r.URL.Query()
+	group_by := values.Get("group_by")
+	if group_by == "" {
+		group_by = "coffee"
+	}
+	if !slices.Contains(consistency_group_by, group_by) {
+		writeJSONError(w, http.StatusBadRequest, "group_by debe ser uno de: "+strings.Join(consistency_group_by, ", "))
+		return
+	}
+
+	sigmas := float64(consistency_default_sigma)
+	if v := values.Get("sigma"); v != "" {
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil || parsed < 1 || parsed > 6 {
+			writeJSONError(w, http.StatusBadRequest, "sigma debe estar entre 1 y 6")
+			return
+		}
+		sigmas = parsed
+	}
+
+	values.Del("sort")
+	values.Del("order")
+	values.Del("limit")
+	values.Del("cursor")
+	query, err := ParseSessionQuery(values)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	sessions, truncated := newestSessions(query, consistency_max_sessions)
+
+	groups := map[string][]ConsistencyPoint{}
+	skipped := []string{}
+	for _, s := range sessions {
+		keys := consistencyKeys(s, group_by)
+		if len(keys) == 0 || s.EndAt == 0 {
+			continue
+		}
+		profile, err := LoadRoastProfile(s.Id)
+		if errors.Is(err, ErrNoMeasurements) {
+			skipped = append(skipped, s.Id)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		metrics := consistencyMetrics(profile)
+		for _, key := range keys {
+			groups[key] = append(groups[key], ConsistencyPoint{
+				SessionId: s.Id, Name: s.Name, CreateAt: s.CreateAt, Metrics: metrics, Flags: []ConsistencyFlag{},
+			})
+		}
+	}
+
+	result := []ConsistencyGroup{}
+	for key, points := range groups {
+		result = append(result, analyzeConsistency(key, points, sigmas))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Sessions != result[j].Sessions {
+			return result[i].Sessions > result[j].Sessions
+		}
+		return result[i].Key < result[j].Key
+	})
+
+	json.NewEncoder(w).Encode(map[string]any{
+		"group_by":  group_by,
+		"sigma":     sigmas,
+		"metrics":   consistency_metrics,
+		"groups":    result,
+		"skipped":   skipped,
+		"truncated": truncated,
+	})
+}
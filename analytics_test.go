@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestNewMetricStats(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   MetricStats
+	}{
+		{"single batch", []float64{12}, MetricStats{N: 1, Mean: 12, Min: 12, Max: 12, UCL: 12, LCL: 12}},
+		// Moving ranges 2, 1, 2, 1: sigma = 1.5 / 1.128.
+		{"batches", []float64{10, 12, 11, 13, 12}, MetricStats{
+			N: 5, Mean: 11.6, Min: 10, Max: 13, Stdev: math.Sqrt(1.3),
+			Sigma: 1.5 / 1.128, UCL: 11.6 + 3*1.5/1.128, LCL: 11.6 - 3*1.5/1.128, Trend: 0.5,
+		}},
+		{"constant", []float64{200, 200, 200}, MetricStats{N: 3, Mean: 200, Min: 200, Max: 200, UCL: 200, LCL: 200}},
+		{"falling", []float64{30, 20, 10}, MetricStats{
+			N: 3, Mean: 20, Min: 10, Max: 30, Stdev: 10,
+			Sigma: 10 / 1.128, UCL: 20 + 30/1.128, LCL: 20 - 30/1.128, Trend: -10,
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := newMetricStats(test.values, 3)
+			fields := []struct {
+				name      string
+				got, want float64
+			}{
+				{"mean", got.Mean, test.want.Mean}, {"min", got.Min, test.want.Min}, {"max", got.Max, test.want.Max},
+				{"stdev", got.Stdev, test.want.Stdev}, {"sigma", got.Sigma, test.want.Sigma},
+				{"ucl", got.UCL, test.want.UCL}, {"lcl", got.LCL, test.want.LCL}, {"trend", got.Trend, test.want.Trend},
+			}
+			if got.N != test.want.N {
+				t.Errorf("n = %d, want %d", got.N, test.want.N)
+			}
+			for _, field := range fields {
+				if math.Abs(field.got-field.want) > 1e-9 {
+					t.Errorf("%s = %v, want %v", field.name, field.got, field.want)
+				}
+			}
+		})
+	}
+}
+
+func TestMetricStatsFlag(t *testing.T) {
+	// Mean 100 and sigma 1: limits at 97 and 103, warnings beyond 2.
+	stats := func(values ...float64) *MetricStats {
+		return &MetricStats{N: len(values), Mean: 100, Sigma: 1, UCL: 103, LCL: 97, values: values}
+	}
+	tests := []struct {
+		name  string
+		stats *MetricStats
+		i     int
+		want  string // The rule, "" for no flag.
+	}{
+		{"in control", stats(100, 101, 99), 2, ""},
+		{"over ucl", stats(100, 101, 104), 2, "out_of_control"},
+		{"under lcl", stats(100, 101, 96), 2, "out_of_control"},
+		{"warning", stats(100, 101, 102.5), 2, "warning"},
+		{"low warning", stats(100, 101, 97.5), 2, "warning"},
+		{"shift", stats(99, 101, 101, 101, 101, 101, 101, 101), 7, "shift"},
+		{"run too short", stats(101, 99, 101, 101, 101, 101, 101, 101), 7, ""},
+		{"run broken at the mean", stats(101, 101, 101, 100, 101, 101, 101, 101), 7, ""},
+		{"too few batches", &MetricStats{N: 2, Mean: 100, Sigma: 1, UCL: 103, LCL: 97, values: []float64{100, 110}}, 1, ""},
+		{"no spread", &MetricStats{N: 3, Mean: 100, UCL: 100, LCL: 100, values: []float64{100, 100, 100}}, 2, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			flag := test.stats.flag("fc_temp", test.i, 3)
+			got := ""
+			if flag != nil {
+				got = flag.Rule
+				if flag.Metric != "fc_temp" || flag.Value != test.stats.values[test.i] {
+					t.Errorf("flag = %+v", *flag)
+				}
+			}
+			if got != test.want {
+				t.Errorf("rule = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewestSessions(t *testing.T) {
+	db := useTestDatabase(t)
+	for i := range 12 {
+		insertSession(t, db, fmt.Sprintf("s%02d", i), fmt.Sprintf("Huila #%d", i), int64(1000+i*1000))
+	}
+
+	tests := []struct {
+		name          string
+		n             int
+		want          []string
+		wantTruncated bool
+	}{
+		{"all", 20, []string{"s00", "s01", "s02", "s03", "s04", "s05", "s06", "s07", "s08", "s09", "s10", "s11"}, false},
+		{"exactly all", 12, []string{"s00", "s01", "s02", "s03", "s04", "s05", "s06", "s07", "s08", "s09", "s10", "s11"}, false},
+		// The newest batches are the ones kept, oldest first.
+		{"newest", 3, []string{"s09", "s10", "s11"}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sessions, truncated := newestSessions(SessionQuery{Sort: "created_at"}, test.n)
+			var ids []string
+			for _, s := range sessions {
+				ids = append(ids, s.Id)
+			}
+			if !slices.Equal(ids, test.want) || truncated != test.wantTruncated {
+				t.Errorf("sessions = %v, truncated %v; want %v, %v", ids, truncated, test.want, test.wantTruncated)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiTokensHandler lists the API tokens of the logged in user; administrators see all of them.
+func apiTokensHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+
+	user := currentUser(r)
+	if user.TokenId != 0 {
+		writeJSONError(w, http.StatusForbidden, "no disponible con un token de API")
+		return
+	}
+
+	user_id := user.Id
+	if HasPermission(user, PermAdmin) {
+		user_id = 0
+	}
+	json.NewEncoder(w).Encode(map[string]any{"tokens": user_data_provider.GetApiTokens(user_id)})
+}
+
+// createApiTokenHandler creates an API token for the logged in user. The token is only
+// returned in this response. A token never gets more than its user's role.
+func createApiTokenHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+
+	user := currentUser(r)
+	if user.TokenId != 0 {
+		writeJSONError(w, http.StatusForbidden, "no disponible con un token de API")
+		return
+	}
+
+	var body struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays float64  `json:"expires_in_days"` // 0 for a token that never expires.
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "body invalido")
+		return
+	}
+	defer r.Body.Close()
+
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		writeJSONError(w, http.StatusBadRequest, "se requiere name")
+		return
+	}
+	if len(body.Scopes) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "se requiere al menos un scope")
+		return
+	}
+	for _, scope := range body.Scopes {
+		perms, ok := scope_permissions[scope]
+		if !ok {
+			writeJSONError(w, http.StatusBadRequest, "scope desconocido: "+scope)
+			return
+		}
+		for _, perm := range perms {
+			if !HasPermission(user, perm) {
+				writeJSONError(w, http.StatusForbidden, "tu rol no permite el scope "+scope)
+				return
+			}
+		}
+	}
+	if body.ExpiresInDays < 0 {
+		writeJSONError(w, http.StatusBadRequest, "expires_in_days no puede ser negativo")
+		return
+	}
+
+	token, token_hash, err := NewToken()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "error al crear el token")
+		return
+	}
+	token = api_token_prefix + token
+	token_hash = HashToken(token)
+
+	api_token := ApiToken{Name: body.Name, Scopes: body.Scopes, UserId: user.Id, Username: user.Username}
+	if body.ExpiresInDays > 0 {
+		api_token.ExpiresAt = time.Now().Add(time.Duration(body.ExpiresInDays * float64(24*time.Hour))).UnixMilli()
+	}
+	api_token, err = user_data_provider.CreateApiToken(api_token, token_hash)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Printf("%s creo el token de API %q (%s)", user.Username, api_token.Name, strings.Join(api_token.Scopes, ","))
+	Audit(r, "token.create", strconv.FormatInt(api_token.Id, 10), api_token)
+	json.NewEncoder(w).Encode(map[string]any{"status": true, "token": token, "api_token": api_token})
+}
+
+// revokeApiTokenHandler revokes the API token {id}. Users can revoke their own tokens;
+// administrators any token.
+func revokeApiTokenHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+
+	user := currentUser(r)
+	token_id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "id invalido")
+		return
+	}
+
+	owner := user.Id
+	if HasPermission(user, PermAdmin) {
+		owner = 0
+	}
+	// A token may revoke itself, e.g. when a script detects it leaked.
+	if user.TokenId != 0 && user.TokenId != token_id {
+		writeJSONError(w, http.StatusForbidden, "un token de API solo puede revocarse a si mismo")
+		return
+	}
+
+	if err := user_data_provider.RevokeApiToken(token_id, owner); err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	log.Printf("%s revoco el token de API %d", user.Actor(), token_id)
+	Audit(r, "token.revoke", strconv.FormatInt(token_id, 10), nil)
+	json.NewEncoder(w).Encode(map[string]any{"status": true, "msg": "token revocado"})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// AuditEntry is a state-changing action as recorded in the append-only audit log.
+type AuditEntry struct {
+	Id        int64           `json:"id"`
+	TimeStamp int64           `json:"timestamp"`        // When it happened (in milliseconds).
+	Actor     string          `json:"actor"`            // Who did it: a username, "token:<name>", "watchdog" or "system".
+	Action    string          `json:"action"`           // What was done, e.g. "session.delete".
+	Target    string          `json:"target"`           // What it was done to, e.g. the session id.
+	Detail    json.RawMessage `json:"detail,omitempty"` // Action specific data.
+	Remote    string          `json:"remote,omitempty"` // The address of the client.
+}
+
+// AuditFilter selects audit log entries.
+type AuditFilter struct {
+	Actor  string // Only entries of this actor.
+	Action string // Only this action; "session.*" selects every session action.
+	From   int64  // Only entries at or after this timestamp (in milliseconds).
+	To     int64  // Only entries at or before this timestamp (in milliseconds); 0 for no limit.
+	Limit  int
+}
+
+// AuditAs appends an action done by actor to the audit log. detail is stored as JSON.
+func AuditAs(actor string, remote string, action string, target string, detail any) {
+	if actor == "" {
+		actor = "anonimo"
+	}
+
+	entry := AuditEntry{TimeStamp: time.Now().UnixMilli(), Actor: actor, Action: action, Target: target, Remote: remote}
+	if detail != nil {
+		data, err := json.Marshal(detail)
+		if err != nil {
+			log.Println("auditoria: detalle invalido,", err)
+		} else {
+			entry.Detail = data
+		}
+	}
+
+	session_data_provider.InsertAudit(entry)
+}
+
+// Audit appends an action done by the user of the request to the audit log.
+func Audit(r *http.Request, action string, target string, detail any) {
+	AuditAs(currentUser(r).Actor(), r.RemoteAddr, action, target, detail)
+}
+
+// auditHandler returns the audit log, newest first, filtered by the actor, action,
+// from and to query parameters.
+func auditHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+
+	query := r.URL.Query()
+	filter := AuditFilter{Actor: query.Get("actor"), Action: query.Get("action"), Limit: 100}
+
+	for name, dst := range map[string]*int64{"from": &filter.From, "to": &filter.To} {
+		if v := query.Get(name); v != "" {
+			ts, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, name+" debe ser un timestamp en milisegundos")
+				return
+			}
+			*dst = ts
+		}
+	}
+	if limit, err := strconv.Atoi(query.Get("limit")); err == nil && limit > 0 {
+		filter.Limit = min(limit, 1000)
+	}
+
+	json.NewEncoder(w).Encode(map[string]any{"entries": session_data_provider.GetAudit(filter)})
+}
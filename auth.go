@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	login_cookie     = "tostador_session" // The cookie carrying the login token.
+	login_duration   = 7 * 24 * time.Hour // How long a login lasts.
+	pbkdf2_iter      = 210000             // PBKDF2-SHA256 iterations, as recommended by OWASP.
+	api_token_prefix = "tst_"             // Prefix telling API tokens apart from login tokens.
+	min_password_len = 8
+
+	admin_password_env = "TOSTADOR_ADMIN_PASSWORD" // Password of the administrator created on a fresh install.
+)
+
+var auth_enabled = true      // Whether the APIs require a login; disabled with -insecure.
+var allowed_origins []string // Extra origins allowed to open the WebSocket.
+
+type user_ctx_key struct{}
+
+// HashPassword derives a salted PBKDF2-SHA256 hash of password, encoded as
+// pbkdf2-sha256$<iterations>$<salt>$<hash>.
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, pbkdf2_iter, 32)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawStdEncoding
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", pbkdf2_iter, enc.EncodeToString(salt), enc.EncodeToString(key)), nil
+}
+
+// CheckPassword returns true if password matches the encoded hash.
+func CheckPassword(password string, encoded string) bool {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iter, err := strconv.Atoi(parts[1])
+	if err != nil || iter <= 0 {
+		return false
+	}
+	enc := base64.RawStdEncoding
+	salt, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := enc.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, iter, len(want))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(key, want) == 1
+}
+
+// NewToken returns a random token and the hash under which it is stored.
+func NewToken() (token string, token_hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the stored form of a token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// requestToken returns the token of a request from the Authorization header, the
+// login cookie or, for WebSocket handshakes and event streams (browsers cannot set
+// headers on them), the access_token query parameter.
+func requestToken(r *http.Request) string {
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(bearer)
+	}
+	if websocket.IsWebSocketUpgrade(r) || strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		if token := r.URL.Query().Get("access_token"); token != "" {
+			return token
+		}
+	}
+	if cookie, err := r.Cookie(login_cookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// authenticate returns the user logged in on the request, or the user behind the API
+// token of the request.
+func authenticate(r *http.Request) (User, error) {
+	return authenticateToken(requestToken(r))
+}
+
+// authenticateToken returns the user behind a login or API token.
+func authenticateToken(token string) (User, error) {
+	if token == "" {
+		return User{}, errors.New("no autenticado")
+	}
+	if strings.HasPrefix(token, api_token_prefix) {
+		return user_data_provider.GetApiTokenUser(HashToken(token))
+	}
+	return user_data_provider.GetLoginUser(HashToken(token))
+}
+
+// currentUser returns the user set by requireAuth, or an empty user when auth is disabled.
+func currentUser(r *http.Request) User {
+	user, _ := r.Context().Value(user_ctx_key{}).(User)
+	return user
+}
+
+// writeJSONError writes a JSON error body with the given status.
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"status": false, "error": true, "msg": msg})
+}
+
+// requireAuth rejects requests without a valid login and makes the user available to
+// the handler through currentUser. Users already authenticated by validateRequests
+// are not looked up again.
+func requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(user_ctx_key{}).(User); !auth_enabled || ok {
+			next(w, r)
+			return
+		}
+
+		user, err := authenticate(r)
+		if err != nil {
+			enabeCORS(w)
+			writeJSONError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), user_ctx_key{}, user)))
+	}
+}
+
+// checkOrigin allows WebSocket upgrades from clients without an Origin header (scripts,
+// the ESP32), from the same host, and from the origins given with -allowed-origins.
+// Browsers send the login cookie along, so other origins must not be trusted.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range allowed_origins {
+		if strings.EqualFold(origin, allowed) {
+			return true
+		}
+	}
+	log.Printf("origen websocket rechazado: %s", origin)
+	return false
+}
+
+// credentials is the body of the login and user creation requests.
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Role     string `json:"role,omitempty"` // Only for user creation; defaults to viewer.
+}
+
+// loginHandler checks the credentials, sets the login cookie and returns the token for
+// clients that prefer the Authorization header.
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+
+	var body credentials
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "body invalido")
+		return
+	}
+	defer r.Body.Close()
+
+	user, password_hash, err := user_data_provider.GetUserByName(body.Username)
+	if err != nil || !CheckPassword(body.Password, password_hash) {
+		log.Printf("login fallido de %q desde %s", body.Username, r.RemoteAddr)
+		AuditAs(body.Username, r.RemoteAddr, "auth.login_failed", body.Username, nil)
+		writeJSONError(w, http.StatusUnauthorized, "usuario o password incorrectos")
+		return
+	}
+
+	token, token_hash, err := NewToken()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "error al crear el login")
+		return
+	}
+	expires := time.Now().Add(login_duration)
+	if err := user_data_provider.CreateLogin(token_hash, user.Id, expires.UnixMilli()); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     login_cookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	log.Printf("login de %s", user.Username)
+	AuditAs(user.Username, r.RemoteAddr, "auth.login", user.Username, nil)
+	json.NewEncoder(w).Encode(map[string]any{"status": true, "user": user, "token": token, "expires_at": expires.UnixMilli()})
+}
+
+// logoutHandler ends the login of the request.
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+
+	if token := requestToken(r); token != "" {
+		user_data_provider.DeleteLogin(HashToken(token))
+	}
+	http.SetCookie(w, &http.Cookie{Name: login_cookie, Value: "", Path: "/", MaxAge: -1})
+
+	json.NewEncoder(w).Encode(map[string]any{"status": true, "msg": "sesion cerrada"})
+}
+
+// meHandler returns the logged in user.
+func meHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+	json.NewEncoder(w).Encode(map[string]any{"status": true, "user": currentUser(r), "auth": auth_enabled})
+}
+
+// usersHandler lists the users.
+func usersHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+	json.NewEncoder(w).Encode(map[string]any{"users": user_data_provider.GetUsers()})
+}
+
+// BootstrapAdmin creates the administrator username when there are no users yet, with
+// the password in the TOSTADOR_ADMIN_PASSWORD variable or, without it, a random one
+// written to the log. The API never creates users without a login, so this is how a
+// fresh install gets its first account.
+func BootstrapAdmin(username string) {
+	if !auth_enabled || user_data_provider.CountUsers() != 0 {
+		return
+	}
+	password := os.Getenv(admin_password_env)
+	generated := password == ""
+	if generated {
+		b := make([]byte, 12)
+		if _, err := rand.Read(b); err != nil {
+			log.Println("error al crear el administrador,", err)
+			return
+		}
+		password = base64.RawURLEncoding.EncodeToString(b)
+	}
+	if len(password) < min_password_len {
+		log.Printf("%s debe tener al menos %d caracteres, no se crea el administrador", admin_password_env, min_password_len)
+		return
+	}
+
+	password_hash, err := HashPassword(password)
+	if err != nil {
+		log.Println("error al crear el administrador,", err)
+		return
+	}
+	user, err := user_data_provider.CreateFirstUser(username, password_hash, RoleAdmin)
+	if err != nil {
+		return
+	}
+	if generated {
+		log.Printf("administrador %s creado con el password %s, cambialo en /api/v1/auth/password", user.Username, password)
+	} else {
+		log.Printf("administrador %s creado", user.Username)
+	}
+	AuditAs("system", "", "user.create", user.Username, map[string]any{"role": user.Role})
+}
+
+// createUserHandler creates a user.
+func createUserHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+
+	var body credentials
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "body invalido")
+		return
+	}
+	defer r.Body.Close()
+
+	body.Username = strings.TrimSpace(body.Username)
+	if body.Username == "" {
+		writeJSONError(w, http.StatusBadRequest, "se requiere username")
+		return
+	}
+	if len(body.Password) < min_password_len {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("el password debe tener al menos %d caracteres", min_password_len))
+		return
+	}
+
+	if body.Role == "" {
+		body.Role = RoleViewer
+	}
+	if !ValidRole(body.Role) {
+		writeJSONError(w, http.StatusBadRequest, "rol desconocido: "+body.Role)
+		return
+	}
+
+	password_hash, err := HashPassword(body.Password)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "error al crear el usuario")
+		return
+	}
+	user, err := user_data_provider.CreateUser(body.Username, password_hash, body.Role)
+	if err != nil {
+		writeJSONError(w, http.StatusConflict, "el usuario ya existe")
+		return
+	}
+
+	Audit(r, "user.create", user.Username, map[string]any{"role": user.Role})
+	json.NewEncoder(w).Encode(map[string]any{"status": true, "user": user})
+}
+
+// changePasswordHandler changes the password of the logged in user.
+func changePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+
+	var body struct {
+		Old string `json:"old_password"`
+		New string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "body invalido")
+		return
+	}
+	defer r.Body.Close()
+
+	if currentUser(r).TokenId != 0 {
+		writeJSONError(w, http.StatusForbidden, "no disponible con un token de API")
+		return
+	}
+
+	user, password_hash, err := user_data_provider.GetUserByName(currentUser(r).Username)
+	if err != nil || !CheckPassword(body.Old, password_hash) {
+		writeJSONError(w, http.StatusUnauthorized, "password actual incorrecto")
+		return
+	}
+	if len(body.New) < min_password_len {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("el password debe tener al menos %d caracteres", min_password_len))
+		return
+	}
+
+	new_hash, err := HashPassword(body.New)
+	if err == nil {
+		err = user_data_provider.SetPassword(user.Id, new_hash)
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "error al cambiar el password")
+		return
+	}
+
+	Audit(r, "user.password", user.Username, nil)
+	json.NewEncoder(w).Encode(map[string]any{"status": true, "msg": "password actualizado"})
+}
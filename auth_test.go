@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+// withAuth sets whether the APIs require a login for the duration of the test.
+func withAuth(t *testing.T, enabled bool) {
+	t.Helper()
+	previous := auth_enabled
+	auth_enabled = enabled
+	t.Cleanup(func() { auth_enabled = previous })
+}
+
+func TestRequestToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		headers map[string]string
+		want    string
+	}{
+		{"bearer", "/api/v1/auth/me", map[string]string{"Authorization": "Bearer abc"}, "abc"},
+		{"cookie", "/api/v1/auth/me", map[string]string{"Cookie": login_cookie + "=abc"}, "abc"},
+		{"bearer before cookie", "/api/v1/auth/me", map[string]string{"Authorization": "Bearer abc", "Cookie": login_cookie + "=def"}, "abc"},
+		{"websocket query", "/temp?access_token=abc", map[string]string{"Connection": "Upgrade", "Upgrade": "websocket"}, "abc"},
+		{"event stream query", "/api/v1/temp/events?access_token=abc", map[string]string{"Accept": "text/event-stream"}, "abc"},
+		// Tokens in the URL end up in logs and history, plain requests must use a header.
+		{"plain query", "/api/v1/auth/me?access_token=abc", nil, ""},
+		{"none", "/api/v1/auth/me", nil, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", test.target, nil)
+			for k, v := range test.headers {
+				r.Header.Set(k, v)
+			}
+			if got := requestToken(r); got != test.want {
+				t.Errorf("requestToken = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBootstrapAdmin(t *testing.T) {
+	tests := []struct {
+		name      string
+		auth      bool
+		password  string
+		wantUsers int
+	}{
+		{"from the variable", true, "secreto123", 1},
+		{"generated", true, "", 1},
+		{"too short", true, "corto", 0},
+		{"insecure", false, "", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTestDatabase(t)
+			withAuth(t, test.auth)
+			t.Setenv(admin_password_env, test.password)
+			var out bytes.Buffer
+			previous := log.Writer()
+			log.SetOutput(&out)
+			t.Cleanup(func() { log.SetOutput(previous) })
+
+			BootstrapAdmin("admin")
+			BootstrapAdmin("admin")
+			if got := user_data_provider.CountUsers(); got != test.wantUsers {
+				t.Fatalf("users = %d, want %d", got, test.wantUsers)
+			}
+			if test.wantUsers == 0 {
+				return
+			}
+
+			password := test.password
+			if password == "" {
+				match := regexp.MustCompile(`con el password (\S+),`).FindStringSubmatch(out.String())
+				if match == nil {
+					t.Fatalf("generated password not logged: %s", out.String())
+				}
+				password = match[1]
+			}
+			user, password_hash, err := user_data_provider.GetUserByName("admin")
+			if err != nil || user.Role != RoleAdmin || !CheckPassword(password, password_hash) {
+				t.Errorf("admin = %+v, %v; want an admin with the password %q", user, err, password)
+			}
+		})
+	}
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strings"
+)
+
+// Canvas is a drawing surface with the origin at the top left corner and lengths in
+// points. The roast chart draws on it, so the same chart renders to SVG, PNG and PDF.
+type Canvas interface {
+	Line(x1, y1, x2, y2 float64, color string, width float64, dashed bool)
+	Polyline(points [][2]float64, color string, width float64)
+	Rect(x, y, w, h float64, fill string)
+	// Text draws s with its baseline at y; anchor is "start", "middle" or "end".
+	Text(x, y float64, size float64, color string, anchor string, bold bool, s string)
+}
+
+// ChartTheme holds the colors of a chart.
+type ChartTheme struct {
+	Background string
+	Text       string
+	Grid       string
+	Axis       string
+	Mark       string
+	BT         string
+	RoR        string
+	Palette    []string // Colors of the other channels, or of every session on comparisons.
+}
+
+// chart_themes are the themes that can be chosen for charts.
+var chart_themes = map[string]ChartTheme{
+	"light": {
+		Background: "#ffffff", Text: "#374151", Grid: "#e5e7eb", Axis: "#374151", Mark: "#6b7280",
+		BT: "#dc2626", RoR: "#2563eb",
+		Palette: []string{"#dc2626", "#2563eb", "#16a34a", "#9333ea", "#ea580c", "#0891b2", "#ca8a04", "#db2777"},
+	},
+	"dark": {
+		Background: "#111827", Text: "#d1d5db", Grid: "#1f2937", Axis: "#9ca3af", Mark: "#9ca3af",
+		BT: "#f87171", RoR: "#60a5fa",
+		Palette: []string{"#f87171", "#60a5fa", "#4ade80", "#c084fc", "#fb923c", "#22d3ee", "#facc15", "#f472b6"},
+	},
+}
+
+// phase_colors are the colors of the drying, maillard and development phases.
+var phase_colors = [3]string{"#facc15", "#f97316", "#92400e"}
+
+// event_labels are the names of the roast events shown on reports.
+var event_labels = map[string]string{
+	"charge":        "Carga",
+	"turning_point": "Punto de retorno",
+	"dry_end":       "Fin de secado",
+	"first_crack":   "Primer crack",
+	"second_crack":  "Segundo crack",
+	"drop":          "Descarga",
+}
+
+// ChartOptions selects what a chart shows.
+type ChartOptions struct {
+	Channels []string // The temperature channels drawn; "bt" is the bean temperature.
+	RoR      bool     // Draw the rate of rise on a second axis.
+	Events   bool     // Annotate the roast events.
+	Align    string   // The event used as time 0, charge by default.
+	Theme    ChartTheme
+}
+
+// DefaultChartOptions returns the options of the report chart.
+func DefaultChartOptions() ChartOptions {
+	return ChartOptions{Channels: []string{"bt"}, RoR: true, Events: true, Align: "charge", Theme: chart_themes["light"]}
+}
+
+// RoastChart draws the temperature and RoR curves of one or more roasts with their
+// events, with time in seconds from the aligned event.
+type RoastChart struct {
+	Profiles []*RoastProfile
+	Width    float64
+	Height   float64
+	Options  ChartOptions
+}
+
+// chartScale maps a value range to a pixel range.
+type chartScale struct {
+	min, max float64
+	from, to float64
+}
+
+func (s chartScale) at(v float64) float64 {
+	v = math.Max(s.min, math.Min(s.max, v))
+	return s.from + (v-s.min)/(s.max-s.min)*(s.to-s.from)
+}
+
+// niceStep returns a round tick step to divide span in about n parts.
+func niceStep(span float64, n float64) float64 {
+	raw := span / n
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if raw <= m*magnitude {
+			return m * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+// formatClock formats seconds as m:ss.
+func formatClock(seconds float64) string {
+	sign := ""
+	if seconds < 0 {
+		sign, seconds = "-", -seconds
+	}
+	s := int(math.Round(seconds))
+	return fmt.Sprintf("%s%d:%02d", sign, s/60, s%60)
+}
+
+// channelValue returns the reading of a channel in a sample.
+func channelValue(temp *TempType, channel string) (float64, bool) {
+	if channel == "bt" {
+		return temp.Temp, true
+	}
+	v, ok := temp.Channels[channel]
+	return v, ok
+}
+
+// seriesColor returns the color of a channel (or of its RoR) of the i-th session.
+func (rc RoastChart) seriesColor(i int, channel string, ror bool) string {
+	theme := rc.Options.Theme
+	if len(rc.Profiles) > 1 {
+		return theme.Palette[i%len(theme.Palette)]
+	}
+	switch {
+	case ror:
+		return theme.RoR
+	case channel == "bt":
+		return theme.BT
+	}
+	for j, c := range rc.Options.Channels {
+		if c == channel {
+			return theme.Palette[(j+2)%len(theme.Palette)]
+		}
+	}
+	return theme.Text
+}
+
+// Draw draws the chart at x, y of the canvas.
+func (rc RoastChart) Draw(c Canvas, x float64, y float64) {
+	options, theme := rc.Options, rc.Options.Theme
+	fs := math.Max(8, rc.Width/70) // The font size grows with the chart.
+	left, right, top, bottom := fs*5.5, fs*5.5, fs*2.4, fs*3.8
+	if !options.RoR {
+		right = fs * 2
+	}
+	plot_w, plot_h := rc.Width-left-right, rc.Height-top-bottom
+	x0, y0 := x+left, y+top
+
+	origin := func(p *RoastProfile) int64 { return p.Events[options.Align].TimeStamp }
+	t_of := func(p *RoastProfile, i int) float64 { return float64(p.Temps[i].TimeStamp-origin(p)) / 1000 }
+
+	t_min, t_max := math.Inf(1), math.Inf(-1)
+	temp_min, temp_max := math.Inf(1), math.Inf(-1)
+	ror_max := 0.0
+	for _, p := range rc.Profiles {
+		t_min = math.Min(t_min, t_of(p, 0))
+		t_max = math.Max(t_max, t_of(p, len(p.Temps)-1))
+		charge := p.Events["charge"].TimeStamp
+		for i, temp := range p.Temps {
+			for _, channel := range options.Channels {
+				if v, ok := channelValue(temp, channel); ok {
+					temp_min = math.Min(temp_min, v)
+					temp_max = math.Max(temp_max, v)
+				}
+			}
+			// The first minute after charge is too noisy to scale the RoR axis.
+			if temp.TimeStamp-charge > 60000 {
+				ror_max = math.Max(ror_max, p.RoR[i])
+			}
+		}
+	}
+	if math.IsInf(temp_min, 1) {
+		temp_min, temp_max = 0, 100
+	}
+	if t_max <= t_min {
+		t_max = t_min + 1
+	}
+
+	temp_step := niceStep(math.Max(temp_max-temp_min, 10), math.Max(3, plot_h/(fs*5)))
+	temp := chartScale{math.Floor(temp_min/temp_step) * temp_step, math.Ceil(temp_max/temp_step) * temp_step, y0 + plot_h, y0}
+	if temp.max == temp.min {
+		temp.max += temp_step
+	}
+	ror_step := niceStep(math.Max(ror_max, 10), math.Max(3, plot_h/(fs*6)))
+	ror := chartScale{0, math.Ceil(ror_max/ror_step) * ror_step, y0 + plot_h, y0}
+	if ror.max == 0 {
+		ror.max = ror_step
+	}
+	time_step := math.Max(30, niceStep((t_max-t_min)/60, math.Max(2, plot_w/(fs*8)))*60)
+	time := chartScale{t_min, t_max, x0, x0 + plot_w}
+
+	c.Rect(x, y, rc.Width, rc.Height, theme.Background)
+
+	// Grid and axes.
+	temp_color := theme.Text
+	if len(rc.Profiles) == 1 && len(options.Channels) == 1 {
+		temp_color = rc.seriesColor(0, options.Channels[0], false)
+	}
+	for v := temp.min; v <= temp.max+temp_step/2; v += temp_step {
+		py := temp.at(v)
+		c.Line(x0, py, x0+plot_w, py, theme.Grid, 0.5, false)
+		c.Text(x0-fs/2, py+fs*0.35, fs, temp_color, "end", false, fmt.Sprintf("%.0f", v))
+	}
+	if options.RoR {
+		ror_color := theme.Text
+		if len(rc.Profiles) == 1 {
+			ror_color = theme.RoR
+		}
+		for v := ror.min; v <= ror.max+ror_step/2; v += ror_step {
+			c.Text(x0+plot_w+fs/2, ror.at(v)+fs*0.35, fs, ror_color, "start", false, fmt.Sprintf("%.0f", v))
+		}
+		c.Line(x0+plot_w, y0, x0+plot_w, y0+plot_h, theme.Axis, 0.8, false)
+		c.Text(x+rc.Width-2, y0-fs*1.1, fs, ror_color, "end", true, "RoR °C/min")
+	}
+	for t := math.Ceil(t_min/time_step) * time_step; t <= t_max; t += time_step {
+		px := time.at(t)
+		c.Line(px, y0, px, y0+plot_h, theme.Grid, 0.5, false)
+		c.Text(px, y0+plot_h+fs*1.4, fs, theme.Text, "middle", false, formatClock(t))
+	}
+	c.Line(x0, y0+plot_h, x0+plot_w, y0+plot_h, theme.Axis, 0.8, false)
+	c.Line(x0, y0, x0, y0+plot_h, theme.Axis, 0.8, false)
+	c.Text(x0-fs/2, y0-fs*1.1, fs, temp_color, "end", true, "°C")
+	c.Text(x0+plot_w/2, y0+plot_h+fs*3, fs, theme.Text, "middle", false, "tiempo desde "+strings.ToLower(event_labels[options.Align])+" (m:ss)")
+
+	// Events, behind the curves. Only the first session is labeled, on a second row
+	// when a label would overlap the previous one.
+	if options.Events {
+		label_end := math.Inf(-1)
+		for i, p := range rc.Profiles {
+			color := theme.Mark
+			if len(rc.Profiles) > 1 {
+				color = rc.seriesColor(i, "bt", false)
+			}
+			for _, name := range roast_event_names {
+				event, ok := p.Events[name]
+				if !ok {
+					continue
+				}
+				px := time.at(float64(event.TimeStamp-origin(p)) / 1000)
+				c.Line(px, y0, px, y0+plot_h, color, 0.6, true)
+				if i == 0 {
+					label := event_labels[name]
+					label_w := float64(len(label)) * fs * 0.6
+					label_y := y0 + fs*1.1
+					if px < label_end {
+						label_y += fs * 1.1
+					} else {
+						label_end = px + 2 + label_w
+					}
+					// Labels at the right end go to the left of their line.
+					if px+2+label_w > x0+plot_w {
+						c.Text(px-2, label_y, fs*0.9, theme.Mark, "end", false, label)
+					} else {
+						c.Text(px+2, label_y, fs*0.9, theme.Mark, "start", false, label)
+					}
+				}
+			}
+		}
+	}
+
+	// One point per half point of width is enough.
+	for i, p := range rc.Profiles {
+		every := max(1, int(float64(len(p.Temps))/(plot_w*2)))
+		if options.RoR {
+			var points [][2]float64
+			for j := 0; j < len(p.Temps); j += every {
+				if p.Temps[j].TimeStamp >= p.Events["charge"].TimeStamp {
+					points = append(points, [2]float64{time.at(t_of(p, j)), ror.at(p.RoR[j])})
+				}
+			}
+			c.Polyline(points, rc.seriesColor(i, "bt", true), 0.9)
+		}
+		for k := len(options.Channels) - 1; k >= 0; k-- {
+			channel := options.Channels[k]
+			width := 1.4
+			if channel != "bt" {
+				width = 1
+			}
+			// Missing readings break the curve.
+			var points [][2]float64
+			for j := 0; j < len(p.Temps); j += every {
+				v, ok := channelValue(p.Temps[j], channel)
+				if !ok {
+					c.Polyline(points, rc.seriesColor(i, channel, false), width)
+					points = nil
+					continue
+				}
+				points = append(points, [2]float64{time.at(t_of(p, j)), temp.at(v)})
+			}
+			c.Polyline(points, rc.seriesColor(i, channel, false), width)
+		}
+	}
+
+	rc.drawLegend(c, x0+fs/2, y0+fs*4.8, fs)
+}
+
+// drawLegend names the sessions of a comparison, or the channels of a session.
+func (rc RoastChart) drawLegend(c Canvas, x float64, y float64, fs float64) {
+	type entry struct{ label, color string }
+	var entries []entry
+	switch {
+	case len(rc.Profiles) > 1:
+		for i, p := range rc.Profiles {
+			entries = append(entries, entry{p.Session.Name, rc.seriesColor(i, "bt", false)})
+		}
+	case len(rc.Options.Channels) > 1 || rc.Options.RoR:
+		for _, channel := range rc.Options.Channels {
+			entries = append(entries, entry{strings.ToUpper(channel), rc.seriesColor(0, channel, false)})
+		}
+		if rc.Options.RoR {
+			entries = append(entries, entry{"RoR", rc.seriesColor(0, "bt", true)})
+		}
+	}
+	for i, e := range entries {
+		ly := y + float64(i)*fs*1.3
+		c.Line(x, ly-fs*0.35, x+fs*1.5, ly-fs*0.35, e.color, 1.6, false)
+		c.Text(x+fs*2, ly, fs*0.9, rc.Options.Theme.Text, "start", false, e.label)
+	}
+}
+
+// DrawPhaseBar draws the drying, maillard and development phases as a stacked bar
+// with their durations.
+func DrawPhaseBar(c Canvas, x float64, y float64, w float64, h float64, phases PhaseStats) {
+	c.Rect(x, y, w, h, chart_themes["light"].Grid)
+	if phases.TotalS <= 0 {
+		return
+	}
+	names := [3]string{"Secado", "Maillard", "Desarrollo"}
+	spans := [3]*float64{phases.DryingS, phases.MaillardS, phases.DevelopmentS}
+	pcts := [3]*float64{phases.DryingPct, phases.MaillardPct, phases.DevelopmentPct}
+
+	px := x
+	for i := range spans {
+		if spans[i] == nil {
+			continue
+		}
+		seg := w * *spans[i] / phases.TotalS
+		c.Rect(px, y, seg, h, phase_colors[i])
+		color := "#111827"
+		if i == 2 {
+			color = "#ffffff"
+		}
+		if seg > 50 {
+			c.Text(px+seg/2, y+h/2+3, 8, color, "middle", true, fmt.Sprintf("%s %s (%.0f%%)", names[i], formatClock(*spans[i]), *pcts[i]))
+		}
+		px += seg
+	}
+}
+
+// svgCanvas writes SVG elements.
+type svgCanvas struct {
+	b strings.Builder
+}
+
+func (s *svgCanvas) Line(x1, y1, x2, y2 float64, color string, width float64, dashed bool) {
+	dash := ""
+	if dashed {
+		dash = ` stroke-dasharray="3,3"`
+	}
+	fmt.Fprintf(&s.b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" stroke-width="%.1f"%s/>`+"\n", x1, y1, x2, y2, color, width, dash)
+}
+
+func (s *svgCanvas) Polyline(points [][2]float64, color string, width float64) {
+	if len(points) < 2 {
+		return
+	}
+	s.b.WriteString(`<polyline fill="none" stroke-linejoin="round" points="`)
+	for _, p := range points {
+		fmt.Fprintf(&s.b, "%.1f,%.1f ", p[0], p[1])
+	}
+	fmt.Fprintf(&s.b, `" stroke="%s" stroke-width="%.1f"/>`+"\n", color, width)
+}
+
+func (s *svgCanvas) Rect(x, y, w, h float64, fill string) {
+	fmt.Fprintf(&s.b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>`+"\n", x, y, w, h, fill)
+}
+
+func (s *svgCanvas) Text(x, y float64, size float64, color string, anchor string, bold bool, text string) {
+	weight := ""
+	if bold {
+		weight = ` font-weight="bold"`
+	}
+	fmt.Fprintf(&s.b, `<text x="%.1f" y="%.1f" font-size="%.1f" fill="%s" text-anchor="%s"%s>%s</text>`+"\n", x, y, size, color, anchor, weight, html.EscapeString(text))
+}
+
+// SVG returns a standalone SVG document of w by h with what was drawn.
+func (s *svgCanvas) SVG(w float64, h float64) string {
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f" font-family="Helvetica, Arial, sans-serif">`+"\n", w, h, w, h) +
+		s.b.String() + "</svg>\n"
+}
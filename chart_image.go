@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Chart image size limits, in pixels.
+const (
+	chart_default_w = 800
+	chart_default_h = 400
+	chart_min_w     = 200
+	chart_min_h     = 120
+	chart_max_w     = 2400
+	chart_max_h     = 1600
+)
+
+// ChartRequest is a chart image asked for in a query string.
+type ChartRequest struct {
+	Format  string // "png" or "svg".
+	Width   int
+	Height  int
+	Options ChartOptions
+}
+
+// ParseChartRequest reads format, width, height, channels (comma separated), ror,
+// events, theme and align from a query string.
+func ParseChartRequest(values url.Values) (ChartRequest, error) {
+	req := ChartRequest{Format: "png", Width: chart_default_w, Height: chart_default_h, Options: DefaultChartOptions()}
+
+	if v := values.Get("format"); v != "" {
+		if v != "png" && v != "svg" {
+			return req, errors.New("format debe ser png o svg")
+		}
+		req.Format = v
+	}
+
+	size := func(name string, v string, lo int, hi int, out *int) error {
+		if v == "" {
+			return nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < lo || n > hi {
+			return errors.New(name + " debe estar entre " + strconv.Itoa(lo) + " y " + strconv.Itoa(hi))
+		}
+		*out = n
+		return nil
+	}
+	if err := errors.Join(
+		size("width", values.Get("width"), chart_min_w, chart_max_w, &req.Width),
+		size("height", values.Get("height"), chart_min_h, chart_max_h, &req.Height),
+	); err != nil {
+		return req, err
+	}
+
+	if v := values.Get("channels"); v != "" {
+		req.Options.Channels = nil
+		for _, channel := range strings.Split(v, ",") {
+			if channel = strings.ToLower(strings.TrimSpace(channel)); channel != "" && !slices.Contains(req.Options.Channels, channel) {
+				req.Options.Channels = append(req.Options.Channels, channel)
+			}
+		}
+		if len(req.Options.Channels) == 0 {
+			return req, errors.New("channels no puede estar vacio")
+		}
+	}
+
+	flag := func(name string, out *bool) error {
+		v := values.Get(name)
+		if v == "" {
+			return nil
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return errors.New(name + " debe ser true o false")
+		}
+		*out = b
+		return nil
+	}
+	if err := errors.Join(flag("ror", &req.Options.RoR), flag("events", &req.Options.Events)); err != nil {
+		return req, err
+	}
+
+	if v := values.Get("theme"); v != "" {
+		theme, ok := chart_themes[v]
+		if !ok {
+			return req, errors.New("theme debe ser light o dark")
+		}
+		req.Options.Theme = theme
+	}
+
+	if v := values.Get("align"); v != "" {
+		if !slices.Contains(roast_event_names, v) {
+			return req, errors.New("align debe ser uno de: " + strings.Join(roast_event_names, ", "))
+		}
+		req.Options.Align = v
+	}
+
+	return req, nil
+}
+
+// checkChannels verifies that every channel was recorded in some of the sessions.
+func checkChannels(profiles []*RoastProfile, channels []string) error {
+	for _, channel := range channels {
+		found := channel == "bt"
+		for _, p := range profiles {
+			for _, temp := range p.Temps {
+				if _, ok := temp.Channels[channel]; ok {
+					found = true
+					break
+				}
+			}
+			if found {
+				break
+			}
+		}
+		if !found {
+			return errors.New("ninguna session tiene el canal " + channel)
+		}
+	}
+	return nil
+}
+
+// writeChart renders the chart of the profiles as the requested image.
+func writeChart(w http.ResponseWriter, profiles []*RoastProfile, req ChartRequest, name string) {
+	if err := checkChannels(profiles, req.Options.Channels); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	chart := RoastChart{Profiles: profiles, Width: float64(req.Width), Height: float64(req.Height), Options: req.Options}
+	w.Header().Set("Content-Disposition", `inline; filename="`+name+"."+req.Format+`"`)
+	switch req.Format {
+	case "svg":
+		var c svgCanvas
+		chart.Draw(&c, 0, 0)
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Write([]byte(c.SVG(chart.Width, chart.Height)))
+	default:
+		c := NewPNGCanvas(req.Width, req.Height, req.Options.Theme.Background)
+		chart.Draw(c, 0, 0)
+		w.Header().Set("Content-Type", "image/png")
+		if err := c.WritePNG(w); err != nil {
+			log.Println("error al enviar grafico,", err)
+		}
+	}
+}
+
+// roastSessionChartHandler renders the chart of the session {id} as a PNG or SVG image.
+func roastSessionChartHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+
+	req, err := ParseChartRequest(r.URL.Query())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	session_id := r.PathValue("id")
+	profiles, ok := loadAlignedProfiles(w, []string{session_id}, req.Options.Align)
+	if !ok {
+		return
+	}
+	writeChart(w, profiles, req, "tostado-"+session_id)
+}
+
+// roastSessionsCompareChartHandler renders the sessions given as ids=a,b,c on one
+// chart, aligned on charge or on the event given as align.
+func roastSessionsCompareChartHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+
+	req, err := ParseChartRequest(r.URL.Query())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ids, err := parseCompareIds(r.URL.Query().Get("ids"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	profiles, ok := loadAlignedProfiles(w, ids, req.Options.Align)
+	if !ok {
+		return
+	}
+	writeChart(w, profiles, req, "comparacion")
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	compare_max_sessions = 8
+	compare_default_step = 2 // Seconds between resampled points.
+)
+
+// CompareDelta is how far an event of a session is from the same event of the reference.
+type CompareDelta struct {
+	DT    float64 `json:"dt_s"`  // Seconds after (positive) or before the reference, on the aligned time base.
+	DTemp float64 `json:"dtemp"` // Degrees above (positive) or below the reference.
+}
+
+// CompareSimilarity measures how close a curve is to the reference over their overlap.
+type CompareSimilarity struct {
+	RmseBT  float64 `json:"rmse_bt"`  // Root mean square BT difference, in degrees.
+	RmseRoR float64 `json:"rmse_ror"` // Root mean square RoR difference, in degrees per minute.
+	Overlap float64 `json:"overlap_s"`
+	Score   float64 `json:"score"` // 100 for identical curves; 100*exp(-rmse_bt/20), so 5° off is ~78.
+}
+
+// CompareSession is a session of a comparison, resampled on the common time base.
+type CompareSession struct {
+	Session    SessionData             `json:"session"`
+	AlignedOn  string                  `json:"aligned_on"` // The event used as time 0.
+	AlignedAt  int64                   `json:"aligned_at"` // Its timestamp (in milliseconds).
+	Events     map[string]RoastEvent   `json:"events"`
+	Phases     PhaseStats              `json:"phases"`
+	BT         []*float64              `json:"bt"`  // BT at every point of time, null outside the roast.
+	RoR        []*float64              `json:"ror"` // RoR at every point of time, null outside the roast.
+	Deltas     map[string]CompareDelta `json:"deltas,omitempty"`
+	Similarity *CompareSimilarity      `json:"similarity,omitempty"`
+}
+
+// roastSessionsCompareHandler compares sessions given as ids=a,b,c. The curves are
+// aligned on charge, or on the event given as align, and resampled every step seconds.
+// The first session is the reference for the deltas and similarity.
+func roastSessionsCompareHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+
+	query := r.URL.Query()
+	ids, err := parseCompareIds(query.Get("ids"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	align := query.Get("align")
+	if align == "" {
+		align = "charge"
+	}
+	if !slices.Contains(roast_event_names, align) {
+		writeJSONError(w, http.StatusBadRequest, "align debe ser uno de: "+strings.Join(roast_event_names, ", "))
+		return
+	}
+
+	step := float64(compare_default_step)
+	if v := query.Get("step"); v != "" {
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil || parsed < 0.5 || parsed > 60 {
+			writeJSONError(w, http.StatusBadRequest, "step debe estar entre 0.5 y 60 segundos")
+			return
+		}
+		step = parsed
+	}
+
+	profiles, ok := loadAlignedProfiles(w, ids, align)
+	if !ok {
+		return
+	}
+
+	// The common time base covers every curve.
+	start, end := math.Inf(1), math.Inf(-1)
+	for _, p := range profiles {
+		origin := p.Events[align].TimeStamp
+		start = math.Min(start, float64(p.Temps[0].TimeStamp-origin)/1000)
+		end = math.Max(end, float64(p.Temps[len(p.Temps)-1].TimeStamp-origin)/1000)
+	}
+	start = math.Floor(start/step) * step
+	times := []float64{}
+	for t := start; t <= end; t += step {
+		times = append(times, t)
+	}
+
+	sessions := make([]CompareSession, len(profiles))
+	for i, p := range profiles {
+		origin := p.Events[align]
+		s := CompareSession{
+			Session:   p.Session,
+			AlignedOn: align,
+			AlignedAt: origin.TimeStamp,
+			Events:    p.Events,
+			Phases:    p.Phases(),
+			BT:        make([]*float64, len(times)),
+			RoR:       make([]*float64, len(times)),
+		}
+		for j, t := range times {
+			if bt, ror, ok := p.At(origin.TimeStamp, t); ok {
+				s.BT[j], s.RoR[j] = &bt, &ror
+			}
+		}
+		sessions[i] = s
+	}
+
+	reference := sessions[0]
+	for i := range sessions {
+		sessions[i].Deltas = compareDeltas(reference, sessions[i])
+		sessions[i].Similarity = compareSimilarity(reference, sessions[i], step)
+	}
+
+	json.NewEncoder(w).Encode(map[string]any{
+		"align":     align,
+		"step_s":    step,
+		"reference": reference.Session.Id,
+		"time":      times,
+		"sessions":  sessions,
+	})
+}
+
+// parseCompareIds splits the comma separated ids of a comparison.
+func parseCompareIds(v string) ([]string, error) {
+	ids := []string{}
+	for _, id := range strings.Split(v, ",") {
+		if id = strings.TrimSpace(id); id != "" && !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) < 2 || len(ids) > compare_max_sessions {
+		return nil, errors.New("ids debe tener entre 2 y " + strconv.Itoa(compare_max_sessions) + " sessions separadas por coma")
+	}
+	return ids, nil
+}
+
+// loadAlignedProfiles loads the profiles of the sessions, which must all have the
+// align event. On failure it writes the error response and returns false.
+func loadAlignedProfiles(w http.ResponseWriter, ids []string, align string) ([]*RoastProfile, bool) {
+	profiles := make([]*RoastProfile, len(ids))
+	for i, id := range ids {
+		profile, err := LoadRoastProfile(id)
+		if errors.Is(err, ErrNoMeasurements) {
+			writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+			return nil, false
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return nil, false
+		}
+		if _, ok := profile.Events[align]; !ok {
+			writeJSONError(w, http.StatusUnprocessableEntity, "la session "+id+" no tiene el evento "+align)
+			return nil, false
+		}
+		profiles[i] = profile
+	}
+	return profiles, true
+}
+
+// compareDeltas returns the event differences of s against the reference, on the aligned time base.
+func compareDeltas(reference CompareSession, s CompareSession) map[string]CompareDelta {
+	deltas := map[string]CompareDelta{}
+	for name, event := range s.Events {
+		ref, ok := reference.Events[name]
+		if !ok {
+			continue
+		}
+		dt := float64(event.TimeStamp-s.AlignedAt)/1000 - float64(ref.TimeStamp-reference.AlignedAt)/1000
+		deltas[name] = CompareDelta{DT: dt, DTemp: event.Temp - ref.Temp}
+	}
+	return deltas
+}
+
+// compareSimilarity compares the resampled curves of s and the reference where both exist.
+func compareSimilarity(reference CompareSession, s CompareSession, step float64) *CompareSimilarity {
+	var sum_bt, sum_ror float64
+	n := 0
+	for j := range reference.BT {
+		if reference.BT[j] == nil || s.BT[j] == nil {
+			continue
+		}
+		d_bt := *s.BT[j] - *reference.BT[j]
+		d_ror := *s.RoR[j] - *reference.RoR[j]
+		sum_bt += d_bt * d_bt
+		sum_ror += d_ror * d_ror
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+
+	similarity := &CompareSimilarity{
+		RmseBT:  math.Sqrt(sum_bt / float64(n)),
+		RmseRoR: math.Sqrt(sum_ror / float64(n)),
+		Overlap: float64(n-1) * step,
+	}
+	similarity.Score = 100 * math.Exp(-similarity.RmseBT/20)
+	return similarity
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+// ControlDriver sends burner/heater and fan duty commands to a roaster. Sources that
+// can also actuate the roaster (ESP32, simulator, Modbus) implement it.
+type ControlDriver interface {
+	// Name returns the name of the transport (e.g., "esp32").
+	Name() string
+	// CanControl returns false when the transport has no control outputs configured.
+	CanControl() bool
+	// SetOutputs applies the heat and fan duty, both in percent. Transports that write
+	// them separately return a *PartialOutputError when only one of them was applied.
+	SetOutputs(heat float64, fan float64) error
+}
+
+// PartialOutputError reports a control command of which only part reached the roaster.
+// Heat and Fan are the outputs the roaster is running with.
+type PartialOutputError struct {
+	Heat float64
+	Fan  float64
+	Err  error
+}
+
+func (e *PartialOutputError) Error() string {
+	return fmt.Sprintf("control aplicado a medias (heat %.1f%% fan %.1f%%): %v", e.Heat, e.Fan, e.Err)
+}
+
+func (e *PartialOutputError) Unwrap() error { return e.Err }
+
+// ControlLimits are the hard safety limits enforced on every control command.
+type ControlLimits struct {
+	HeatMax        float64 `json:"heat_max"`          // Highest heat duty allowed.
+	FanMinWithHeat float64 `json:"fan_min_with_heat"` // Lowest fan duty allowed while the heat is on.
+	MaxBT          float64 `json:"max_bt"`            // Bean temperature at which the heat is forced off.
+}
+
+// DefaultControlLimits returns conservative limits for a small drum roaster.
+func DefaultControlLimits() ControlLimits {
+	return ControlLimits{HeatMax: 100, FanMinWithHeat: 20, MaxBT: 235}
+}
+
+// ControlState is a control change as applied to the roaster.
+type ControlState struct {
+	TimeStamp int64   `json:"timestamp"`         // When the change was applied (in milliseconds).
+	Heat      float64 `json:"heat"`              // The heat duty in percent.
+	Fan       float64 `json:"fan"`               // The fan duty in percent.
+	Origin    string  `json:"origin"`            // Who asked for it: "ui", "pid", "safety", ...
+	Limited   bool    `json:"limited,omitempty"` // Whether the safety limits changed the requested values.
+}
+
+// Controller applies control commands through a driver after enforcing the safety
+// limits, and logs every change with the active session.
+type Controller struct {
+	set_mu    sync.Mutex // Serializes Set, so commands reach the driver in order.
+	mu        sync.Mutex // Protects the fields below; never held during driver I/O.
+	driver    ControlDriver
+	limits    ControlLimits
+	state     ControlState
+	interlock string // Why the heat is locked off, empty when it is not.
+}
+
+// NewController creates a controller; driver may be nil when the roaster cannot be actuated.
+func NewController(driver ControlDriver, limits ControlLimits) *Controller {
+	return &Controller{driver: driver, limits: limits, state: ControlState{Origin: "init"}}
+}
+
+// HasDriver returns true if the controller can actuate the roaster.
+func (c *Controller) HasDriver() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.driver != nil
+}
+
+// State returns the last applied control change.
+func (c *Controller) State() ControlState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// Limits returns the safety limits.
+func (c *Controller) Limits() ControlLimits {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.limits
+}
+
+// Set applies the heat and fan duty requested by origin. Values outside 0-100 are
+// rejected; values outside the safety limits are clamped and the result is flagged
+// as limited.
+func (c *Controller) Set(heat float64, fan float64, origin string) (ControlState, error) {
+	if math.IsNaN(heat) || math.IsNaN(fan) || heat < 0 || heat > 100 || fan < 0 || fan > 100 {
+		return c.State(), errors.New("heat y fan deben estar entre 0 y 100")
+	}
+
+	// The bean temperature is read before taking the locks, Publish may be updating it.
+	bt := currentData().Temp
+
+	c.set_mu.Lock()
+	defer c.set_mu.Unlock()
+
+	c.mu.Lock()
+	driver, limits, interlock, previous := c.driver, c.limits, c.interlock, c.state
+	c.mu.Unlock()
+
+	if driver == nil {
+		return previous, errors.New("no hay actuador de control configurado")
+	}
+
+	state := ControlState{Heat: heat, Fan: fan, Origin: origin}
+
+	if state.Heat > limits.HeatMax {
+		state.Heat = limits.HeatMax
+		state.Limited = true
+	}
+	if state.Heat > 0 && state.Fan < limits.FanMinWithHeat {
+		state.Fan = limits.FanMinWithHeat
+		state.Limited = true
+	}
+	if state.Heat > 0 && (bt >= limits.MaxBT || interlock != "") {
+		state.Heat = 0
+		state.Limited = true
+	}
+
+	err := driver.SetOutputs(state.Heat, state.Fan)
+	var partial *PartialOutputError
+	if err != nil && !errors.As(err, &partial) {
+		log.Printf("control %s: %v", driver.Name(), err)
+		return previous, fmt.Errorf("error al enviar control: %w", err)
+	}
+	if partial != nil {
+		// Record what the roaster is really running with, so the UI and the log do not lie.
+		log.Printf("control %s: %v", driver.Name(), err)
+		state.Heat, state.Fan = partial.Heat, partial.Fan
+	}
+
+	state.TimeStamp = time.Now().UnixMilli()
+	c.mu.Lock()
+	c.state = state
+	c.mu.Unlock()
+	log.Printf("control (%s): heat %.1f%% fan %.1f%% limitado=%v", origin, state.Heat, state.Fan, state.Limited)
+
+	if active, ok := session.Active(); ok {
+		go session_data_provider.InsertControlChange(active.Id, state)
+	}
+	send_data_to_clients(map[string]any{"type": "control", "control": state})
+
+	if partial != nil {
+		return state, fmt.Errorf("error al enviar control: %w", err)
+	}
+	return state, nil
+}
+
+// Check is a pipeline subscriber that forces the heat off when the bean temperature
+// reaches the limit.
+func (c *Controller) Check(temp TempType) {
+	state := c.State()
+	if !c.HasDriver() || state.Heat == 0 || temp.Temp < c.Limits().MaxBT {
+		return
+	}
+
+	log.Printf("control: BT %.1f sobre el limite, apagando el calor", temp.Temp)
+	if _, err := c.Set(0, state.Fan, "safety"); err != nil {
+		log.Println("control: no se pudo apagar el calor:", err)
+	}
+}
+
+// SetInterlock locks the heat off for the given reason, forcing it off right away.
+// An empty reason releases the lock; the heat stays off until it is set again.
+func (c *Controller) SetInterlock(reason string) {
+	c.mu.Lock()
+	changed := c.interlock != reason
+	c.interlock = reason
+	has_driver := c.driver != nil
+	state := c.state
+	c.mu.Unlock()
+
+	if !changed || !has_driver {
+		return
+	}
+
+	if reason == "" {
+		log.Println("control: interlock liberado")
+		return
+	}
+
+	log.Printf("control: interlock activo (%s)", reason)
+	if _, err := c.Set(0, state.Fan, "safety"); err != nil {
+		log.Println("control: no se pudo apagar el calor:", err)
+	}
+}
+
+// Interlock returns why the heat is locked off, or an empty string.
+func (c *Controller) Interlock() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.interlock
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// fakeDriver records the outputs it is asked to apply and fails with err.
+type fakeDriver struct {
+	heat, fan float64
+	calls     int
+	err       error
+}
+
+func (d *fakeDriver) Name() string     { return "fake" }
+func (d *fakeDriver) CanControl() bool { return true }
+func (d *fakeDriver) SetOutputs(heat float64, fan float64) error {
+	d.calls++
+	if d.err != nil {
+		return d.err
+	}
+	d.heat, d.fan = heat, fan
+	return nil
+}
+
+func setCurrentTemp(t *testing.T, bt float64) {
+	t.Helper()
+	current_mu.Lock()
+	previous := current_data
+	current_data = TempType{Type: "temp", Temp: bt}
+	current_mu.Unlock()
+	t.Cleanup(func() {
+		current_mu.Lock()
+		current_data = previous
+		current_mu.Unlock()
+	})
+}
+
+func TestControllerSet(t *testing.T) {
+	limits := ControlLimits{HeatMax: 80, FanMinWithHeat: 30, MaxBT: 220}
+	tests := []struct {
+		name      string
+		heat, fan float64
+		bt        float64
+		interlock string
+		driverErr error
+		want      ControlState
+		wantErr   bool
+	}{
+		{"within limits", 50, 60, 150, "", nil, ControlState{Heat: 50, Fan: 60}, false},
+		{"heat clamped", 95, 60, 150, "", nil, ControlState{Heat: 80, Fan: 60, Limited: true}, false},
+		{"fan raised with heat", 50, 10, 150, "", nil, ControlState{Heat: 50, Fan: 30, Limited: true}, false},
+		{"fan free without heat", 0, 0, 150, "", nil, ControlState{Heat: 0, Fan: 0}, false},
+		{"bt over limit", 50, 60, 225, "", nil, ControlState{Heat: 0, Fan: 60, Limited: true}, false},
+		{"interlock", 50, 60, 150, "sensor", nil, ControlState{Heat: 0, Fan: 60, Limited: true}, false},
+		{"out of range", 120, 60, 150, "", nil, ControlState{Origin: "init"}, true},
+		{"driver error", 50, 60, 150, "", errors.New("sin conexion"), ControlState{Origin: "init"}, true},
+		{"partial write", 50, 60, 150, "", &PartialOutputError{Heat: 0, Fan: 60, Err: errors.New("timeout")}, ControlState{Heat: 0, Fan: 60}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setCurrentTemp(t, test.bt)
+			driver := &fakeDriver{err: test.driverErr}
+			c := NewController(driver, limits)
+			c.interlock = test.interlock
+
+			state, err := c.Set(test.heat, test.fan, "test")
+			if (err != nil) != test.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, test.wantErr)
+			}
+			if state.Heat != test.want.Heat || state.Fan != test.want.Fan || state.Limited != test.want.Limited {
+				t.Errorf("state = %+v, want %+v", state, test.want)
+			}
+			if got := c.State(); got.Heat != state.Heat || got.Fan != state.Fan {
+				t.Errorf("State() = %+v, want %+v", got, state)
+			}
+			if test.driverErr == nil && !test.wantErr && (driver.heat != state.Heat || driver.fan != state.Fan) {
+				t.Errorf("driver got heat %v fan %v, want %+v", driver.heat, driver.fan, state)
+			}
+		})
+	}
+}
+
+func TestControllerSetWithoutDriver(t *testing.T) {
+	c := NewController(nil, DefaultControlLimits())
+	if _, err := c.Set(10, 50, "test"); err == nil {
+		t.Error("Set without driver succeeded")
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// useTestDatabase points the data providers at an empty database in a temporary
+// directory for the duration of the test.
+func useTestDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, users := session_data_provider, user_data_provider
+	session_data_provider, user_data_provider = NewSessionDataProvider(db), NewUserDataProvider(db)
+	session_data_provider.Prepare()
+	user_data_provider.Prepare()
+	t.Cleanup(func() {
+		session_data_provider, user_data_provider = sessions, users
+		db.Close()
+	})
+	return db
+}
+
+// insertSession stores a finished session created at create_at.
+func insertSession(t *testing.T, db *sql.DB, id string, name string, create_at int64) {
+	t.Helper()
+	if _, err := db.Exec(`INSERT INTO sessions (session_id,session_name,created_at,end_at,started_by) VALUES (?,?,?,?,?)`, id, name, create_at, create_at+600000, "test"); err != nil {
+		t.Fatal(err)
+	}
+}
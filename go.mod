@@ -3,13 +3,18 @@ module tostadora_server
 go 1.24.5
 
 require (
+	github.com/Davidc2525/go_try v0.0.0-20250805195054-934ab2ed2193
+	github.com/google/uuid v1.6.0
 	github.com/gorilla/WebSocket v1.4.0
+	github.com/gorilla/websocket v1.5.3
+	github.com/mattn/go-sqlite3 v1.14.29
 	golang.org/x/net v0.42.0
+	google.golang.org/grpc v1.75.0
+	google.golang.org/protobuf v1.36.8
 )
 
 require (
-	github.com/Davidc2525/go_try v0.0.0-20250805195054-934ab2ed2193 // indirect
-	github.com/google/uuid v1.6.0 // indirect
-	github.com/gorilla/websocket v1.5.3 // indirect
-	github.com/mattn/go-sqlite3 v1.14.29 // indirect
+	golang.org/x/sys v0.34.0 // indirect
+	golang.org/x/text v0.27.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20250707201910-8d1bb00bc6a7 // indirect
 )
@@ -0,0 +1,383 @@
+package main
+
+//go:generate protoc --go_out=. --go_opt=module=tostadora_server --go-grpc_out=. --go-grpc_opt=module=tostadora_server proto/tostadora.proto
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpc_credentials "google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	pb "tostadora_server/tostadorapb"
+)
+
+// grpcServer implements the Tostadora gRPC service over the same providers as the
+// REST and WebSocket handlers.
+type grpcServer struct {
+	pb.UnimplementedTostadoraServer
+}
+
+// ServeGRPC serves the gRPC API on addr until the listener fails, over TLS when
+// cert_file and key_file are given.
+func ServeGRPC(addr string, cert_file string, key_file string) error {
+	if err := checkGRPCPermissions(); err != nil {
+		return err
+	}
+	var options []grpc.ServerOption
+	if cert_file != "" || key_file != "" {
+		creds, err := grpc_credentials.NewServerTLSFromFile(cert_file, key_file)
+		if err != nil {
+			return err
+		}
+		options = append(options, grpc.Creds(creds))
+	} else if auth_enabled {
+		log.Println("ATENCION: gRPC sin TLS, los tokens viajan en claro; usa -grpc-cert y -grpc-key")
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("gRPC server starting on %s", addr)
+	return newGRPCServer(options...).Serve(listener)
+}
+
+// newGRPCServer creates a gRPC server with the Tostadora service behind the auth interceptors.
+func newGRPCServer(options ...grpc.ServerOption) *grpc.Server {
+	options = append(options, grpc.UnaryInterceptor(grpcUnaryAuth), grpc.StreamInterceptor(grpcStreamAuth))
+	server := grpc.NewServer(options...)
+	pb.RegisterTostadoraServer(server, &grpcServer{})
+	return server
+}
+
+// checkGRPCPermissions fails when a method of the service has no entry in grpc_permissions.
+func checkGRPCPermissions() error {
+	var missing []string
+	for _, method := range pb.Tostadora_ServiceDesc.Methods {
+		if _, ok := grpc_permissions[method.MethodName]; !ok {
+			missing = append(missing, method.MethodName)
+		}
+	}
+	for _, stream := range pb.Tostadora_ServiceDesc.Streams {
+		if _, ok := grpc_permissions[stream.StreamName]; !ok {
+			missing = append(missing, stream.StreamName)
+		}
+	}
+	if len(missing) > 0 {
+		return errors.New("metodos gRPC sin permiso en grpc_permissions: " + strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// grpcAuth authenticates the bearer token of a call and checks the permission of its
+// method. It returns the context with the user, for grpcUser.
+func grpcAuth(ctx context.Context, full_method string) (context.Context, error) {
+	if !auth_enabled {
+		return ctx, nil
+	}
+
+	var token string
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		if bearer, ok := strings.CutPrefix(v, "Bearer "); ok {
+			token = strings.TrimSpace(bearer)
+		}
+	}
+	user, err := authenticateToken(token)
+	if err != nil {
+		return ctx, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	method := path.Base(full_method)
+	perm, ok := grpc_permissions[method]
+	if !ok {
+		return ctx, status.Error(codes.PermissionDenied, "metodo sin permiso definido: "+method)
+	}
+	if !HasPermission(user, perm) {
+		log.Printf("permiso %s denegado a %s (%s) en gRPC %s", perm, user.Actor(), user.Role, method)
+		return ctx, status.Error(codes.PermissionDenied, "permiso denegado: se requiere "+perm)
+	}
+	return context.WithValue(ctx, user_ctx_key{}, user), nil
+}
+
+func grpcUnaryAuth(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := grpcAuth(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func grpcStreamAuth(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := grpcAuth(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &grpcAuthStream{ServerStream: ss, ctx: ctx})
+}
+
+// grpcAuthStream is a server stream carrying the context set by grpcAuth.
+type grpcAuthStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *grpcAuthStream) Context() context.Context { return s.ctx }
+
+// grpcUser returns the user set by grpcAuth, or an empty user when auth is disabled.
+func grpcUser(ctx context.Context) User {
+	user, _ := ctx.Value(user_ctx_key{}).(User)
+	return user
+}
+
+// grpcRemote returns the address of the client of a call, for the audit log.
+func grpcRemote(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+func toPBSession(s SessionData) *pb.Session {
+	return &pb.Session{
+		Id: s.Id, Name: s.Name, CreateAt: s.CreateAt, EndAt: s.EndAt, StartedBy: s.StartedBy, StoppedBy: s.StoppedBy,
+		Coffee: s.Coffee, Roaster: s.Roaster, Tags: s.Tags, Score: s.Score, Notes: s.Notes,
+		GreenWeight: s.GreenWeight, RoastedWeight: s.RoastedWeight, Version: s.Version,
+	}
+}
+
+func toPBReading(t *TempType) *pb.Reading {
+	return &pb.Reading{Timestamp: t.TimeStamp, Temp: t.Temp, Unit: t.Unit, Channels: t.Channels, Ror: t.RoR}
+}
+
+func toPBMark(m Mark) *pb.Mark {
+	return &pb.Mark{Id: m.Id, SessionId: m.SessionId, MarkName: m.MarkName, CreateAt: m.CreatedAt, OnTemp: m.OnTemp, CreatedBy: m.CreatedBy, Channels: m.Channels, Ror: m.RoR}
+}
+
+// ListSessions returns a page of the stored sessions, filtered like the REST list.
+func (s *grpcServer) ListSessions(ctx context.Context, req *pb.ListSessionsRequest) (*pb.ListSessionsResponse, error) {
+	values := url.Values{"tag": req.Tags}
+	set := func(name string, v string) {
+		if v != "" {
+			values.Set(name, v)
+		}
+	}
+	set("q", req.Q)
+	set("coffee", req.Coffee)
+	set("roaster", req.Roaster)
+	set("user", req.User)
+	set("sort", req.Sort)
+	set("order", req.Order)
+	set("cursor", req.Cursor)
+	if req.From != 0 {
+		set("from", strconv.FormatInt(req.From, 10))
+	}
+	if req.To != 0 {
+		set("to", strconv.FormatInt(req.To, 10))
+	}
+	// gRPC clients are new, they always get pages.
+	limit := int(req.Limit)
+	if limit == 0 {
+		limit = session_page_default
+	}
+	set("limit", strconv.Itoa(limit))
+
+	query, err := ParseSessionQuery(values)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	page := session_data_provider.QuerySessions(query)
+
+	response := &pb.ListSessionsResponse{Total: int32(page.Total), NextCursor: page.NextCursor}
+	for _, stored := range page.Sessions {
+		response.Sessions = append(response.Sessions, toPBSession(stored))
+	}
+	return response, nil
+}
+
+// GetSession returns a session with its readings, in the range and downsampled as
+// asked, and its marks.
+func (s *grpcServer) GetSession(ctx context.Context, req *pb.GetSessionRequest) (*pb.GetSessionResponse, error) {
+	values := url.Values{}
+	if req.From != 0 {
+		values.Set("from", strconv.FormatInt(req.From, 10))
+	}
+	if req.To != 0 {
+		values.Set("to", strconv.FormatInt(req.To, 10))
+	}
+	if req.MaxPoints != 0 {
+		values.Set("max_points", strconv.Itoa(int(req.MaxPoints)))
+	}
+	if req.Downsample != "" {
+		values.Set("downsample", req.Downsample)
+	}
+	if len(req.Channels) > 0 {
+		values["channels"] = req.Channels
+	}
+	params, err := ParseMeasurementParams(values)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	stored, err := session_data_provider.GetSessionById(req.Id)
+	if err != nil || stored.DeletedAt != 0 {
+		return nil, status.Error(codes.NotFound, "session no encontrada: "+req.Id)
+	}
+
+	temps := session_data_provider.GetMeasurements(req.Id, params.Query)
+	response := &pb.GetSessionResponse{Session: toPBSession(stored), ReadingsTotal: int32(len(temps))}
+	for _, temp := range params.Apply(temps) {
+		response.Readings = append(response.Readings, toPBReading(temp))
+	}
+	for _, mark := range session_data_provider.GetMarksOfSessions(req.Id) {
+		response.Marks = append(response.Marks, toPBMark(mark))
+	}
+	return response, nil
+}
+
+// DeleteSession moves a session to the trash; the session being recorded cannot be deleted.
+func (s *grpcServer) DeleteSession(ctx context.Context, req *pb.DeleteSessionRequest) (*pb.DeleteSessionResponse, error) {
+	err := DeleteSession(req.Id, grpcUser(ctx).Actor(), grpcRemote(ctx))
+	switch {
+	case errors.Is(err, ErrSessionActive):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, ErrSessionNotFound):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &pb.DeleteSessionResponse{}, nil
+}
+
+// AddMark stores a mark at create_at, or marks the active session at the current
+// reading when create_at is 0.
+func (s *grpcServer) AddMark(ctx context.Context, req *pb.AddMarkRequest) (*pb.Mark, error) {
+	user := grpcUser(ctx)
+	if strings.TrimSpace(req.MarkName) == "" {
+		return nil, status.Error(codes.InvalidArgument, "se requiere mark_name")
+	}
+
+	var mark Mark
+	var err error
+	if req.CreateAt == 0 {
+		if req.SessionId != "" && !session.IsCurrent(req.SessionId) {
+			return nil, status.Error(codes.FailedPrecondition, "solo se puede marcar ahora la session en curso")
+		}
+		mark, err = MarkNow(req.MarkName, user.Actor())
+		if err != nil {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+	} else {
+		mark = Mark{SessionId: req.SessionId, MarkName: strings.TrimSpace(req.MarkName), CreatedAt: req.CreateAt, OnTemp: req.OnTemp, CreatedBy: user.Actor()}
+		if mark.SessionId == "" {
+			active, ok := session.Active()
+			if !ok {
+				return nil, status.Error(codes.FailedPrecondition, "no hay session de tostado iniciada")
+			}
+			mark.SessionId = active.Id
+		}
+		mark, err = session_data_provider.SetMark(mark)
+		if errors.Is(err, ErrSessionNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		send_data_to_clients(map[string]any{"type": "mark", "mark": mark})
+	}
+	AuditAs(user.Actor(), grpcRemote(ctx), "mark.create", mark.SessionId, mark)
+	return toPBMark(mark), nil
+}
+
+// StartSession starts recording a session.
+func (s *grpcServer) StartSession(ctx context.Context, req *pb.StartSessionRequest) (*pb.SessionState, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, status.Error(codes.InvalidArgument, "se requiere name")
+	}
+	started, err := StartSession(name, grpcUser(ctx).Actor(), grpcRemote(ctx))
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &pb.SessionState{Active: true, SessionId: started.Id, SessionName: started.Name}, nil
+}
+
+// StopSession stops the active session.
+func (s *grpcServer) StopSession(ctx context.Context, req *pb.StopSessionRequest) (*pb.SessionState, error) {
+	stopped, err := StopSession(grpcUser(ctx).Actor(), grpcRemote(ctx))
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &pb.SessionState{Active: false, SessionId: stopped.Id, SessionName: stopped.Name}, nil
+}
+
+// WatchReadings streams the live frames of the broadcast hub, filtered like the SSE
+// feed. With last_seq it first sends the frames missed since then.
+func (s *grpcServer) WatchReadings(req *pb.WatchReadingsRequest, stream pb.Tostadora_WatchReadingsServer) error {
+	filter := ParseLiveFilter(url.Values{"types": req.Types, "channels": req.Channels, "roaster": {req.Roaster}})
+	client := subscribeLive(filter, req.GetLastSeq(), req.LastSeq != nil)
+	defer unsubscribeLive(client)
+	log.Printf("cliente gRPC conectado desde: %s", grpcRemote(stream.Context()))
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			log.Printf("cliente gRPC desconectado de: %s", grpcRemote(stream.Context()))
+			return nil
+		case frame, ok := <-client.frames:
+			if !ok {
+				return status.Error(codes.Unavailable, "cliente demasiado lento, reconecte con last_seq")
+			}
+			if err := stream.Send(toPBLiveFrame(frame)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// toPBLiveFrame converts a broadcast JSON frame. Readings, marks and session changes
+// are typed; other frames keep their JSON.
+func toPBLiveFrame(frame LiveFrame) *pb.LiveFrame {
+	var head struct {
+		Type   string `json:"type"`
+		Mark   *Mark  `json:"mark"`
+		Active bool   `json:"active"`
+	}
+	json.Unmarshal(frame.Data, &head)
+	out := &pb.LiveFrame{Seq: frame.Seq, Type: head.Type}
+
+	switch {
+	case head.Type == "temp":
+		var temp TempType
+		if err := json.Unmarshal(frame.Data, &temp); err == nil {
+			out.Frame = &pb.LiveFrame_Reading{Reading: toPBReading(&temp)}
+			return out
+		}
+	case head.Mark != nil:
+		out.Frame = &pb.LiveFrame_Mark{Mark: toPBMark(*head.Mark)}
+		return out
+	case head.Type == "session":
+		var state struct {
+			SessionId   string `json:"session_id"`
+			SessionName string `json:"session_name"`
+		}
+		if err := json.Unmarshal(frame.Data, &state); err == nil {
+			out.Frame = &pb.LiveFrame_Session{Session: &pb.SessionState{Active: head.Active, SessionId: state.SessionId, SessionName: state.SessionName}}
+			return out
+		}
+	}
+	out.Frame = &pb.LiveFrame_Json{Json: string(frame.Data)}
+	return out
+}
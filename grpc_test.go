@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	pb "tostadora_server/tostadorapb"
+)
+
+func TestGRPCPermissions(t *testing.T) {
+	if err := checkGRPCPermissions(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A method added to the service without a permission stops the server.
+	delete(grpc_permissions, "WatchReadings")
+	t.Cleanup(func() { grpc_permissions["WatchReadings"] = PermView })
+	err := checkGRPCPermissions()
+	if err == nil || !strings.Contains(err.Error(), "WatchReadings") {
+		t.Errorf("err = %v, want the missing WatchReadings", err)
+	}
+}
+
+// useGRPC serves the gRPC API in memory for the duration of the test and returns a
+// client of it.
+func useGRPC(t *testing.T) pb.TostadoraClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := newGRPCServer()
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewTostadoraClient(conn)
+}
+
+// loginAs creates a user with role and returns a login token of it.
+func loginAs(t *testing.T, role string) string {
+	t.Helper()
+	user, err := user_data_provider.CreateUser("user-"+role, "", role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, token_hash, err := NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := user_data_provider.CreateLogin(token_hash, user.Id, time.Now().Add(time.Hour).UnixMilli()); err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// withToken returns a context sending token as the bearer of the calls.
+func withToken(token string) context.Context {
+	if token == "" {
+		return context.Background()
+	}
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func TestGRPCAuth(t *testing.T) {
+	useTestDatabase(t)
+	withAuth(t, true)
+	client := useGRPC(t)
+	tokens := map[string]string{
+		"none":     "",
+		"invalid":  "no-es-un-token",
+		"viewer":   loginAs(t, RoleViewer),
+		"operator": loginAs(t, RoleOperator),
+		"admin":    loginAs(t, RoleAdmin),
+	}
+
+	calls := map[string]func(ctx context.Context) error{
+		"ListSessions": func(ctx context.Context) error {
+			_, err := client.ListSessions(ctx, &pb.ListSessionsRequest{})
+			return err
+		},
+		"DeleteSession": func(ctx context.Context) error {
+			_, err := client.DeleteSession(ctx, &pb.DeleteSessionRequest{Id: "no-existe"})
+			return err
+		},
+		"WatchReadings": func(ctx context.Context) error {
+			stream, err := client.WatchReadings(ctx, &pb.WatchReadingsRequest{})
+			if err != nil {
+				return err
+			}
+			_, err = stream.Recv()
+			return err
+		},
+	}
+
+	tests := []struct {
+		method string
+		user   string
+		want   codes.Code
+	}{
+		{"ListSessions", "none", codes.Unauthenticated},
+		{"ListSessions", "invalid", codes.Unauthenticated},
+		{"ListSessions", "viewer", codes.OK},
+		{"WatchReadings", "none", codes.Unauthenticated},
+		{"WatchReadings", "viewer", codes.OK},
+		{"DeleteSession", "none", codes.Unauthenticated},
+		{"DeleteSession", "viewer", codes.PermissionDenied},
+		{"DeleteSession", "operator", codes.PermissionDenied},
+		// Past the interceptor: the session does not exist.
+		{"DeleteSession", "admin", codes.NotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.method+"/"+test.user, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(withToken(tokens[test.user]), 5*time.Second)
+			defer cancel()
+			if got := status.Code(calls[test.method](ctx)); got != test.want {
+				t.Errorf("code = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGRPCWatchReadingsResume(t *testing.T) {
+	useTestDatabase(t)
+	withAuth(t, true)
+	client := useGRPC(t)
+	token := loginAs(t, RoleViewer)
+
+	broadcast_mu.Lock()
+	history := broadcast_history
+	broadcast_history = NewBroadcastHistory(16)
+	for i := 1; i <= 5; i++ {
+		broadcast_history.Add([]byte(fmt.Sprintf(`{"type":"temp","timestamp":%d,"temp":%d}`, i, 100+i)))
+	}
+	broadcast_mu.Unlock()
+	t.Cleanup(func() {
+		broadcast_mu.Lock()
+		broadcast_history = history
+		broadcast_mu.Unlock()
+	})
+
+	tests := []struct {
+		name     string
+		last_seq *uint64
+		want     []uint64 // The seq of the frames received before the live one.
+	}{
+		{"missed frames", uint64Ptr(2), []uint64{3, 4, 5}},
+		{"up to date", uint64Ptr(5), nil},
+		// Without last_seq only the session state comes before the live frames.
+		{"without last_seq", nil, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(withToken(token), 5*time.Second)
+			defer cancel()
+			stream, err := client.WatchReadings(ctx, &pb.WatchReadingsRequest{LastSeq: test.last_seq})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Wait for the subscription, then broadcast a live frame after the missed ones.
+			for i := 0; i < 100 && liveClients() == 0; i++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+			send_data_to_clients(map[string]any{"type": "temp", "timestamp": 6, "temp": 106})
+
+			var got []uint64
+			for {
+				frame, err := stream.Recv()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if frame.Type == "temp" && frame.GetReading().GetTimestamp() == 6 {
+					break
+				}
+				if test.last_seq != nil {
+					if frame.GetReading() == nil {
+						t.Fatalf("frame %d = %v, want a reading", frame.Seq, frame)
+					}
+					got = append(got, frame.Seq)
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("replayed seqs = %v, want %v", got, test.want)
+			}
+			cancel()
+			for i := 0; i < 100 && liveClients() != 0; i++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+}
+
+// liveClients returns the number of subscribed live clients.
+func liveClients() int {
+	broadcast_mu.Lock()
+	defer broadcast_mu.Unlock()
+	return len(live_clients)
+}
+
+func uint64Ptr(v uint64) *uint64 { return &v }
+
+func TestGRPCSessionLifecycle(t *testing.T) {
+	useTestDatabase(t)
+	withAuth(t, true)
+	client := useGRPC(t)
+	ctx := withToken(loginAs(t, RoleAdmin))
+	t.Cleanup(func() { StopSession("test", "") })
+
+	// Concurrent starts: exactly one session is recorded.
+	results := make(chan error, 8)
+	for i := 0; i < cap(results); i++ {
+		go func() {
+			_, err := client.StartSession(ctx, &pb.StartSessionRequest{Name: fmt.Sprintf("Guji #%d", i)})
+			results <- err
+		}()
+	}
+	started := 0
+	for i := 0; i < cap(results); i++ {
+		if err := <-results; err == nil {
+			started++
+		} else if status.Code(err) != codes.FailedPrecondition {
+			t.Errorf("StartSession = %v, want FailedPrecondition", err)
+		}
+	}
+	if started != 1 {
+		t.Fatalf("%d sessions started, want 1", started)
+	}
+	active, ok := session.Active()
+	if !ok {
+		t.Fatal("no active session")
+	}
+
+	steps := []struct {
+		name string
+		call func() error
+		want codes.Code
+	}{
+		{"start without name", func() error {
+			_, err := client.StartSession(ctx, &pb.StartSessionRequest{Name: " "})
+			return err
+		}, codes.InvalidArgument},
+		{"delete the active session", func() error {
+			_, err := client.DeleteSession(ctx, &pb.DeleteSessionRequest{Id: active.Id})
+			return err
+		}, codes.FailedPrecondition},
+		{"stop", func() error {
+			stopped, err := client.StopSession(ctx, &pb.StopSessionRequest{})
+			if err == nil && (stopped.SessionId != active.Id || stopped.SessionName != active.Name) {
+				t.Errorf("stopped = %v, want %+v", stopped, active)
+			}
+			return err
+		}, codes.OK},
+		{"stop again", func() error {
+			_, err := client.StopSession(ctx, &pb.StopSessionRequest{})
+			return err
+		}, codes.FailedPrecondition},
+		{"delete", func() error {
+			_, err := client.DeleteSession(ctx, &pb.DeleteSessionRequest{Id: active.Id})
+			return err
+		}, codes.OK},
+		{"delete again", func() error {
+			_, err := client.DeleteSession(ctx, &pb.DeleteSessionRequest{Id: active.Id})
+			return err
+		}, codes.NotFound},
+	}
+	for _, step := range steps {
+		if got := status.Code(step.call()); got != step.want {
+			t.Errorf("%s: code = %v, want %v", step.name, got, step.want)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// live_queue_size is the frames waiting for a client before it is dropped as too slow.
+const live_queue_size = 1024
+
+// LiveFilter selects the live frames sent to an SSE or gRPC client.
+type LiveFilter struct {
+	Types    []string // Frame types (temp, mark, session, alarm...); empty for every type.
+	Channels []string // Channels kept in temp frames and alarms; empty for every channel.
+	Roaster  string   // Only frames of sessions on this roaster (case insensitive).
+}
+
+// ParseLiveFilter reads types, channels (comma separated) and roaster from a query string.
+func ParseLiveFilter(values url.Values) LiveFilter {
+	list := func(name string) []string {
+		var items []string
+		for _, item := range strings.Split(strings.Join(values[name], ","), ",") {
+			if item = strings.ToLower(strings.TrimSpace(item)); item != "" && !slices.Contains(items, item) {
+				items = append(items, item)
+			}
+		}
+		return items
+	}
+	return LiveFilter{Types: list("types"), Channels: list("channels"), Roaster: strings.TrimSpace(values.Get("roaster"))}
+}
+
+// IsEmpty reports whether the filter lets every frame through.
+func (f LiveFilter) IsEmpty() bool {
+	return len(f.Types) == 0 && len(f.Channels) == 0 && f.Roaster == ""
+}
+
+// Apply returns the frame as seen by the filter, or nil when it is filtered out.
+// frame is the decoded data. Must be called with broadcast_mu held.
+func (f LiveFilter) Apply(data []byte, frame map[string]any) []byte {
+	if f.IsEmpty() {
+		return data
+	}
+	kind, _ := frame["type"].(string)
+	if len(f.Types) > 0 && !slices.Contains(f.Types, kind) {
+		return nil
+	}
+	if f.Roaster != "" && !strings.EqualFold(frameRoaster(frame), f.Roaster) {
+		return nil
+	}
+	if len(f.Channels) == 0 {
+		return data
+	}
+
+	switch kind {
+	case "temp":
+		channels, ok := frame["channels"].(map[string]any)
+		if !ok {
+			return data
+		}
+		kept := map[string]any{}
+		for _, channel := range f.Channels {
+			if v, ok := channels[channel]; ok {
+				kept[channel] = v
+			}
+		}
+		filtered := make(map[string]any, len(frame))
+		for k, v := range frame {
+			filtered[k] = v
+		}
+		filtered["channels"] = kept
+		b, err := json.Marshal(filtered)
+		if err != nil {
+			log.Println("error json en live,", err)
+			return nil
+		}
+		return b
+	case "alarm", "alarm_cleared":
+		channel, _ := frame["channel"].(string)
+		if incident, ok := frame["incident"].(map[string]any); ok {
+			channel, _ = incident["channel"].(string)
+		}
+		if channel != "" && !slices.Contains(f.Channels, channel) {
+			return nil
+		}
+	}
+	return data
+}
+
+// frameSessionId returns the session a live frame belongs to: the one it names, or
+// else the active session.
+func frameSessionId(frame map[string]any) string {
+	if id, ok := frame["session_id"].(string); ok && id != "" {
+		return id
+	}
+	for _, key := range []string{"mark", "incident"} {
+		if nested, ok := frame[key].(map[string]any); ok {
+			if id, ok := nested["session_id"].(string); ok && id != "" {
+				return id
+			}
+		}
+	}
+	if nested, ok := frame["session"].(map[string]any); ok {
+		if id, ok := nested["id"].(string); ok && id != "" {
+			return id
+		}
+	}
+	if active, ok := session.Active(); ok {
+		return active.Id
+	}
+	return ""
+}
+
+// LiveRoaster is the roaster of the active session, for the roaster filter. It is
+// resolved when the session starts and kept up to date by its edits, so filtering a
+// frame never touches the database.
+type LiveRoaster struct {
+	mu         sync.Mutex
+	session_id string
+	roaster    string
+}
+
+var live_roaster = &LiveRoaster{}
+
+// Resolve reads the roaster of a session that just started. Must not be called with broadcast_mu held.
+func (r *LiveRoaster) Resolve(session_id string) {
+	data, err := session_data_provider.GetSessionById(session_id)
+	if err != nil {
+		log.Println("live: roaster de la session,", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.session_id, r.roaster = session_id, data.Roaster
+}
+
+// Update keeps the roaster of an edited session, when it is the one kept.
+func (r *LiveRoaster) Update(data SessionData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.session_id == data.Id {
+		r.roaster = data.Roaster
+	}
+}
+
+// Of returns the roaster of a session, and false when it is not the last active one.
+func (r *LiveRoaster) Of(session_id string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.roaster, session_id != "" && session_id == r.session_id
+}
+
+// frameRoaster returns the roaster of the session a live frame belongs to. Edits carry
+// it; frames of sessions other than the last active one have none.
+func frameRoaster(frame map[string]any) string {
+	if nested, ok := frame["session"].(map[string]any); ok {
+		if roaster, ok := nested["roaster"].(string); ok {
+			return roaster
+		}
+	}
+	if roaster, ok := live_roaster.Of(frameSessionId(frame)); ok {
+		return roaster
+	}
+	return ""
+}
+
+// LiveFrame is a live frame queued for a client.
+type LiveFrame struct {
+	Seq  uint64 // Its broadcast seq, sent as the event id; 0 for frames not broadcast.
+	Data []byte
+}
+
+// LiveClient is a connected SSE or gRPC client.
+type LiveClient struct {
+	filter LiveFilter
+	frames chan LiveFrame // Closed when the client falls behind.
+}
+
+// live_clients is guarded by broadcast_mu.
+var live_clients = map[*LiveClient]struct{}{}
+
+// liveBroadcast queues a broadcast frame for every live client. Clients too slow to
+// keep up are dropped; they reconnect with the last seq they got. Must be called with broadcast_mu held.
+func liveBroadcast(seq uint64, data []byte) {
+	if len(live_clients) == 0 {
+		return
+	}
+	var frame map[string]any
+	if err := json.Unmarshal(data, &frame); err != nil {
+		log.Println("error json en live,", err)
+		return
+	}
+	for client := range live_clients {
+		filtered := client.filter.Apply(data, frame)
+		if filtered == nil {
+			continue
+		}
+		select {
+		case client.frames <- LiveFrame{Seq: seq, Data: filtered}:
+		default:
+			log.Println("live: cliente demasiado lento, se desconecta")
+			delete(live_clients, client)
+			close(client.frames)
+		}
+	}
+}
+
+// subscribeLive registers a live client. With resume it first queues the kept frames
+// broadcast after last, or a resync frame when some are no longer kept; otherwise a
+// session frame with the current state.
+func subscribeLive(filter LiveFilter, last uint64, resume bool) *LiveClient {
+	broadcast_mu.Lock()
+	defer broadcast_mu.Unlock()
+
+	var queued []LiveFrame
+	add := func(seq uint64, data []byte) {
+		var frame map[string]any
+		if err := json.Unmarshal(data, &frame); err != nil {
+			log.Println("error json en live,", err)
+			return
+		}
+		if filtered := filter.Apply(data, frame); filtered != nil {
+			queued = append(queued, LiveFrame{Seq: seq, Data: filtered})
+		}
+	}
+
+	seq := broadcast_history.Seq()
+	if resume {
+		frames, ok := broadcast_history.Since(last)
+		if ok && last <= seq {
+			for i, data := range frames {
+				add(last+uint64(i)+1, data)
+			}
+		} else {
+			// The resync frame goes through unfiltered: the client must reload anyway.
+			data, _ := json.Marshal(map[string]any{"type": "resync", "seq": seq, "msg": "faltan frames que ya no se guardan, recargue la session"})
+			queued = append(queued, LiveFrame{Data: data})
+		}
+	} else {
+		active, ok := session.Active()
+		data, _ := json.Marshal(sessionFrame(active.Id, active.Name, ok))
+		add(0, data)
+	}
+
+	client := &LiveClient{filter: filter, frames: make(chan LiveFrame, len(queued)+live_queue_size)}
+	for _, frame := range queued {
+		client.frames <- frame
+	}
+	live_clients[client] = struct{}{}
+	return client
+}
+
+// unsubscribeLive removes a live client.
+func unsubscribeLive(client *LiveClient) {
+	broadcast_mu.Lock()
+	defer broadcast_mu.Unlock()
+	if _, ok := live_clients[client]; ok {
+		delete(live_clients, client)
+		close(client.frames)
+	}
+}
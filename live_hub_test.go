@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+)
+
+func TestLiveFilterApply(t *testing.T) {
+	previous := live_roaster
+	live_roaster = &LiveRoaster{session_id: "s1", roaster: "Diedrich IR-2.5"}
+	t.Cleanup(func() { live_roaster = previous })
+
+	tests := []struct {
+		name  string
+		query string
+		frame string
+		want  string // "" when the frame is filtered out.
+	}{
+		{"no filter", "", `{"type":"temp","temp":100}`, `{"type":"temp","temp":100}`},
+		{"type kept", "types=mark,temp", `{"type":"temp","temp":100}`, `{"type":"temp","temp":100}`},
+		{"type dropped", "types=mark", `{"type":"temp","temp":100}`, ""},
+		{"channels", "channels=et", `{"type":"temp","channels":{"bt":100,"et":200}}`, `{"channels":{"et":200},"type":"temp"}`},
+		{"alarm other channel", "channels=et", `{"type":"alarm_cleared","channel":"bt"}`, ""},
+		{"roaster of the active session", "roaster=diedrich ir-2.5", `{"type":"mark","mark":{"session_id":"s1"}}`, `{"type":"mark","mark":{"session_id":"s1"}}`},
+		{"other roaster", "roaster=probat", `{"type":"session","session_id":"s1"}`, ""},
+		{"session not kept", "roaster=diedrich ir-2.5", `{"type":"mark","mark":{"session_id":"s2"}}`, ""},
+		{"edit carries the roaster", "roaster=probat", `{"type":"session_updated","session":{"id":"s2","roaster":"Probat"}}`, `{"type":"session_updated","session":{"id":"s2","roaster":"Probat"}}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values, err := url.ParseQuery(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var frame map[string]any
+			if err := json.Unmarshal([]byte(test.frame), &frame); err != nil {
+				t.Fatal(err)
+			}
+			if got := string(ParseLiveFilter(values).Apply([]byte(test.frame), frame)); got != test.want {
+				t.Errorf("Apply = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLiveRoasterUpdate(t *testing.T) {
+	r := &LiveRoaster{session_id: "s1", roaster: "probat"}
+	r.Update(SessionData{Id: "s2", Roaster: "giesen"})
+	r.Update(SessionData{Id: "s1", Roaster: "diedrich"})
+	if roaster, ok := r.Of("s1"); !ok || roaster != "diedrich" {
+		t.Errorf("Of(s1) = %q, %v; want diedrich, true", roaster, ok)
+	}
+	if _, ok := r.Of("s2"); ok {
+		t.Error("Of(s2) found a session that is not kept")
+	}
+}
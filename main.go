@@ -3,30 +3,40 @@ package main
 import (
 	"container/list"
 	"encoding/json"
+	"errors"
 	"flag"
 	"io"
 	"log"
-	"math"
-	"math/rand/v2"
 	"net/http"
-	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/Davidc2525/go_try/try"
 	"github.com/gorilla/websocket"
-	ws_client "golang.org/x/net/websocket"
 )
 
 // Global variables
-var clients = make(map[*websocket.Conn]bool)                        // A map of connected WebSocket clients.
-var mu sync.RWMutex                                                 // A mutex to protect access to the clients map.
-var current_data = TempType{Type: "temp"}                           // The current temperature data.
-var db_temp = list.New()                                            // A list to store temperature data (deprecated).
-var session = NewSession()                                          // The current roasting session.
-var session_data_provider = NewSessionDataProvider(NewConnection()) // The data provider for session data.
+var clients = make(map[*websocket.Conn]*WSClient)                      // The connected WebSocket clients.
+var mu sync.RWMutex                                                    // A mutex to protect access to the clients map.
+var current_data = TempType{Type: "temp"}                              // The current temperature data.
+var current_mu sync.RWMutex                                            // A mutex to protect access to current_data.
+var db_temp = list.New()                                               // A list to store temperature data (deprecated).
+var session = NewSession()                                             // The current roasting session.
+var session_data_provider = NewSessionDataProvider(NewConnection())    // The data provider for session data.
+var user_data_provider = NewUserDataProvider(session_data_provider.Db) // The data provider for users and logins.
+var pipeline = NewPipeline()                                           // The ingestion pipeline fed by the sensor sources.
+var controller = NewController(nil, DefaultControlLimits())            // The control outputs (heat/fan) of the roaster.
+var follower = NewProfileFollower()                                    // The PID controller following a target curve.
+
+// currentData returns the last published sample.
+func currentData() TempType {
+	current_mu.RLock()
+	defer current_mu.RUnlock()
+	return current_data
+}
 
 // TempType represents the structure of the temperature data sent over WebSocket.
 type TempType struct {
@@ -34,22 +44,25 @@ type TempType struct {
 	Temp      float64 `json:"temp"` // The temperature value.
 	TimeStamp int64   `json:"timestamp"`
 	Unit      string  `json:"unit,omitempty"` // The unit of the temperature (e.g., "C").
+	// Channels holds the named readings of multi-channel sources (e.g., "bt", "et").
+	Channels map[string]float64 `json:"channels,omitempty"`
+	// RoR is the rate of rise in degrees per minute, set on the live frames.
+	RoR *float64 `json:"ror,omitempty"`
 }
 
 // upgrader is used to upgrade HTTP connections to WebSocket connections.
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all connections
-	},
+	CheckOrigin:     checkOrigin,
 }
 
 // enabeCORS enables Cross-Origin Resource Sharing (CORS) for the given response writer.
 func enabeCORS(w http.ResponseWriter) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-type")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-type, Authorization, If-Match")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
 }
 
 // roastDeleteSessionByIdHandler handles the deletion of a roasting session by its ID.
@@ -57,16 +70,28 @@ func roastDeleteSessionByIdHandler(w http.ResponseWriter, r *http.Request) {
 	enabeCORS(w)
 	session_id := r.PathValue("id")
 
+	var delete_err error
 	response := try.TryArgs[string, map[string]any](
 		session_id,
 		func(session_id string) (map[string]any, error) {
-			session_data_provider.DeleteSession(session_id)
-			return map[string]interface{}{"status": true, "msg": "session eliminada"}, nil
+			if delete_err = DeleteSession(session_id, currentUser(r).Actor(), r.RemoteAddr); delete_err != nil {
+				return nil, delete_err
+			}
+			return map[string]interface{}{"status": true, "msg": "session movida a la papelera"}, nil
 		},
 		func(e error, session_id string) map[string]any {
 			return map[string]interface{}{"status": false, "msg": "error al eliminar session:" + session_id}
 		},
 	)
+	// The session being recorded cannot be deleted.
+	switch {
+	case errors.Is(delete_err, ErrSessionActive):
+		writeJSONError(w, http.StatusConflict, delete_err.Error())
+		return
+	case errors.Is(delete_err, ErrSessionNotFound):
+		writeJSONError(w, http.StatusNotFound, "session no encontrada: "+session_id)
+		return
+	}
 
 	//response := map[string]interface{}{"status": true, "msg": "session eliminada"}
 
@@ -79,13 +104,15 @@ func roastDeleteSessionByIdHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(json_reponse)
 }
 
-// roastSessionSetMark handles the setting of a mark for a roasting session.
+// roastSessionSetMark handles the setting of a mark for a roasting session and returns
+// the stored mark.
 func roastSessionSetMark(w http.ResponseWriter, r *http.Request) {
 	enabeCORS(w)
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "error reading request body", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "error reading request body")
+		return
 	}
 	defer r.Body.Close()
 
@@ -93,12 +120,31 @@ func roastSessionSetMark(w http.ResponseWriter, r *http.Request) {
 
 	err = json.Unmarshal(body, &data)
 	if err != nil {
-		http.Error(w, "error Unmarshal body", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusBadRequest, "error Unmarshal body")
+		return
+	}
+
+	data.MarkName = strings.TrimSpace(data.MarkName)
+	if data.MarkName == "" {
+		writeJSONError(w, http.StatusBadRequest, "se requiere mark_name")
+		return
 	}
 
+	data.CreatedBy = currentUser(r).Actor()
 	log.Println("data mark: ", data)
-	session_data_provider.SetMark(data)
+	mark, err := session_data_provider.SetMark(data)
+	if errors.Is(err, ErrSessionNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	Audit(r, "mark.create", mark.SessionId, mark)
+	send_data_to_clients(map[string]any{"type": "mark", "mark": mark})
 
+	json.NewEncoder(w).Encode(map[string]any{"status": true, "mark": mark})
 }
 
 // roastSessionDataByIdHandler handles the retrieval of data for a roasting session by its ID.
@@ -109,10 +155,43 @@ func roastSessionDataByIdHandler(w http.ResponseWriter, r *http.Request) {
 
 	session_id := r.PathValue("id")
 
-	temps := session_data_provider.GetAllBySessionId(session_id)
+	params, err := ParseMeasurementParams(r.URL.Query())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Sessions in the trash are only served to those who can restore them, on request.
+	stored, err := session_data_provider.GetSessionById(session_id)
+	trash := r.URL.Query().Get("trash") == "true" && HasPermission(currentUser(r), PermDelete)
+	if err != nil || (stored.DeletedAt != 0 && !trash) {
+		writeJSONError(w, http.StatusNotFound, "session no encontrada: "+session_id)
+		return
+	}
+	data["session"] = stored
+	w.Header().Set("ETag", sessionETag(stored))
+
+	if params.Relative() {
+		if charge, ok := chargeTimestamp(session_id); ok {
+			params.Resolve(charge)
+			data["charge_at"] = charge
+		}
+	}
+
+	temps := session_data_provider.GetMeasurements(session_id, params.Query)
 	marks := session_data_provider.GetMarksOfSessions(session_id)
-	data["temps"] = temps
+	data["temps_total"] = len(temps)
+	data["temps"] = params.Apply(temps)
 	data["marks"] = marks
+	data["controls"] = session_data_provider.GetControlsOfSession(session_id)
+	pid_log := []PIDLog{}
+	for _, entry := range session_data_provider.GetPIDLogOfSession(session_id) {
+		if (params.Query.From == 0 || entry.TimeStamp >= params.Query.From) && (params.Query.To == 0 || entry.TimeStamp <= params.Query.To) {
+			pid_log = append(pid_log, entry)
+		}
+	}
+	data["pid"] = pid_log
+	data["incidents"] = session_data_provider.GetIncidents(session_id, -1)
 
 	d, err := json.Marshal(data)
 
@@ -130,7 +209,15 @@ func roastSessionsHandler(w http.ResponseWriter, r *http.Request) {
 
 	data := map[string]interface{}{}
 
-	data["sessions"] = session_data_provider.GetSessions()
+	query, err := ParseSessionQuery(r.URL.Query())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	page := session_data_provider.QuerySessions(query)
+	data["sessions"] = page.Sessions
+	data["total"] = page.Total
+	data["next_cursor"] = page.NextCursor
 
 	d, err := json.Marshal(data)
 
@@ -144,6 +231,9 @@ func roastSessionsHandler(w http.ResponseWriter, r *http.Request) {
 
 // wsHandler handles WebSocket connections.
 func wsHandler(w http.ResponseWriter, r *http.Request) {
+	// The user was authenticated by requireAuth before the upgrade.
+	user := currentUser(r)
+
 	// Upgrade the HTTP connection to a WebSocket connection.
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -152,8 +242,9 @@ func wsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Add the new connection to the map of clients.
+	client := NewWSClient(conn)
 	mu.Lock()
-	clients[conn] = true
+	clients[conn] = client
 	mu.Unlock()
 
 	log.Printf("Cliente conectado desde: %s. Clientes activos: %d", conn.RemoteAddr(), len(clients))
@@ -163,7 +254,7 @@ func wsHandler(w http.ResponseWriter, r *http.Request) {
 		mu.Lock()
 		delete(clients, conn)
 		mu.Unlock()
-		conn.Close()
+		client.Close()
 		log.Printf("Cliente desconectado de: %s. Clientes activos: %d", conn.RemoteAddr(), len(clients))
 	}()
 
@@ -188,28 +279,40 @@ func wsHandler(w http.ResponseWriter, r *http.Request) {
 		cmd, exists = result["cmd"].(string)
 
 		if exists {
+			if perm, ok := ws_permissions[cmd]; ok && !HasPermission(user, perm) {
+				log.Printf("comando %s denegado a %s (%s)", cmd, user.Actor(), user.Role)
+
+				data_respose := map[string]interface{}{"type": "error", "cmd": cmd, "code": http.StatusForbidden, "error": true, "msg": "permiso denegado: se requiere " + perm}
+				jsonData_response, err := json.Marshal(data_respose)
+				if err == nil {
+					err := writeMessage(conn, jsonData_response)
+					if err != nil {
+						log.Printf("Error al enviar a %s: %v", conn.RemoteAddr(), err)
+					}
+				}
+				continue
+			}
+
 			switch cmd {
 			case "start":
 				log.Println("iniciar session de tostado")
-				session.Start(result["session_name"].(string))
-
 				data_respose := map[string]interface{}{"type": "start_response", "msg": "session iniciada"}
 
-				err := session_data_provider.StartNewSession(session.GetId(), session.GetName())
-
+				session_name, _ := result["session_name"].(string)
+				started, err := StartSession(session_name, user.Actor(), r.RemoteAddr)
 				if err != nil {
 					data_respose["error"] = true
 					data_respose["msg"] = err.Error()
 
 				} else {
-					data_respose["session_id"] = session.GetId()
-					data_respose["session_name"] = session.GetName()
+					data_respose["session_id"] = started.Id
+					data_respose["session_name"] = started.Name
 				}
 
 				jsonData_response, err := json.Marshal(data_respose)
 				if err == nil {
 
-					err := conn.WriteMessage(websocket.TextMessage, []byte(string(jsonData_response)))
+					err := writeMessage(conn, []byte(string(jsonData_response)))
 					if err != nil {
 						log.Printf("Error al enviar a %s: %v", conn.RemoteAddr(), err)
 					}
@@ -217,38 +320,152 @@ func wsHandler(w http.ResponseWriter, r *http.Request) {
 
 			case "stop":
 				log.Println("detener session de tostado")
+				if _, err := StopSession(user.Actor(), r.RemoteAddr); err != nil {
+					log.Println(err)
+				}
+
+			case "mark":
+				mark_name, _ := result["mark_name"].(string)
+				log.Println("marca en vivo:", mark_name)
 
-				session_data_provider.StopSession(session.GetId())
-				session.Stop()
+				data_respose := map[string]interface{}{"type": "mark_response", "error": false}
+
+				mark, err := MarkNow(mark_name, user.Actor())
+				if err != nil {
+					data_respose["error"] = true
+					data_respose["msg"] = err.Error()
+				} else {
+					data_respose["mark"] = mark
+					Audit(r, "mark.create", mark.SessionId, mark)
+				}
+
+				jsonData_response, err := json.Marshal(data_respose)
+				if err == nil {
+					err := writeMessage(conn, jsonData_response)
+					if err != nil {
+						log.Printf("Error al enviar a %s: %v", conn.RemoteAddr(), err)
+					}
+				}
+
+			case "control":
+				log.Println("comando de control")
+
+				state := controller.State()
+				heat, fan := state.Heat, state.Fan
+				if v, ok := result["heat"].(float64); ok {
+					heat = v
+				}
+				if v, ok := result["fan"].(float64); ok {
+					fan = v
+				}
+
+				data_respose := map[string]interface{}{"type": "control_response", "error": false}
+
+				// A manual command overrides the profile follower until it is set back to auto.
+				if follower.IsActive() {
+					follower.SetManual(true)
+				}
+
+				state, err := controller.Set(heat, fan, "ui")
+				Audit(r, "control.set", "", map[string]any{"heat": heat, "fan": fan, "applied": state, "error": err != nil})
+				if err != nil {
+					data_respose["error"] = true
+					data_respose["msg"] = err.Error()
+				}
+				data_respose["control"] = state
+				data_respose["limits"] = controller.Limits()
+
+				jsonData_response, err := json.Marshal(data_respose)
+				if err == nil {
+					err := writeMessage(conn, jsonData_response)
+					if err != nil {
+						log.Printf("Error al enviar a %s: %v", conn.RemoteAddr(), err)
+					}
+				}
+
+			case "pid":
+				action, _ := result["action"].(string)
+				log.Println("comando pid:", action)
+
+				data_respose := map[string]interface{}{"type": "pid_response", "error": false}
+
+				switch action {
+				case "start":
+					config := DefaultPIDConfig()
+					if err := remarshal(result["config"], &config); err != nil {
+						data_respose["error"] = true
+						data_respose["msg"] = "config invalida"
+					} else if err := follower.Start(config); err != nil {
+						data_respose["error"] = true
+						data_respose["msg"] = err.Error()
+					}
+				case "stop":
+					follower.Stop()
+				case "manual":
+					follower.SetManual(true)
+				case "auto":
+					follower.SetManual(false)
+				default:
+					data_respose["error"] = true
+					data_respose["msg"] = "accion pid desconocida: " + action
+				}
+				data_respose["pid"] = follower.Status()
+				if data_respose["error"] == false {
+					Audit(r, "pid."+action, "", result["config"])
+				}
+
+				jsonData_response, err := json.Marshal(data_respose)
+				if err == nil {
+					err := writeMessage(conn, jsonData_response)
+					if err != nil {
+						log.Printf("Error al enviar a %s: %v", conn.RemoteAddr(), err)
+					}
+				}
+
+			case "sync":
+				since, _ := result["since"].(float64)
+				mark_id, _ := result["mark_id"].(float64)
+				chunk, _ := result["chunk"].(float64)
+				log.Println("sincronizar session desde", int64(since))
+				syncClient(conn, int64(since), int64(mark_id), int(chunk))
+
+			case "resume":
+				seq, _ := result["seq"].(float64)
+				log.Println("reanudar broadcasts desde", uint64(seq))
+				resumeClient(client, uint64(seq))
 
 			case "get":
 				log.Println("obtener info de la sesion acutal si la hay")
 
-				if session.IsActive() {
+				if active, ok := session.Active(); ok {
 					log.Println("si hay session")
 
-					d := session_data_provider.GetAllBySessionId(session.GetId())
-					marks := session_data_provider.GetMarksOfSessions(session.GetId())
+					d := session_data_provider.GetAllBySessionId(active.Id)
+					marks := session_data_provider.GetMarksOfSessions(active.Id)
 
 					data_respose := map[string]interface{}{
 						"type":               "get_response",
 						"msg":                "datos de la session",
 						"error":              false,
 						"has_session":        true,
-						"session_name":       session.GetName(),
-						"session_id":         session.GetId(),
-						"session_created_at": session.GetCreatedAt(),
+						"session_name":       active.Name,
+						"session_id":         active.Id,
+						"session_created_at": active.CreateAt,
+						"seq":                currentSeq(),
 					}
 
 					data_respose["temps"] = d
 					data_respose["marks"] = marks
+					data_respose["controls"] = session_data_provider.GetControlsOfSession(active.Id)
+					data_respose["control"] = controller.State()
+					data_respose["pid"] = session_data_provider.GetPIDLogOfSession(active.Id)
 					//log.Println("enviando datos de temperatura: ", data_respose)
 
 					jsonData_response, err := json.Marshal(data_respose)
 
 					if err == nil {
 
-						err := conn.WriteMessage(websocket.TextMessage, []byte(string(jsonData_response)))
+						err := writeMessage(conn, []byte(string(jsonData_response)))
 
 						if err != nil {
 							log.Printf("Error al enviar a %s: %v", conn.RemoteAddr(), err)
@@ -267,7 +484,7 @@ func wsHandler(w http.ResponseWriter, r *http.Request) {
 					jsonData_response, err := json.Marshal(data_respose)
 					if err == nil {
 
-						err := conn.WriteMessage(websocket.TextMessage, []byte(string(jsonData_response)))
+						err := writeMessage(conn, []byte(string(jsonData_response)))
 						if err != nil {
 							log.Printf("Error al enviar a %s: %v", conn.RemoteAddr(), err)
 						}
@@ -294,100 +511,139 @@ func main() {
 
 	// Prepare the database.
 	session_data_provider.Prepare()
+	user_data_provider.Prepare()
 
 	// Parse command-line flags.
 	simule_data := flag.String("s", "false", "si no hay sensor disponible, simular datos de temperatura.")
 	host := flag.String("host", "192.168.100.9:81", "Host en el que el servidor escuchará.")
+	modbus_config := flag.String("modbus", "", "archivo JSON con la configuracion y el mapa de registros modbus.")
+	modbus_sim := flag.String("modbus-sim", "", "direccion (ej. :5020) en la que iniciar un simulador modbus TCP.")
+	sim_config := flag.String("sim-config", "", "archivo JSON con los parametros del simulador de tostado (-s o -sources sim).")
+	replay := flag.String("replay", "", "id de una session guardada a reproducir como sensor en vivo.")
+	replay_speed := flag.Float64("replay-speed", 1, "velocidad de reproduccion del replay (1 = velocidad original).")
+	replay_record := flag.Bool("replay-record", false, "grabar el replay en una nueva session.")
+	control_name := flag.String("control", "", "source usada como actuador de calor/ventilador (esp32, sim, modbus o none). Por defecto la primera que lo soporte.")
+	heat_max := flag.Float64("heat-max", DefaultControlLimits().HeatMax, "limite de seguridad: calor maximo en porcentaje.")
+	fan_min := flag.Float64("fan-min", DefaultControlLimits().FanMinWithHeat, "limite de seguridad: ventilador minimo en porcentaje con el calor encendido.")
+	max_bt := flag.Float64("max-bt", DefaultControlLimits().MaxBT, "limite de seguridad: temperatura del grano a la que se apaga el calor.")
+	watchdog_config := flag.String("watchdog", "", "archivo JSON con los umbrales del watchdog de seguridad.")
+	insecure := flag.Bool("insecure", false, "no exigir login en las APIs REST, WebSocket y gRPC ni aplicar los roles: cualquiera en la red puede controlar el tostador.")
+	admin_user := flag.String("admin-user", "admin", "administrador creado al arrancar si no hay usuarios, con el password de la variable "+admin_password_env+" o uno aleatorio escrito en el log.")
+	origins := flag.String("allowed-origins", "", "origenes extra (separados por coma) que pueden abrir el websocket, ej. http://tablet.local:3000.")
+	trash_days := flag.Float64("trash-days", 30, "dias que las sessions eliminadas quedan en la papelera antes de purgarse.")
+	source_names := flag.String("sources", "", "sources de temperatura separadas por coma ("+strings.Join(SourceNames(), ", ")+"). Por defecto se deducen de -s, -host y -modbus.")
+	grpc_addr := flag.String("grpc", "", "direccion en la que servir la API gRPC, ej. :9090 (vacia para desactivarla).")
+	grpc_cert := flag.String("grpc-cert", "", "certificado TLS (PEM) de la API gRPC.")
+	grpc_key := flag.String("grpc-key", "", "clave privada TLS (PEM) de la API gRPC.")
 	flag.Parse()
-	var ws *ws_client.Conn
-	// Connect to the WebSocket server (ESP32).
-	u := url.URL{Scheme: "ws", Host: *host, Path: "/"}
-	log.Printf("connecting to %s", u.String())
-	done := make(chan struct{})
-
-	if *simule_data == "false" {
-		ws, err := ws_client.Dial(u.String(), "", "http://localhost/")
-		if err != nil {
-			log.Println("dial:", err)
-			return
-		}
-		defer ws.Close()
 
-		// Goroutine to receive temperature data from the ESP32.
-		go func() {
-			defer close(done)
-			for {
-				var msg string
-				err := ws_client.Message.Receive(ws, &msg)
+	auth_enabled = !*insecure
+	if !auth_enabled {
+		log.Println("ATENCION: -insecure, login y roles desactivados: cualquiera en la red puede controlar el tostador y borrar sessions")
+	}
+	BootstrapAdmin(*admin_user)
+	if *origins != "" {
+		allowed_origins = strings.Split(*origins, ",")
+	}
 
-				var temp TempType
-				err = json.Unmarshal([]byte(msg), &temp)
-				temp.TimeStamp = time.Now().UnixMilli()
+	trash_retention = time.Duration(*trash_days * float64(24*time.Hour))
+	go RunTrashRetention()
 
-				current_data.TimeStamp = temp.TimeStamp
-				current_data.Temp = temp.Temp
+	options := SourceOptions{Host: *host}
 
-				go send_data_to_clients()
+	if *modbus_config != "" {
+		config, err := LoadModbusConfig(*modbus_config)
+		if err != nil {
+			log.Println("modbus:", err)
+			return
+		}
+		options.Modbus = config
+	}
 
-				if session.IsActive() {
-					go session_data_provider.InsertTempValToSession(session.GetId(), temp)
-				}
+	if *sim_config != "" {
+		config, err := LoadSimConfig(*sim_config)
+		if err != nil {
+			log.Println("simulador:", err)
+			return
+		}
+		options.Sim = config
+	}
 
-				if err != nil {
-					log.Println("read:", err)
-					return
-				}
-				log.Printf("received: %s", msg)
+	if *replay != "" {
+		options.Replay = &ReplayOptions{SessionId: *replay, Speed: *replay_speed, Record: *replay_record}
+	}
+
+	if *modbus_sim != "" {
+		if options.Modbus == nil {
+			options.Modbus = DefaultModbusSimConfig(*modbus_sim)
+		}
+		simulator := NewModbusSimulator(options.Modbus)
+		defer simulator.Close()
+		go func() {
+			if err := simulator.ListenAndServe(*modbus_sim); err != nil {
+				log.Println("simulador modbus:", err)
 			}
 		}()
-	} else {
-		//datos simulado
-		go func() {
-			x := 0.0
-			for {
-				x = x + 0.1
-				var temp TempType
-				temp.Temp = ((100 * math.Cos(x)) + 30.0) + (rand.Float64() * 10)
-				temp.TimeStamp = time.Now().UnixMilli()
-
-				current_data.Temp = temp.Temp
-				current_data.TimeStamp = temp.TimeStamp
-
-				go send_data_to_clients()
-				if session.IsActive() {
-					go session_data_provider.InsertTempValToSession(session.GetId(), temp)
-				}
+	}
 
-				log.Printf("received rand: %.2f", temp.Temp)
+	// Without -sources keep the behaviour of the legacy flags.
+	var names []string
+	if *source_names != "" {
+		names = strings.Split(*source_names, ",")
+	} else {
+		if options.Replay != nil {
+			names = append(names, "replay")
+		} else if *simule_data != "false" {
+			names = append(names, "sim")
+		} else if *host != "" {
+			names = append(names, "esp32")
+		}
+		if options.Modbus != nil {
+			names = append(names, "modbus")
+		}
+	}
 
-				time.Sleep(1 * time.Second)
-			}
-		}()
+	var driver ControlDriver
+	for _, name := range names {
+		source, err := NewSource(strings.TrimSpace(name), options)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		if d, ok := source.(ControlDriver); ok && driver == nil && d.CanControl() && (*control_name == "" || *control_name == d.Name()) {
+			driver = d
+		}
+		pipeline.Start(source)
 	}
 
-	// Goroutine to send temperature data to the web clients.
-	go func() {
-		return
-		for {
-			select {
-			case <-time.After(time.Second):
-				mu.RLock()
-				for clientConn := range clients {
-					jsonData, err := json.Marshal(current_data)
-					if err == nil {
-						err := clientConn.WriteMessage(websocket.TextMessage, []byte(string(jsonData)))
-						if err != nil {
-							log.Printf("Error al hacer broadcast a %s: %v", clientConn.RemoteAddr(), err)
-						}
+	// The live buffer backs mark-now and the WebSocket sync, with or without control.
+	pipeline.Subscribe(live_samples.OnSample)
+	pipeline.Subscribe(follower.OnSample)
+	if *control_name != "none" && driver != nil {
+		log.Printf("control de calor/ventilador mediante %s", driver.Name())
+		controller = NewController(driver, ControlLimits{HeatMax: *heat_max, FanMinWithHeat: *fan_min, MaxBT: *max_bt})
+		pipeline.Subscribe(controller.Check)
+	} else if *control_name != "" && *control_name != "none" {
+		log.Printf("la source %s no puede usarse como actuador de control", *control_name)
+	}
+	if len(names) == 0 {
+		log.Println("sin sources de temperatura, solo se sirve el historial")
+	} else {
+		pipeline.Wait()
 
-					}
-				}
-				mu.RUnlock()
-			case <-done:
+		config := DefaultWatchdogConfig()
+		if *watchdog_config != "" {
+			loaded, err := LoadWatchdogConfig(*watchdog_config)
+			if err != nil {
+				log.Println("watchdog:", err)
 				return
 			}
+			config = loaded
 		}
-	}()
+		watchdog := NewWatchdog(config, pipeline.TimeScale)
+		pipeline.Subscribe(watchdog.OnSample)
+		go watchdog.Run(pipeline.Done())
+	}
 
 	// Goroutine to start the HTTP server.
 	go func() {
@@ -395,57 +651,205 @@ func main() {
 		fs := http.FileServer(http.Dir("static"))
 		mux := http.NewServeMux()
 		// Register the WebSocket handler for the "/temp" path.
-		mux.HandleFunc("/temp", wsHandler)
+		mux.HandleFunc("/temp", requirePermission(PermView, wsHandler))
+		// Register the login handlers.
+		mux.HandleFunc("POST /api/v1/auth/login", loginHandler)
+		mux.HandleFunc("POST /api/v1/auth/logout", logoutHandler)
+		mux.HandleFunc("GET /api/v1/auth/me", requireAuth(meHandler))
+		mux.HandleFunc("POST /api/v1/auth/password", requireAuth(changePasswordHandler))
+		mux.HandleFunc("GET /api/v1/auth/users", requirePermission(PermAdmin, usersHandler))
+		mux.HandleFunc("POST /api/v1/auth/users", requirePermission(PermAdmin, createUserHandler))
+		mux.HandleFunc("GET /api/v1/auth/tokens", requireAuth(apiTokensHandler))
+		mux.HandleFunc("POST /api/v1/auth/tokens", requireAuth(createApiTokenHandler))
+		mux.HandleFunc("DELETE /api/v1/auth/tokens/{id}", requireAuth(revokeApiTokenHandler))
 		// Register the REST API handlers.
-		mux.HandleFunc("/api/v1/temp/roast_sessions", roastSessionsHandler)
-		mux.HandleFunc("/api/v1/temp/roast_sessions/{id}", roastSessionDataByIdHandler)
-		mux.HandleFunc("DELETE /api/v1/temp/roast_sessions/{id}", roastDeleteSessionByIdHandler)
-		mux.HandleFunc("POST /api/v1/temp/roast_sessions/mark", roastSessionSetMark)
+		mux.HandleFunc("GET /api/v1/openapi.json", openAPIHandler)
+		mux.HandleFunc("/api/v1/temp/roast_sessions", requirePermission(PermView, roastSessionsHandler))
+		mux.HandleFunc("/api/v1/temp/roast_sessions/{id}", requirePermission(PermView, roastSessionDataByIdHandler))
+		mux.HandleFunc("DELETE /api/v1/temp/roast_sessions/{id}", requirePermission(PermDelete, roastDeleteSessionByIdHandler))
+		mux.HandleFunc("PATCH /api/v1/temp/roast_sessions/{id}", requirePermission(PermOperate, roastSessionPatchHandler))
+		mux.HandleFunc("GET /api/v1/temp/roast_sessions/compare", requirePermission(PermView, roastSessionsCompareHandler))
+		mux.HandleFunc("GET /api/v1/temp/roast_sessions/trash", requirePermission(PermDelete, roastTrashHandler))
+		mux.HandleFunc("POST /api/v1/temp/roast_sessions/{id}/restore", requirePermission(PermDelete, roastRestoreSessionHandler))
+		mux.HandleFunc("DELETE /api/v1/temp/roast_sessions/trash/{id}", requirePermission(PermAdmin, roastPurgeSessionHandler))
+		mux.HandleFunc("POST /api/v1/temp/roast_sessions/mark", requirePermission(PermMark, roastSessionSetMark))
+		mux.HandleFunc("POST /api/v1/temp/roast_sessions/mark/now", requirePermission(PermMark, markNowHandler))
+		mux.HandleFunc("GET /api/v1/temp/roast_sessions/{id}/marks", requirePermission(PermView, roastSessionMarksHandler))
+		mux.HandleFunc("GET /api/v1/temp/roast_sessions/{id}/report", requirePermission(PermExport, roastSessionReportHandler))
+		mux.HandleFunc("GET /api/v1/temp/roast_sessions/{id}/chart", requirePermission(PermExport, roastSessionChartHandler))
+		mux.HandleFunc("GET /api/v1/temp/roast_sessions/compare/chart", requirePermission(PermExport, roastSessionsCompareChartHandler))
+		mux.HandleFunc("GET /api/v1/temp/marks/{mark_id}", requirePermission(PermView, markByIdHandler))
+		mux.HandleFunc("PUT /api/v1/temp/marks/{mark_id}", requirePermission(PermMark, markUpdateHandler))
+		mux.HandleFunc("DELETE /api/v1/temp/marks/{mark_id}", requirePermission(PermMark, markDeleteHandler))
+		mux.HandleFunc("GET /api/v1/temp/events", requirePermission(PermView, liveEventsHandler))
+		mux.HandleFunc("GET /api/v1/analytics/consistency", requirePermission(PermView, consistencyHandler))
+		mux.HandleFunc("GET /api/v1/incidents", requirePermission(PermView, incidentsHandler))
+		mux.HandleFunc("GET /api/v1/control/pid", requirePermission(PermView, pidStatusHandler))
+		mux.HandleFunc("POST /api/v1/control/pid", requirePermission(PermControl, pidStartHandler))
+		mux.HandleFunc("DELETE /api/v1/control/pid", requirePermission(PermControl, pidStopHandler))
+		// Register the admin handlers.
+		mux.HandleFunc("GET /api/v1/admin/roles", requirePermission(PermAdmin, rolesHandler))
+		mux.HandleFunc("PUT /api/v1/admin/users/{id}/role", requirePermission(PermAdmin, setUserRoleHandler))
+		mux.HandleFunc("GET /api/v1/admin/audit", requirePermission(PermAdmin, auditHandler))
+		mux.HandleFunc("POST /api/v1/admin/replay", requirePermission(PermAdmin, adminReplayStartHandler))
+		mux.HandleFunc("DELETE /api/v1/admin/replay", requirePermission(PermAdmin, adminReplayStopHandler))
 		// Register the file server for the root path.
 		mux.Handle("/", fs)
 
 		// Start a simple HTTP server to serve the WebSocket endpoint.
 		port := ":8080"
 		log.Printf("WebSocket server starting on port %s", port)
-		err := http.ListenAndServe(port, mux)
+		err := http.ListenAndServe(port, validateRequests(mux))
 		if err != nil {
 			log.Printf("Server failed to start: %v", err)
 		}
 	}()
 
+	// Serve the gRPC API on its own port.
+	if *grpc_addr != "" {
+		go func() {
+			if err := ServeGRPC(*grpc_addr, *grpc_cert, *grpc_key); err != nil {
+				log.Printf("gRPC server failed to start: %v", err)
+			}
+		}()
+	}
+
 	// Handle system interrupts (e.g., Ctrl+C).
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt)
 
 	select {
-	case <-done:
+	case <-pipeline.Done():
 	case <-interrupt:
 		log.Println("interrupt")
-		if session.IsActive() {
-			session_data_provider.StopSession(session.GetId())
-		}
-		// Cleanly close the connection by sending a close message to the server, then exit.
-		if *simule_data == "false" {
-			err := ws.Close()
-			if err != nil {
-				log.Println("close:", err)
-			}
-		}
-
+		StopSession("system", "")
+		pipeline.Stop()
 	}
 	log.Println("exiting")
 }
 
-func send_data_to_clients() {
-	mu.RLock()
-	for clientConn := range clients {
-		jsonData, err := json.Marshal(current_data)
-		if err == nil {
-			err := clientConn.WriteMessage(websocket.TextMessage, []byte(string(jsonData)))
-			if err != nil {
-				log.Printf("Error al hacer broadcast a %s: %v", clientConn.RemoteAddr(), err)
-			}
+// remarshal converts a decoded JSON value (e.g., a field of a WS command) into v.
+func remarshal(data any, v any) error {
+	if data == nil {
+		return nil
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+var session_mu sync.Mutex // Serializes starting, stopping and deleting sessions, so a check of the active session holds until the change is made.
+
+// StartSession starts recording a session and announces it to every client. It returns
+// the started session.
+func StartSession(name string, actor string, remote string) (ActiveSession, error) {
+	session_mu.Lock()
+	defer session_mu.Unlock()
+
+	replay_mu.Lock()
+	err := replayUnrecorded()
+	replay_mu.Unlock()
+	if err != nil {
+		return ActiveSession{}, err
+	}
+	return startSession(name, actor, remote, nil)
+}
+
+// startSession starts a session, with session_mu held. detail is added to the audit entry.
+func startSession(name string, actor string, remote string, detail map[string]any) (ActiveSession, error) {
+	if strings.TrimSpace(name) == "" {
+		return ActiveSession{}, errors.New("se requiere session_name")
+	}
+	if err := session.Start(name); err != nil {
+		return ActiveSession{}, err
+	}
+	active, _ := session.Active()
+	if err := session_data_provider.StartNewSession(active.Id, active.Name, actor); err != nil {
+		session.Stop()
+		return ActiveSession{}, err
+	}
+	live_roaster.Resolve(active.Id)
+	if detail == nil {
+		detail = map[string]any{}
+	}
+	detail["name"] = active.Name
+	AuditAs(actor, remote, "session.start", active.Id, detail)
+	send_data_to_clients(sessionFrame(active.Id, active.Name, true))
+	return active, nil
+}
+
+// StopSession stops the active session and announces it to every client. It returns
+// the stopped session.
+func StopSession(actor string, remote string) (ActiveSession, error) {
+	return stopSession("", actor, remote)
+}
+
+// stopSession stops the active session if it is session_id, or whichever it is when
+// session_id is empty.
+func stopSession(session_id string, actor string, remote string) (ActiveSession, error) {
+	session_mu.Lock()
+	defer session_mu.Unlock()
 
+	active, ok := session.Active()
+	if !ok || (session_id != "" && active.Id != session_id) {
+		return ActiveSession{}, errors.New("no hay session de tostado iniciada")
+	}
+	session_data_provider.StopSession(active.Id, actor)
+	AuditAs(actor, remote, "session.stop", active.Id, nil)
+	session.Stop()
+	send_data_to_clients(sessionFrame(active.Id, active.Name, false))
+	return active, nil
+}
+
+// DeleteSession moves the session session_id to the trash. The session being recorded
+// cannot be deleted (ErrSessionActive), nor can sessions already in the trash
+// (ErrSessionNotFound).
+func DeleteSession(session_id string, actor string, remote string) error {
+	session_mu.Lock()
+	defer session_mu.Unlock()
+
+	if session.IsCurrent(session_id) {
+		return ErrSessionActive
+	}
+	if stored, err := session_data_provider.GetSessionById(session_id); err != nil || stored.DeletedAt != 0 {
+		return ErrSessionNotFound
+	}
+	if err := session_data_provider.DeleteSession(session_id, actor); err != nil {
+		return err
+	}
+	deleted, _ := session_data_provider.GetSessionById(session_id)
+	AuditAs(actor, remote, "session.delete", session_id, map[string]any{"name": deleted.Name, "create_at": deleted.CreateAt, "end_at": deleted.EndAt})
+	return nil
+}
+
+// sessionFrame is the live frame telling that the session session_id started or stopped.
+func sessionFrame(session_id string, session_name string, active bool) map[string]any {
+	return map[string]any{"type": "session", "active": active, "session_id": session_id, "session_name": session_name}
+}
+
+// send_data_to_clients broadcasts a frame to every connected WebSocket, SSE and gRPC client.
+// Every frame gets the next sequence number ("seq") and is kept for clients resuming after a gap.
+// Frames are only queued, each client has its own writer; clients too slow to keep up are
+// disconnected and resume with the last seq they got.
+func send_data_to_clients(data any) {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		log.Println("error json en broadcast,", err)
+		return
+	}
+
+	broadcast_mu.Lock()
+	defer broadcast_mu.Unlock()
+	frame := broadcast_history.Add(jsonData)
+	liveBroadcast(broadcast_history.Seq(), frame)
+
+	mu.RLock()
+	for conn, client := range clients {
+		if !client.TrySend(frame) {
+			log.Printf("Cliente %s demasiado lento, se desconecta", conn.RemoteAddr())
+			client.Close()
 		}
 	}
 	mu.RUnlock()
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mark_ror_seconds is the window of the rate of rise stored with live marks, the same
+// the profile follower uses.
+const mark_ror_seconds = 30
+
+// LiveSamples keeps the samples of the last minute of the live stream so marks can be
+// snapped to them.
+type LiveSamples struct {
+	mu        sync.Mutex
+	window_ms int64
+	samples   []TempType
+}
+
+// NewLiveSamples creates a buffer of the given seconds.
+func NewLiveSamples(seconds float64) *LiveSamples {
+	return &LiveSamples{window_ms: int64(seconds * 1000)}
+}
+
+// live_samples is the buffer fed by the pipeline.
+var live_samples = NewLiveSamples(60)
+
+// OnSample is a pipeline subscriber buffering every sample.
+func (l *LiveSamples) OnSample(temp TempType) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.samples = append(l.samples, temp)
+	first := 0
+	for first < len(l.samples)-1 && temp.TimeStamp-l.samples[first].TimeStamp > l.window_ms {
+		first++
+	}
+	l.samples = l.samples[first:]
+}
+
+// Nearest returns the buffered sample closest to ts taken at or after since, and the
+// rate of rise over the samples leading to it, nil when there are too few to know it.
+func (l *LiveSamples) Nearest(ts int64, since int64) (TempType, *float64, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	best := -1
+	for i, sample := range l.samples {
+		if sample.TimeStamp < since {
+			continue
+		}
+		if best < 0 || abs64(sample.TimeStamp-ts) < abs64(l.samples[best].TimeStamp-ts) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return TempType{}, nil, false
+	}
+
+	sample := l.samples[best]
+	var window_ts []int64
+	var window_temps []float64
+	for _, s := range l.samples[:best+1] {
+		if sample.TimeStamp-s.TimeStamp <= mark_ror_seconds*1000 {
+			window_ts = append(window_ts, s.TimeStamp)
+			window_temps = append(window_temps, s.Temp)
+		}
+	}
+	if ror, ok := rorSlope(window_ts, window_temps); ok {
+		return sample, &ror, true
+	}
+	return sample, nil, true
+}
+
+// storedSnapshot returns the reading of every channel at the stored sample ts of a
+// session and the rate of rise over the samples leading to it, like MarkNow takes them
+// from the live stream.
+func storedSnapshot(session_id string, ts int64) (map[string]float64, *float64) {
+	temps := session_data_provider.GetMeasurements(session_id, MeasurementQuery{From: ts - mark_ror_seconds*1000, To: ts})
+	if len(temps) == 0 {
+		return nil, nil
+	}
+
+	window_ts := make([]int64, len(temps))
+	window_temps := make([]float64, len(temps))
+	for i, temp := range temps {
+		window_ts[i], window_temps[i] = temp.TimeStamp, temp.Temp
+	}
+	var ror *float64
+	if slope, ok := rorSlope(window_ts, window_temps); ok {
+		ror = &slope
+	}
+	return sampleChannels(*temps[len(temps)-1]), ror
+}
+
+func abs64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// MarkNow stores a mark on the active session at the sample nearest to the server
+// clock, with the reading of every channel and the rate of rise at that sample, and
+// broadcasts it to every client.
+func MarkNow(mark_name string, created_by string) (Mark, error) {
+	mark_name = strings.TrimSpace(mark_name)
+	if mark_name == "" {
+		return Mark{}, errors.New("se requiere mark_name")
+	}
+	active, ok := session.Active()
+	if !ok {
+		return Mark{}, errors.New("no hay session de tostado iniciada")
+	}
+
+	mark := Mark{SessionId: active.Id, MarkName: mark_name, CreatedBy: created_by}
+
+	sample, ror, ok := live_samples.Nearest(time.Now().UnixMilli(), active.CreateAt)
+	if !ok {
+		return Mark{}, errors.New("todavia no hay mediciones en la session")
+	}
+	mark.CreatedAt = sample.TimeStamp
+	mark.OnTemp = sample.Temp
+	mark.Channels = sampleChannels(sample)
+	mark.RoR = ror
+
+	mark, err := session_data_provider.SetMark(mark)
+	if err != nil {
+		return mark, err
+	}
+	send_data_to_clients(map[string]any{"type": "mark", "mark": mark})
+	return mark, nil
+}
+
+// markNowHandler marks the active session at the current sample.
+func markNowHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+
+	var body struct {
+		MarkName string `json:"mark_name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "body invalido")
+		return
+	}
+	defer r.Body.Close()
+
+	if strings.TrimSpace(body.MarkName) == "" {
+		writeJSONError(w, http.StatusBadRequest, "se requiere mark_name")
+		return
+	}
+
+	mark, err := MarkNow(body.MarkName, currentUser(r).Actor())
+	if err != nil {
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+	Audit(r, "mark.create", mark.SessionId, mark)
+
+	json.NewEncoder(w).Encode(map[string]any{"status": true, "mark": mark})
+}
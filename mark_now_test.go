@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestLiveSamplesNearest(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples [][2]float64 // Timestamp in seconds and reading.
+		ts      int64
+		since   int64
+		want    int64    // The timestamp of the sample found, in milliseconds.
+		wantRoR *float64 // nil when it cannot be known.
+		wantOk  bool
+	}{
+		{"empty", nil, 5000, 0, 0, nil, false},
+		{"single sample", [][2]float64{{1, 100}}, 5000, 0, 1000, nil, true},
+		{"rising", [][2]float64{{0, 100}, {30, 105}, {60, 110}}, 59000, 0, 60000, floatPtr(10), true},
+		{"nearest", [][2]float64{{0, 100}, {30, 105}, {60, 110}}, 31000, 0, 30000, floatPtr(10), true},
+		{"before since", [][2]float64{{0, 100}, {30, 105}}, 0, 10000, 30000, floatPtr(10), true},
+		{"all before since", [][2]float64{{0, 100}, {30, 105}}, 0, 40000, 0, nil, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := NewLiveSamples(120)
+			for _, s := range test.samples {
+				l.OnSample(TempType{Type: "temp", Temp: s[1], TimeStamp: int64(s[0] * 1000)})
+			}
+			sample, ror, ok := l.Nearest(test.ts, test.since)
+			if ok != test.wantOk {
+				t.Fatalf("ok = %v, want %v", ok, test.wantOk)
+			}
+			if !ok {
+				return
+			}
+			if sample.TimeStamp != test.want {
+				t.Errorf("sample at %d, want %d", sample.TimeStamp, test.want)
+			}
+			switch {
+			case (ror == nil) != (test.wantRoR == nil):
+				t.Errorf("ror = %v, want %v", ror, test.wantRoR)
+			case ror != nil && (*ror-*test.wantRoR > 1e-9 || *test.wantRoR-*ror > 1e-9):
+				t.Errorf("ror = %v, want %v", *ror, *test.wantRoR)
+			}
+		})
+	}
+}
+
+func floatPtr(v float64) *float64 { return &v }
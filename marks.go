@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// markFromPath returns the mark {mark_id} and its session, writing the error response
+// when it does not exist. Marks of sessions in the trash are not found either.
+func markFromPath(w http.ResponseWriter, r *http.Request) (Mark, SessionData, bool) {
+	mark_id, err := strconv.ParseInt(r.PathValue("mark_id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "id de mark invalido")
+		return Mark{}, SessionData{}, false
+	}
+	mark, err := session_data_provider.GetMarkById(mark_id)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return Mark{}, SessionData{}, false
+	}
+	stored, err := session_data_provider.GetSessionById(mark.SessionId)
+	if err != nil || stored.DeletedAt != 0 {
+		writeJSONError(w, http.StatusNotFound, "session no encontrada: "+mark.SessionId)
+		return Mark{}, SessionData{}, false
+	}
+	return mark, stored, true
+}
+
+// roastSessionMarksHandler returns the marks of the session {id}.
+func roastSessionMarksHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+
+	session_id := r.PathValue("id")
+	if stored, err := session_data_provider.GetSessionById(session_id); err != nil || stored.DeletedAt != 0 {
+		writeJSONError(w, http.StatusNotFound, "session no encontrada: "+session_id)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"marks": session_data_provider.GetMarksOfSessions(session_id)})
+}
+
+// markByIdHandler returns the mark {mark_id}.
+func markByIdHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+
+	mark, _, ok := markFromPath(w, r)
+	if !ok {
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"mark": mark})
+}
+
+// markUpdateHandler renames the mark {mark_id} and/or moves it to another time within
+// its session. Moving a mark recomputes on_temp, unless it is given, and the channels
+// and RoR of marks that have them, from the stored measurements.
+func markUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+
+	mark, stored, ok := markFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		MarkName  *string  `json:"mark_name"`
+		CreatedAt *int64   `json:"create_at"`
+		OnTemp    *float64 `json:"on_temp"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "body invalido")
+		return
+	}
+	defer r.Body.Close()
+
+	before := mark
+	if body.MarkName != nil {
+		mark.MarkName = strings.TrimSpace(*body.MarkName)
+		if mark.MarkName == "" {
+			writeJSONError(w, http.StatusBadRequest, "mark_name no puede estar vacio")
+			return
+		}
+	}
+	if body.OnTemp != nil {
+		mark.OnTemp = *body.OnTemp
+	}
+	if body.CreatedAt != nil && *body.CreatedAt != mark.CreatedAt {
+		end_at := stored.EndAt
+		if end_at == 0 {
+			end_at = time.Now().UnixMilli()
+		}
+		if *body.CreatedAt < stored.CreateAt || *body.CreatedAt > end_at {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("create_at debe estar dentro de la session, entre %d y %d", stored.CreateAt, end_at))
+			return
+		}
+		mark.CreatedAt = *body.CreatedAt
+		snapshot := mark.Channels != nil || mark.RoR != nil
+		mark.Channels, mark.RoR = nil, nil
+		// Marks of the chart hold a sample index, resolve it to the timestamp of the sample.
+		if at, ok := session_data_provider.GetMarkTimestamp(mark.SessionId, mark); ok {
+			if temp, ok := session_data_provider.TempAt(mark.SessionId, at); ok && body.OnTemp == nil {
+				mark.OnTemp = temp
+			}
+			// Marks taken from the live stream describe their instant, take it again.
+			if snapshot {
+				mark.Channels, mark.RoR = storedSnapshot(mark.SessionId, at)
+			}
+		}
+	}
+
+	if err := session_data_provider.UpdateMark(mark); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	Audit(r, "mark.update", mark.SessionId, map[string]any{"before": before, "after": mark})
+	send_data_to_clients(map[string]any{"type": "mark_updated", "mark": mark})
+
+	json.NewEncoder(w).Encode(map[string]any{"status": true, "mark": mark})
+}
+
+// markDeleteHandler deletes the mark {mark_id}.
+func markDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+
+	mark, _, ok := markFromPath(w, r)
+	if !ok {
+		return
+	}
+	if err := session_data_provider.DeleteMark(mark.Id); err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	Audit(r, "mark.delete", mark.SessionId, mark)
+	send_data_to_clients(map[string]any{"type": "mark_deleted", "mark": mark})
+
+	json.NewEncoder(w).Encode(map[string]any{"status": true, "msg": "mark eliminada"})
+}
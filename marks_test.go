@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMarkUpdateHandler(t *testing.T) {
+	db := useTestDatabase(t)
+	insertSession(t, db, "roast", "Guji #1", 1000)
+	insertSession(t, db, "trashed", "Huila #1", 1000)
+	for i, temp := range []float64{100, 150, 200} {
+		ts := int64(1000 + i*60000)
+		session_data_provider.InsertTempValToSession("roast", TempType{TimeStamp: ts, Temp: temp})
+		session_data_provider.InsertTempValToSession("trashed", TempType{TimeStamp: ts, Temp: temp})
+	}
+	trashed, err := session_data_provider.SetMark(Mark{SessionId: "trashed", MarkName: "charge", CreatedAt: 1000, OnTemp: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session_data_provider.DeleteSession("trashed", "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		trashed bool
+		body    string
+		status  int
+		want    Mark
+	}{
+		{"rename", false, `{"mark_name":"FC"}`, http.StatusOK, Mark{MarkName: "FC", CreatedAt: 1000, OnTemp: 100}},
+		{"move takes the stored temp", false, `{"create_at":61000}`, http.StatusOK, Mark{MarkName: "charge", CreatedAt: 61000, OnTemp: 150}},
+		{"explicit on_temp wins", false, `{"create_at":121000,"on_temp":198.5}`, http.StatusOK, Mark{MarkName: "charge", CreatedAt: 121000, OnTemp: 198.5}},
+		{"before the session", false, `{"create_at":999}`, http.StatusBadRequest, Mark{}},
+		{"after the session", false, `{"create_at":601001}`, http.StatusBadRequest, Mark{}},
+		{"trashed session", true, `{"mark_name":"FC"}`, http.StatusNotFound, Mark{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mark := trashed
+			if !tt.trashed {
+				if mark, err = session_data_provider.SetMark(Mark{SessionId: "roast", MarkName: "charge", CreatedAt: 1000, OnTemp: 100}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r := httptest.NewRequest(http.MethodPut, "/api/v1/temp/marks/"+strconv.FormatInt(mark.Id, 10), strings.NewReader(tt.body))
+			r.SetPathValue("mark_id", strconv.FormatInt(mark.Id, 10))
+			w := httptest.NewRecorder()
+			markUpdateHandler(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var result struct{ Mark Mark }
+			if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+				t.Fatal(err)
+			}
+			got := result.Mark
+			if got.MarkName != tt.want.MarkName || got.CreatedAt != tt.want.CreatedAt || got.OnTemp != tt.want.OnTemp {
+				t.Errorf("mark = %+v, want %+v", got, tt.want)
+			}
+			if stored, err := session_data_provider.GetMarkById(mark.Id); err != nil || stored.OnTemp != got.OnTemp || stored.CreatedAt != got.CreatedAt {
+				t.Errorf("stored mark = %+v, %v; want %+v", stored, err, got)
+			}
+		})
+	}
+}
+
+func TestMarkHandlersOfTrashedSession(t *testing.T) {
+	db := useTestDatabase(t)
+	insertSession(t, db, "trashed", "Huila #1", 1000)
+	mark, err := session_data_provider.SetMark(Mark{SessionId: "trashed", MarkName: "charge", CreatedAt: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session_data_provider.DeleteSession("trashed", "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, handler := range []http.HandlerFunc{markByIdHandler, markDeleteHandler} {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/temp/marks/"+strconv.FormatInt(mark.Id, 10), nil)
+		r.SetPathValue("mark_id", strconv.FormatInt(mark.Id, 10))
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+		}
+	}
+	if _, err := session_data_provider.GetMarkById(mark.Id); err != nil {
+		t.Errorf("mark of the trashed session deleted: %v", err)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// MeasurementQuery selects the measurements of a session.
+type MeasurementQuery struct {
+	From     int64    // Only measurements at or after this timestamp (in milliseconds); 0 for no limit.
+	To       int64    // Only measurements at or before this timestamp (in milliseconds); 0 for no limit.
+	Channels []string // The channels attached to the measurements; nil for every channel.
+}
+
+// where returns the SQL condition and arguments of the query.
+func (q MeasurementQuery) where(session_id string) (string, []any) {
+	where, args := "session_id = ?", []any{session_id}
+	if q.From != 0 {
+		where += " AND timestamp >= ?"
+		args = append(args, q.From)
+	}
+	if q.To != 0 {
+		where += " AND timestamp <= ?"
+		args = append(args, q.To)
+	}
+	return where, args
+}
+
+// Downsampling methods.
+const (
+	DownsampleLTTB   = "lttb"   // Largest triangle three buckets, keeps the shape of the curve.
+	DownsampleMinMax = "minmax" // The lowest and highest sample of every bucket, keeps the peaks.
+)
+
+const max_points_limit = 100000
+
+// MeasurementParams are the measurement parameters of a session request.
+type MeasurementParams struct {
+	Query      MeasurementQuery
+	FromS      *float64 // Range start in seconds from charge, resolved into Query.From.
+	ToS        *float64 // Range end in seconds from charge, resolved into Query.To.
+	MaxPoints  int      // 0 to return every point.
+	Downsample string
+}
+
+// ParseMeasurementParams reads from and to (timestamps in milliseconds), from_s and
+// to_s (seconds from charge), max_points, downsample (lttb or minmax) and channels
+// (comma separated; bt is the bean temperature, always returned).
+func ParseMeasurementParams(values url.Values) (MeasurementParams, error) {
+	params := MeasurementParams{Downsample: DownsampleLTTB}
+
+	integer := func(name string, out *int64) error {
+		v := values.Get(name)
+		if v == "" {
+			return nil
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return errors.New(name + " debe ser un timestamp en milisegundos")
+		}
+		*out = n
+		return nil
+	}
+	seconds := func(name string, out **float64) error {
+		v := values.Get(name)
+		if v == "" {
+			return nil
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return errors.New(name + " debe ser un numero de segundos")
+		}
+		*out = &f
+		return nil
+	}
+	if err := errors.Join(
+		integer("from", &params.Query.From),
+		integer("to", &params.Query.To),
+		seconds("from_s", &params.FromS),
+		seconds("to_s", &params.ToS),
+	); err != nil {
+		return params, err
+	}
+	if (params.Query.From != 0 && params.FromS != nil) || (params.Query.To != 0 && params.ToS != nil) {
+		return params, errors.New("use from/to o from_s/to_s, no ambos")
+	}
+
+	if v := values.Get("max_points"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 10 || n > max_points_limit {
+			return params, errors.New("max_points debe estar entre 10 y " + strconv.Itoa(max_points_limit))
+		}
+		params.MaxPoints = n
+	}
+	if v := values.Get("downsample"); v != "" {
+		if v != DownsampleLTTB && v != DownsampleMinMax {
+			return params, errors.New("downsample debe ser lttb o minmax")
+		}
+		params.Downsample = v
+	}
+
+	if v, ok := values["channels"]; ok {
+		params.Query.Channels = []string{}
+		for _, channel := range strings.Split(strings.Join(v, ","), ",") {
+			if channel = strings.ToLower(strings.TrimSpace(channel)); channel != "" {
+				params.Query.Channels = append(params.Query.Channels, channel)
+			}
+		}
+	}
+
+	return params, nil
+}
+
+// Relative reports whether the range is given from charge.
+func (p MeasurementParams) Relative() bool {
+	return p.FromS != nil || p.ToS != nil
+}
+
+// Resolve turns the range from charge into timestamps, given the charge timestamp.
+func (p *MeasurementParams) Resolve(charge int64) {
+	if p.FromS != nil {
+		p.Query.From = max(1, charge+int64(math.Round(*p.FromS*1000)))
+	}
+	if p.ToS != nil {
+		p.Query.To = max(1, charge+int64(math.Round(*p.ToS*1000)))
+	}
+}
+
+// Apply downsamples the measurements.
+func (p MeasurementParams) Apply(temps []*TempType) []*TempType {
+	if p.MaxPoints == 0 || len(temps) <= p.MaxPoints {
+		return temps
+	}
+	if p.Downsample == DownsampleMinMax {
+		return DownsampleMinMaxBuckets(temps, p.MaxPoints)
+	}
+	return DownsampleLTTBPoints(temps, p.MaxPoints)
+}
+
+// chargeTimestamp returns the timestamp of the charge of a session: its charge mark,
+// or its first sample.
+func chargeTimestamp(session_id string) (int64, bool) {
+	for _, mark := range session_data_provider.GetMarksOfSessions(session_id) {
+		if eventOfMark(mark.MarkName) == "charge" {
+			return session_data_provider.GetMarkTimestamp(session_id, mark)
+		}
+	}
+	return session_data_provider.GetMarkTimestamp(session_id, Mark{})
+}
+
+// DownsampleLTTBPoints keeps n of the samples with the largest triangle three buckets
+// algorithm on the bean temperature. The first and last samples are always kept.
+// Channels follow the samples chosen for the bean temperature.
+func DownsampleLTTBPoints(temps []*TempType, n int) []*TempType {
+	if n >= len(temps) || n < 3 {
+		return temps
+	}
+	sampled := make([]*TempType, 0, n)
+	sampled = append(sampled, temps[0])
+
+	bucket := float64(len(temps)-2) / float64(n-2)
+	a := 0
+	for i := 0; i < n-2; i++ {
+		// The average of the next bucket is the third point of the triangles.
+		next_start := int(float64(i+1)*bucket) + 1
+		next_end := min(int(float64(i+2)*bucket)+1, len(temps))
+		var avg_x, avg_y float64
+		for j := next_start; j < next_end; j++ {
+			avg_x += float64(temps[j].TimeStamp)
+			avg_y += temps[j].Temp
+		}
+		if count := float64(next_end - next_start); count > 0 {
+			avg_x /= count
+			avg_y /= count
+		} else {
+			avg_x, avg_y = float64(temps[len(temps)-1].TimeStamp), temps[len(temps)-1].Temp
+		}
+
+		start := int(float64(i)*bucket) + 1
+		end := int(float64(i+1)*bucket) + 1
+		ax, ay := float64(temps[a].TimeStamp), temps[a].Temp
+		best, best_area := start, -1.0
+		for j := start; j < end; j++ {
+			area := math.Abs((ax-avg_x)*(temps[j].Temp-ay) - (ax-float64(temps[j].TimeStamp))*(avg_y-ay))
+			if area > best_area {
+				best, best_area = j, area
+			}
+		}
+		sampled = append(sampled, temps[best])
+		a = best
+	}
+
+	return append(sampled, temps[len(temps)-1])
+}
+
+// DownsampleMinMaxBuckets splits the samples in n/2 buckets and keeps the lowest and
+// highest bean temperature of each, in time order, so spikes are never lost.
+func DownsampleMinMaxBuckets(temps []*TempType, n int) []*TempType {
+	buckets := n / 2
+	if buckets < 1 || n >= len(temps) {
+		return temps
+	}
+	sampled := make([]*TempType, 0, n)
+	size := float64(len(temps)) / float64(buckets)
+	for i := 0; i < buckets; i++ {
+		start, end := int(float64(i)*size), min(int(float64(i+1)*size), len(temps))
+		if start >= end {
+			continue
+		}
+		lo, hi := start, start
+		for j := start; j < end; j++ {
+			if temps[j].Temp < temps[lo].Temp {
+				lo = j
+			}
+			if temps[j].Temp > temps[hi].Temp {
+				hi = j
+			}
+		}
+		switch {
+		case lo == hi:
+			sampled = append(sampled, temps[lo])
+		case lo < hi:
+			sampled = append(sampled, temps[lo], temps[hi])
+		default:
+			sampled = append(sampled, temps[hi], temps[lo])
+		}
+	}
+	return sampled
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"net/url"
+	"slices"
+	"testing"
+)
+
+// rampSamples returns n samples one second apart on a slow ramp, with a spike at spike
+// (none when negative).
+func rampSamples(n, spike int) []*TempType {
+	temps := make([]*TempType, n)
+	for i := range temps {
+		temps[i] = &TempType{Type: "temp", Temp: 100 + float64(i)*0.1, TimeStamp: 1000 + int64(i)*1000}
+	}
+	if spike >= 0 {
+		temps[spike].Temp += 50
+	}
+	return temps
+}
+
+// checkDownsampled checks that the samples are a subset of temps in time order.
+func checkDownsampled(t *testing.T, temps, sampled []*TempType) {
+	t.Helper()
+	for i, sample := range sampled {
+		if !slices.Contains(temps, sample) {
+			t.Fatalf("sample %d (%+v) is not in the input", i, *sample)
+		}
+		if i > 0 && sample.TimeStamp <= sampled[i-1].TimeStamp {
+			t.Fatalf("sample %d at %d is not after %d", i, sample.TimeStamp, sampled[i-1].TimeStamp)
+		}
+	}
+}
+
+func TestDownsampleLTTBPoints(t *testing.T) {
+	tests := []struct {
+		name     string
+		samples  int
+		spike    int
+		n        int
+		wantLen  int
+		keepsAll bool
+	}{
+		{"reduces", 1000, -1, 100, 100, false},
+		{"keeps the spike", 1000, 437, 50, 50, false},
+		{"uneven buckets", 997, 3, 13, 13, false},
+		{"fewer samples than points", 50, -1, 100, 50, true},
+		{"same samples as points", 100, -1, 100, 100, true},
+		{"too few points", 1000, -1, 2, 1000, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			temps := rampSamples(test.samples, test.spike)
+			sampled := DownsampleLTTBPoints(temps, test.n)
+			if len(sampled) != test.wantLen {
+				t.Fatalf("len = %d, want %d", len(sampled), test.wantLen)
+			}
+			checkDownsampled(t, temps, sampled)
+			if sampled[0] != temps[0] || sampled[len(sampled)-1] != temps[len(temps)-1] {
+				t.Error("the first and last samples were dropped")
+			}
+			if test.spike >= 0 && !slices.Contains(sampled, temps[test.spike]) {
+				t.Errorf("the spike at %d was dropped", test.spike)
+			}
+			if test.keepsAll && !slices.Equal(sampled, temps) {
+				t.Error("the samples were changed")
+			}
+		})
+	}
+}
+
+func TestDownsampleMinMaxBuckets(t *testing.T) {
+	tests := []struct {
+		name     string
+		samples  int
+		spike    int
+		n        int
+		wantLen  int
+		keepsAll bool
+	}{
+		// A rising ramp has its minimum first and its maximum last in every bucket.
+		{"reduces", 1000, -1, 100, 100, false},
+		{"keeps the spike", 1000, 437, 50, 50, false},
+		{"odd points", 1000, -1, 21, 20, false},
+		{"fewer samples than points", 50, -1, 100, 50, true},
+		{"too few points", 1000, -1, 1, 1000, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			temps := rampSamples(test.samples, test.spike)
+			sampled := DownsampleMinMaxBuckets(temps, test.n)
+			if len(sampled) != test.wantLen {
+				t.Fatalf("len = %d, want %d", len(sampled), test.wantLen)
+			}
+			checkDownsampled(t, temps, sampled)
+			if test.spike >= 0 && !slices.Contains(sampled, temps[test.spike]) {
+				t.Errorf("the spike at %d was dropped", test.spike)
+			}
+			if test.keepsAll && !slices.Equal(sampled, temps) {
+				t.Error("the samples were changed")
+			}
+		})
+	}
+}
+
+func TestDownsampleMinMaxFlat(t *testing.T) {
+	// A flat bucket keeps a single sample.
+	temps := rampSamples(100, -1)
+	for _, temp := range temps {
+		temp.Temp = 180
+	}
+	if sampled := DownsampleMinMaxBuckets(temps, 10); len(sampled) != 5 {
+		t.Errorf("len = %d, want 5", len(sampled))
+	}
+}
+
+func TestMeasurementParamsResolve(t *testing.T) {
+	from, to := -30.0, 60.5
+	params := MeasurementParams{FromS: &from, ToS: &to}
+	params.Resolve(10000)
+	if params.Query.From != 1 || params.Query.To != 70500 {
+		t.Errorf("range = [%d, %d], want [1, 70500]", params.Query.From, params.Query.To)
+	}
+	if !params.Relative() {
+		t.Error("params are not relative")
+	}
+}
+
+func TestParseMeasurementParams(t *testing.T) {
+	tests := []struct {
+		query   string
+		check   func(MeasurementParams) bool
+		wantErr bool
+	}{
+		{"", func(p MeasurementParams) bool {
+			return p.MaxPoints == 0 && p.Downsample == DownsampleLTTB && p.Query.Channels == nil
+		}, false},
+		{"max_points=500&downsample=minmax", func(p MeasurementParams) bool { return p.MaxPoints == 500 && p.Downsample == DownsampleMinMax }, false},
+		{"from=1000&to=2000", func(p MeasurementParams) bool { return p.Query.From == 1000 && p.Query.To == 2000 && !p.Relative() }, false},
+		{"from_s=-10.5", func(p MeasurementParams) bool { return *p.FromS == -10.5 && p.Relative() }, false},
+		{"channels=ET, Fan,,", func(p MeasurementParams) bool { return slices.Equal(p.Query.Channels, []string{"et", "fan"}) }, false},
+		{"channels=", func(p MeasurementParams) bool { return p.Query.Channels != nil && len(p.Query.Channels) == 0 }, false},
+		{"max_points=5", nil, true},
+		{"max_points=1000001", nil, true},
+		{"downsample=avg", nil, true},
+		{"from=-1", nil, true},
+		{"from_s=NaN", nil, true},
+		{"from=1000&from_s=10", nil, true},
+	}
+	for _, test := range tests {
+		values, err := url.ParseQuery(test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		params, err := ParseMeasurementParams(values)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseMeasurementParams(%q) err = %v, wantErr %v", test.query, err, test.wantErr)
+			continue
+		}
+		if !test.wantErr && !test.check(params) {
+			t.Errorf("ParseMeasurementParams(%q) = %+v", test.query, params)
+		}
+	}
+}
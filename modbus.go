@@ -0,0 +1,559 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Modbus function codes used by the driver.
+const (
+	modbusReadHoldingRegisters = 0x03
+	modbusReadInputRegisters   = 0x04
+	modbusWriteSingleRegister  = 0x06
+)
+
+// ModbusRegister maps one Modbus register (or register pair) to a named channel.
+type ModbusRegister struct {
+	Channel  string  `json:"channel"`  // The channel name the value is published as (e.g., "bt", "et").
+	Address  uint16  `json:"address"`  // The zero-based register address.
+	Function string  `json:"function"` // "holding" (0x03) or "input" (0x04). Defaults to "holding".
+	Type     string  `json:"type"`     // "int16", "uint16", "int32", "uint32" or "float32". Defaults to "int16".
+	Scale    float64 `json:"scale"`    // Multiplier applied to the raw value. Defaults to 1.
+	Offset   float64 `json:"offset"`   // Added after scaling.
+	Primary  bool    `json:"primary"`  // Whether this channel is also published as TempType.Temp.
+}
+
+// ModbusConfig describes a Modbus device and the register map polled from it.
+type ModbusConfig struct {
+	Mode       string           `json:"mode"`        // "tcp" or "rtu".
+	Address    string           `json:"address"`     // host:port for tcp, serial device path for rtu.
+	BaudRate   int              `json:"baud_rate"`   // Serial speed for rtu. Defaults to 9600.
+	SlaveId    byte             `json:"slave_id"`    // The unit/slave id of the device.
+	IntervalMs int64            `json:"interval_ms"` // Polling interval. Defaults to 1000.
+	TimeoutMs  int64            `json:"timeout_ms"`  // Per request timeout. Defaults to 1000.
+	WordSwap   bool             `json:"word_swap"`   // Low word first for 32 bit values.
+	Unit       string           `json:"unit"`        // The unit of the readings (e.g., "C").
+	Registers  []ModbusRegister `json:"registers"`
+	Control    *ModbusControl   `json:"control"` // Optional holding registers for the control outputs.
+}
+
+// ModbusControl maps the heat and fan duty outputs to holding registers.
+type ModbusControl struct {
+	HeatAddress uint16  `json:"heat_address"` // Holding register receiving the heat duty.
+	FanAddress  uint16  `json:"fan_address"`  // Holding register receiving the fan duty.
+	Scale       float64 `json:"scale"`        // Percent per raw unit (e.g., 0.1 when the device expects tenths). Defaults to 1.
+}
+
+// LoadModbusConfig reads a Modbus configuration from a JSON file and fills in defaults.
+func LoadModbusConfig(path string) (*ModbusConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config ModbusConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("config modbus invalida: %w", err)
+	}
+
+	if config.Mode == "" {
+		config.Mode = "tcp"
+	}
+	if config.Mode != "tcp" && config.Mode != "rtu" {
+		return nil, fmt.Errorf("modo modbus desconocido: %s", config.Mode)
+	}
+	if config.BaudRate == 0 {
+		config.BaudRate = 9600
+	}
+	if config.SlaveId == 0 {
+		config.SlaveId = 1
+	}
+	if config.IntervalMs <= 0 {
+		config.IntervalMs = 1000
+	}
+	if config.TimeoutMs <= 0 {
+		config.TimeoutMs = 1000
+	}
+	if len(config.Registers) == 0 {
+		return nil, errors.New("config modbus sin registros")
+	}
+
+	if config.Control != nil && config.Control.Scale == 0 {
+		config.Control.Scale = 1
+	}
+
+	for i := range config.Registers {
+		reg := &config.Registers[i]
+		if reg.Channel == "" {
+			return nil, fmt.Errorf("registro %d sin canal", reg.Address)
+		}
+		if reg.Function == "" {
+			reg.Function = "holding"
+		}
+		if reg.Function != "holding" && reg.Function != "input" {
+			return nil, fmt.Errorf("funcion desconocida %s en canal %s", reg.Function, reg.Channel)
+		}
+		if reg.Type == "" {
+			reg.Type = "int16"
+		}
+		if reg.Words() == 0 {
+			return nil, fmt.Errorf("tipo desconocido %s en canal %s", reg.Type, reg.Channel)
+		}
+		if reg.Scale == 0 {
+			reg.Scale = 1
+		}
+	}
+
+	return &config, nil
+}
+
+// Words returns the number of 16 bit registers the value spans, or 0 for an unknown type.
+func (r ModbusRegister) Words() uint16 {
+	switch r.Type {
+	case "int16", "uint16":
+		return 1
+	case "int32", "uint32", "float32":
+		return 2
+	}
+	return 0
+}
+
+// FunctionCode returns the Modbus read function code of the register.
+func (r ModbusRegister) FunctionCode() byte {
+	if r.Function == "input" {
+		return modbusReadInputRegisters
+	}
+	return modbusReadHoldingRegisters
+}
+
+// Decode converts the raw registers into the scaled channel value.
+func (r ModbusRegister) Decode(words []uint16, word_swap bool) float64 {
+	var raw float64
+
+	if r.Words() == 2 {
+		hi, lo := uint32(words[0]), uint32(words[1])
+		if word_swap {
+			hi, lo = lo, hi
+		}
+		v := hi<<16 | lo
+		switch r.Type {
+		case "int32":
+			raw = float64(int32(v))
+		case "uint32":
+			raw = float64(v)
+		case "float32":
+			raw = float64(math.Float32frombits(v))
+		}
+	} else if r.Type == "uint16" {
+		raw = float64(words[0])
+	} else {
+		raw = float64(int16(words[0]))
+	}
+
+	return raw*r.Scale + r.Offset
+}
+
+// Encode converts a channel value into raw registers; it is the inverse of Decode.
+func (r ModbusRegister) Encode(value float64, word_swap bool) []uint16 {
+	raw := (value - r.Offset) / r.Scale
+
+	if r.Words() == 2 {
+		var v uint32
+		switch r.Type {
+		case "int32":
+			v = uint32(int32(math.Round(raw)))
+		case "uint32":
+			v = uint32(math.Round(raw))
+		case "float32":
+			v = math.Float32bits(float32(raw))
+		}
+		hi, lo := uint16(v>>16), uint16(v)
+		if word_swap {
+			hi, lo = lo, hi
+		}
+		return []uint16{hi, lo}
+	}
+
+	if r.Type == "uint16" {
+		return []uint16{uint16(math.Round(raw))}
+	}
+	return []uint16{uint16(int16(math.Round(raw)))}
+}
+
+// modbusTransport sends a request PDU to a slave and returns the response PDU.
+type modbusTransport interface {
+	Send(slave_id byte, pdu []byte) ([]byte, error)
+	Close() error
+}
+
+// ModbusClient reads registers from a Modbus device over TCP or RTU.
+type ModbusClient struct {
+	config    *ModbusConfig
+	transport modbusTransport
+	mu        sync.Mutex
+}
+
+// NewModbusClient creates a client for the given configuration; the connection is opened lazily.
+func NewModbusClient(config *ModbusConfig) *ModbusClient {
+	return &ModbusClient{config: config}
+}
+
+// connect opens the transport if it is not already open.
+func (c *ModbusClient) connect() error {
+	if c.transport != nil {
+		return nil
+	}
+
+	timeout := time.Duration(c.config.TimeoutMs) * time.Millisecond
+
+	switch c.config.Mode {
+	case "rtu":
+		port, err := openSerialPort(c.config.Address, c.config.BaudRate)
+		if err != nil {
+			return err
+		}
+		c.transport = &modbusRTUTransport{port: port, timeout: timeout}
+	default:
+		conn, err := net.DialTimeout("tcp", c.config.Address, timeout)
+		if err != nil {
+			return err
+		}
+		c.transport = &modbusTCPTransport{conn: conn, timeout: timeout}
+	}
+
+	log.Printf("modbus conectado a %s (%s)", c.config.Address, c.config.Mode)
+	return nil
+}
+
+// ReadRegisters reads quantity registers starting at address with the given function code.
+func (c *ModbusClient) ReadRegisters(function byte, address uint16, quantity uint16) ([]uint16, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+
+	pdu := make([]byte, 5)
+	pdu[0] = function
+	binary.BigEndian.PutUint16(pdu[1:], address)
+	binary.BigEndian.PutUint16(pdu[3:], quantity)
+
+	resp, err := c.transport.Send(c.config.SlaveId, pdu)
+	if err != nil {
+		// Drop the connection so the next poll reconnects.
+		c.transport.Close()
+		c.transport = nil
+		return nil, err
+	}
+
+	if resp[0] == function|0x80 {
+		if len(resp) < 2 {
+			return nil, errors.New("modbus: excepcion sin codigo")
+		}
+		return nil, fmt.Errorf("modbus: excepcion %d", resp[1])
+	}
+	if resp[0] != function || len(resp) < 2 || int(resp[1]) != int(quantity)*2 || len(resp) < 2+int(resp[1]) {
+		return nil, errors.New("modbus: respuesta invalida")
+	}
+
+	words := make([]uint16, quantity)
+	for i := range words {
+		words[i] = binary.BigEndian.Uint16(resp[2+i*2:])
+	}
+	return words, nil
+}
+
+// WriteRegister writes a single holding register.
+func (c *ModbusClient) WriteRegister(address uint16, value uint16) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	pdu := make([]byte, 5)
+	pdu[0] = modbusWriteSingleRegister
+	binary.BigEndian.PutUint16(pdu[1:], address)
+	binary.BigEndian.PutUint16(pdu[3:], value)
+
+	resp, err := c.transport.Send(c.config.SlaveId, pdu)
+	if err != nil {
+		c.transport.Close()
+		c.transport = nil
+		return err
+	}
+
+	if resp[0] == modbusWriteSingleRegister|0x80 && len(resp) >= 2 {
+		return fmt.Errorf("modbus: excepcion %d", resp[1])
+	}
+	if len(resp) != 5 || resp[0] != modbusWriteSingleRegister {
+		return errors.New("modbus: respuesta invalida")
+	}
+	return nil
+}
+
+// Read polls every configured register and returns a sample with the named channels.
+func (c *ModbusClient) Read() (TempType, error) {
+	temp := TempType{Type: "temp", Unit: c.config.Unit, Channels: map[string]float64{}}
+
+	for _, reg := range c.config.Registers {
+		words, err := c.ReadRegisters(reg.FunctionCode(), reg.Address, reg.Words())
+		if err != nil {
+			return temp, fmt.Errorf("canal %s: %w", reg.Channel, err)
+		}
+
+		value := reg.Decode(words, c.config.WordSwap)
+		temp.Channels[reg.Channel] = value
+		if reg.Primary {
+			temp.Temp = value
+		}
+	}
+
+	return temp, nil
+}
+
+// Close closes the underlying connection.
+func (c *ModbusClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.transport == nil {
+		return nil
+	}
+	err := c.transport.Close()
+	c.transport = nil
+	return err
+}
+
+func init() {
+	RegisterSource("modbus", func(options SourceOptions) (Source, error) {
+		if options.Modbus == nil {
+			return nil, errors.New("modbus: falta la configuracion (-modbus o -modbus-sim)")
+		}
+		return &ModbusSource{Config: options.Modbus}, nil
+	})
+}
+
+// ModbusSource polls a Modbus device as a pipeline source.
+type ModbusSource struct {
+	Config *ModbusConfig // The device and register map.
+
+	mu     sync.Mutex
+	client *ModbusClient // The client of the running source, shared with SetOutputs.
+	heat   float64       // The last heat duty written.
+	fan    float64       // The last fan duty written.
+}
+
+// Name returns the registry name of the source.
+func (s *ModbusSource) Name() string { return "modbus" }
+
+// CanControl returns true if control registers are configured.
+func (s *ModbusSource) CanControl() bool { return s.Config.Control != nil }
+
+// SetOutputs writes the heat and fan duty to the control registers, making the device
+// a ControlDriver.
+func (s *ModbusSource) SetOutputs(heat float64, fan float64) error {
+	control := s.Config.Control
+	if control == nil {
+		return errors.New("modbus: sin registros de control configurados")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client == nil {
+		return errors.New("modbus no conectado")
+	}
+
+	write_heat := func() error {
+		if err := s.client.WriteRegister(control.HeatAddress, uint16(math.Round(heat/control.Scale))); err != nil {
+			return err
+		}
+		s.heat = heat
+		return nil
+	}
+	write_fan := func() error {
+		if err := s.client.WriteRegister(control.FanAddress, uint16(math.Round(fan/control.Scale))); err != nil {
+			return err
+		}
+		s.fan = fan
+		return nil
+	}
+
+	// The registers are written one at a time. Raising the heat waits for the fan and
+	// lowering it goes first, so a failure halfway leaves the roaster on the safe side.
+	first, second := write_heat, write_fan
+	if heat > s.heat {
+		first, second = write_fan, write_heat
+	}
+	if err := first(); err != nil {
+		return err
+	}
+	if err := second(); err != nil {
+		return &PartialOutputError{Heat: s.heat, Fan: s.fan, Err: err}
+	}
+	return nil
+}
+
+// Run polls the device at the configured interval and hands every sample to out.
+// Read errors are logged and the source keeps retrying until stop is closed.
+func (s *ModbusSource) Run(out func(TempType), stop <-chan struct{}) error {
+	config := s.Config
+	client := NewModbusClient(config)
+	defer client.Close()
+
+	s.mu.Lock()
+	s.client = client
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(time.Duration(config.IntervalMs) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			temp, err := client.Read()
+			if err != nil {
+				log.Println("modbus read:", err)
+				continue
+			}
+			out(temp)
+		}
+	}
+}
+
+// modbusTCPTransport frames PDUs with the MBAP header of Modbus TCP.
+type modbusTCPTransport struct {
+	conn           net.Conn
+	timeout        time.Duration
+	transaction_id uint16
+}
+
+func (t *modbusTCPTransport) Send(slave_id byte, pdu []byte) ([]byte, error) {
+	t.transaction_id++
+
+	req := make([]byte, 7+len(pdu))
+	binary.BigEndian.PutUint16(req[0:], t.transaction_id)
+	binary.BigEndian.PutUint16(req[2:], 0)
+	binary.BigEndian.PutUint16(req[4:], uint16(len(pdu)+1))
+	req[6] = slave_id
+	copy(req[7:], pdu)
+
+	t.conn.SetDeadline(time.Now().Add(t.timeout))
+
+	if _, err := t.conn.Write(req); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(t.conn, header); err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint16(header[0:]) != t.transaction_id {
+		return nil, errors.New("modbus: transaction id inesperado")
+	}
+
+	length := binary.BigEndian.Uint16(header[4:])
+	if length < 2 || length > 254 {
+		return nil, errors.New("modbus: longitud invalida")
+	}
+
+	resp := make([]byte, length-1)
+	if _, err := io.ReadFull(t.conn, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (t *modbusTCPTransport) Close() error { return t.conn.Close() }
+
+// modbusRTUTransport frames PDUs with the slave address and CRC of Modbus RTU.
+type modbusRTUTransport struct {
+	port    serialPort
+	timeout time.Duration
+}
+
+func (t *modbusRTUTransport) Send(slave_id byte, pdu []byte) ([]byte, error) {
+	req := make([]byte, 0, len(pdu)+3)
+	req = append(req, slave_id)
+	req = append(req, pdu...)
+	req = binary.LittleEndian.AppendUint16(req, modbusCRC(req))
+
+	if _, err := t.port.Write(req); err != nil {
+		return nil, err
+	}
+
+	t.port.SetReadTimeout(t.timeout)
+
+	// Slave id, function code and the byte count, exception code or address high byte.
+	head := make([]byte, 3)
+	if _, err := io.ReadFull(t.port, head); err != nil {
+		return nil, err
+	}
+
+	rest, err := rtuRemainingLength(head)
+	if err != nil {
+		return nil, err
+	}
+	tail := make([]byte, rest)
+	if _, err := io.ReadFull(t.port, tail); err != nil {
+		return nil, err
+	}
+
+	frame := append(head, tail...)
+	n := len(frame)
+	if binary.LittleEndian.Uint16(frame[n-2:]) != modbusCRC(frame[:n-2]) {
+		return nil, errors.New("modbus: crc invalido")
+	}
+	if frame[0] != slave_id {
+		return nil, errors.New("modbus: respuesta de otro esclavo")
+	}
+
+	return frame[1 : n-2], nil
+}
+
+func (t *modbusRTUTransport) Close() error { return t.port.Close() }
+
+// rtuRemainingLength returns how many bytes of an RTU response follow its first three,
+// CRC included. Reads carry a byte count, writes echo a fixed 8-byte frame and
+// exceptions are 5 bytes long.
+func rtuRemainingLength(head []byte) (int, error) {
+	function := head[1]
+	switch {
+	case function&0x80 != 0:
+		return 2, nil
+	case function >= 0x01 && function <= 0x04:
+		return int(head[2]) + 2, nil
+	case function == 0x05 || function == 0x06 || function == 0x0F || function == 0x10:
+		return 8 - 3, nil
+	}
+	return 0, fmt.Errorf("modbus: funcion %#02x no soportada", function)
+}
+
+// modbusCRC computes the CRC-16/MODBUS checksum of data.
+func modbusCRC(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for range 8 {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
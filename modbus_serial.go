@@ -0,0 +1,12 @@
+package main
+
+import (
+	"io"
+	"time"
+)
+
+// serialPort is a raw serial line used by the Modbus RTU transport.
+type serialPort interface {
+	io.ReadWriteCloser
+	SetReadTimeout(timeout time.Duration) error
+}
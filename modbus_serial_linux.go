@@ -0,0 +1,94 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// linuxSerialPort is a tty configured in raw 8N1 mode through termios.
+type linuxSerialPort struct {
+	file *os.File
+}
+
+// serialBauds maps the supported speeds to their termios constants.
+var serialBauds = map[int]uint32{
+	1200:   syscall.B1200,
+	2400:   syscall.B2400,
+	4800:   syscall.B4800,
+	9600:   syscall.B9600,
+	19200:  syscall.B19200,
+	38400:  syscall.B38400,
+	57600:  syscall.B57600,
+	115200: syscall.B115200,
+}
+
+// openSerialPort opens device in raw 8N1 mode at the given baud rate.
+func openSerialPort(device string, baud int) (serialPort, error) {
+	speed, ok := serialBauds[baud]
+	if !ok {
+		return nil, fmt.Errorf("baud rate no soportado: %d", baud)
+	}
+
+	file, err := os.OpenFile(device, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	termios := syscall.Termios{
+		Cflag:  speed | syscall.CS8 | syscall.CREAD | syscall.CLOCAL,
+		Ispeed: speed,
+		Ospeed: speed,
+	}
+	termios.Cc[syscall.VMIN] = 0
+	termios.Cc[syscall.VTIME] = 10
+
+	port := &linuxSerialPort{file: file}
+	if err := port.setTermios(&termios); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return port, nil
+}
+
+func (p *linuxSerialPort) setTermios(termios *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, p.file.Fd(), uintptr(syscall.TCSETS), uintptr(unsafe.Pointer(termios)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// SetReadTimeout sets the inter-byte timeout; termios counts it in tenths of a second.
+func (p *linuxSerialPort) SetReadTimeout(timeout time.Duration) error {
+	var termios syscall.Termios
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, p.file.Fd(), uintptr(syscall.TCGETS), uintptr(unsafe.Pointer(&termios)))
+	if errno != 0 {
+		return errno
+	}
+
+	deciseconds := max(min(timeout.Milliseconds()/100, 255), 1)
+	termios.Cc[syscall.VMIN] = 0
+	termios.Cc[syscall.VTIME] = uint8(deciseconds)
+
+	return p.setTermios(&termios)
+}
+
+// Read returns an error instead of (0, nil) when the read timeout expires.
+func (p *linuxSerialPort) Read(b []byte) (int, error) {
+	n, err := p.file.Read(b)
+	if n == 0 && err == nil {
+		return 0, errors.New("serial: timeout de lectura")
+	}
+	return n, err
+}
+
+func (p *linuxSerialPort) Write(b []byte) (int, error) { return p.file.Write(b) }
+
+func (p *linuxSerialPort) Close() error { return p.file.Close() }
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// openSerialPort is only implemented for linux.
+func openSerialPort(device string, baud int) (serialPort, error) {
+	return nil, errors.New("modbus rtu solo esta soportado en linux")
+}
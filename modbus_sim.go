@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// ModbusSimulator is a Modbus TCP slave serving simulated temperatures on the
+// registers of a ModbusConfig, so the driver can be tested without hardware.
+type ModbusSimulator struct {
+	config   *ModbusConfig
+	holding  map[uint16]uint16
+	input    map[uint16]uint16
+	mu       sync.RWMutex
+	listener net.Listener
+	model    *RoastModel
+}
+
+// NewModbusSimulator creates a simulator for the register map of config.
+func NewModbusSimulator(config *ModbusConfig) *ModbusSimulator {
+	return &ModbusSimulator{
+		config:  config,
+		holding: map[uint16]uint16{},
+		input:   map[uint16]uint16{},
+		model:   NewRoastModel(DefaultSimConfig()),
+	}
+}
+
+// DefaultModbusSimConfig returns a register map with "bt" and "et" as tenths of a degree,
+// the layout of most PID controllers.
+func DefaultModbusSimConfig(address string) *ModbusConfig {
+	return &ModbusConfig{
+		Mode:       "tcp",
+		Address:    address,
+		SlaveId:    1,
+		IntervalMs: 1000,
+		TimeoutMs:  1000,
+		Unit:       "C",
+		Registers: []ModbusRegister{
+			{Channel: "bt", Address: 0, Function: "holding", Type: "int16", Scale: 0.1, Primary: true},
+			{Channel: "et", Address: 1, Function: "holding", Type: "int16", Scale: 0.1},
+		},
+	}
+}
+
+// ListenAndServe listens on address and serves Modbus TCP requests until the listener is closed.
+func (s *ModbusSimulator) ListenAndServe(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	log.Printf("simulador modbus escuchando en %s", listener.Addr())
+
+	go s.update()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.serve(conn)
+	}
+}
+
+// Close stops the simulator.
+func (s *ModbusSimulator) Close() error {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+// update advances the roast model and refreshes the register bank once per second.
+// Channels named "et" serve the environment temperature, any other the bean temperature.
+func (s *ModbusSimulator) update() {
+	for {
+		s.model.Step(1)
+		bt, et := s.model.Reading()
+
+		s.mu.Lock()
+		for _, reg := range s.config.Registers {
+			bank := s.holding
+			if reg.Function == "input" {
+				bank = s.input
+			}
+			value := bt
+			if reg.Channel == "et" {
+				value = et
+			}
+			for i, word := range reg.Encode(value, s.config.WordSwap) {
+				bank[reg.Address+uint16(i)] = word
+			}
+		}
+		s.mu.Unlock()
+
+		time.Sleep(time.Second)
+	}
+}
+
+// serve answers the requests of one client connection.
+func (s *ModbusSimulator) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		header := make([]byte, 7)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+
+		length := binary.BigEndian.Uint16(header[4:])
+		if length < 2 || length > 254 {
+			return
+		}
+		pdu := make([]byte, length-1)
+		if _, err := io.ReadFull(conn, pdu); err != nil {
+			return
+		}
+
+		resp := s.handle(pdu)
+
+		out := make([]byte, 7+len(resp))
+		copy(out, header[:4])
+		binary.BigEndian.PutUint16(out[4:], uint16(len(resp)+1))
+		out[6] = header[6]
+		copy(out[7:], resp)
+
+		if _, err := conn.Write(out); err != nil {
+			return
+		}
+	}
+}
+
+// handle executes a request PDU and returns the response PDU.
+func (s *ModbusSimulator) handle(pdu []byte) []byte {
+	function := pdu[0]
+
+	var bank map[uint16]uint16
+	switch function {
+	case modbusWriteSingleRegister:
+		return s.write(pdu)
+	case modbusReadHoldingRegisters:
+		bank = s.holding
+	case modbusReadInputRegisters:
+		bank = s.input
+	default:
+		// Illegal function.
+		return []byte{function | 0x80, 0x01}
+	}
+
+	if len(pdu) != 5 {
+		// Illegal data value.
+		return []byte{function | 0x80, 0x03}
+	}
+
+	address := binary.BigEndian.Uint16(pdu[1:])
+	quantity := binary.BigEndian.Uint16(pdu[3:])
+	if quantity == 0 || quantity > 125 {
+		return []byte{function | 0x80, 0x03}
+	}
+
+	resp := make([]byte, 2+quantity*2)
+	resp[0] = function
+	resp[1] = byte(quantity * 2)
+
+	s.mu.RLock()
+	for i := range quantity {
+		binary.BigEndian.PutUint16(resp[2+i*2:], bank[address+i])
+	}
+	s.mu.RUnlock()
+
+	return resp
+}
+
+// write stores a holding register and, when it is one of the control registers of the
+// config, drives the heat or airflow of the model.
+func (s *ModbusSimulator) write(pdu []byte) []byte {
+	if len(pdu) != 5 {
+		return []byte{pdu[0] | 0x80, 0x03}
+	}
+
+	address := binary.BigEndian.Uint16(pdu[1:])
+	value := binary.BigEndian.Uint16(pdu[3:])
+
+	s.mu.Lock()
+	s.holding[address] = value
+	s.mu.Unlock()
+
+	if control := s.config.Control; control != nil {
+		heat, airflow := s.model.Inputs()
+		switch address {
+		case control.HeatAddress:
+			s.model.SetInputs(float64(value)*control.Scale, airflow)
+		case control.FanAddress:
+			s.model.SetInputs(heat, float64(value)*control.Scale)
+		}
+	}
+
+	// The response echoes the request.
+	return pdu
+}
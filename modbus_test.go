@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestModbusCRC(t *testing.T) {
+	tests := []struct {
+		frame []byte
+		want  uint16
+	}{
+		{[]byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x0A}, 0xCDC5},
+		{[]byte{0x01, 0x06, 0x00, 0x01, 0x00, 0x03}, 0x0B98},
+		{[]byte{0x11, 0x03, 0x00, 0x6B, 0x00, 0x03}, 0x8776},
+	}
+	for _, test := range tests {
+		if got := modbusCRC(test.frame); got != test.want {
+			t.Errorf("modbusCRC(% x) = %#04x, want %#04x", test.frame, got, test.want)
+		}
+	}
+}
+
+// fakeSerialPort answers every request with a canned response and records the requests.
+type fakeSerialPort struct {
+	written  bytes.Buffer
+	response *bytes.Reader
+}
+
+func (p *fakeSerialPort) Read(b []byte) (int, error)           { return p.response.Read(b) }
+func (p *fakeSerialPort) Write(b []byte) (int, error)          { return p.written.Write(b) }
+func (p *fakeSerialPort) Close() error                         { return nil }
+func (p *fakeSerialPort) SetReadTimeout(d time.Duration) error { return nil }
+
+// rtuFrame appends the CRC to a slave id and PDU.
+func rtuFrame(data ...byte) []byte {
+	return binary.LittleEndian.AppendUint16(data, modbusCRC(data))
+}
+
+func newRTUTestClient(response []byte) (*ModbusClient, *fakeSerialPort) {
+	port := &fakeSerialPort{response: bytes.NewReader(response)}
+	client := &ModbusClient{
+		config:    &ModbusConfig{SlaveId: 1},
+		transport: &modbusRTUTransport{port: port, timeout: time.Second},
+	}
+	return client, port
+}
+
+func TestModbusRTUReadRegisters(t *testing.T) {
+	tests := []struct {
+		name     string
+		function byte
+		response []byte
+		want     []uint16
+		wantErr  bool
+	}{
+		{"holding", modbusReadHoldingRegisters, rtuFrame(0x01, 0x03, 0x04, 0x00, 0xC8, 0x01, 0x2C), []uint16{200, 300}, false},
+		{"input", modbusReadInputRegisters, rtuFrame(0x01, 0x04, 0x04, 0xFF, 0xFF, 0x00, 0x01), []uint16{0xFFFF, 1}, false},
+		{"exception", modbusReadHoldingRegisters, rtuFrame(0x01, 0x83, 0x02), nil, true},
+		{"bad crc", modbusReadHoldingRegisters, []byte{0x01, 0x03, 0x04, 0x00, 0xC8, 0x01, 0x2C, 0x00, 0x00}, nil, true},
+		{"other slave", modbusReadHoldingRegisters, rtuFrame(0x02, 0x03, 0x04, 0x00, 0xC8, 0x01, 0x2C), nil, true},
+		{"short count", modbusReadHoldingRegisters, rtuFrame(0x01, 0x03, 0x02, 0x00, 0xC8), nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, port := newRTUTestClient(test.response)
+			words, err := client.ReadRegisters(test.function, 0x10, 2)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, test.wantErr)
+			}
+			if !slices.Equal(words, test.want) {
+				t.Errorf("words = %v, want %v", words, test.want)
+			}
+			want := rtuFrame(0x01, test.function, 0x00, 0x10, 0x00, 0x02)
+			if !bytes.Equal(port.written.Bytes(), want) {
+				t.Errorf("request = % x, want % x", port.written.Bytes(), want)
+			}
+		})
+	}
+}
+
+func TestModbusRTUWriteRegister(t *testing.T) {
+	tests := []struct {
+		name     string
+		address  uint16
+		value    uint16
+		response []byte
+		wantErr  bool
+	}{
+		// The reply echoes address and value, so the byte after the function code is not a count.
+		{"echo", 0x0020, 500, rtuFrame(0x01, 0x06, 0x00, 0x20, 0x01, 0xF4), false},
+		{"echo high address", 0x0120, 0, rtuFrame(0x01, 0x06, 0x01, 0x20, 0x00, 0x00), false},
+		{"exception", 0x0020, 500, rtuFrame(0x01, 0x86, 0x03), true},
+		{"bad crc", 0x0020, 500, []byte{0x01, 0x06, 0x00, 0x20, 0x01, 0xF4, 0x12, 0x34}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, port := newRTUTestClient(test.response)
+			err := client.WriteRegister(test.address, test.value)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, test.wantErr)
+			}
+			want := rtuFrame(0x01, 0x06, byte(test.address>>8), byte(test.address), byte(test.value>>8), byte(test.value))
+			if !bytes.Equal(port.written.Bytes(), want) {
+				t.Errorf("request = % x, want % x", port.written.Bytes(), want)
+			}
+		})
+	}
+}
+
+func TestRTURemainingLength(t *testing.T) {
+	tests := []struct {
+		head    []byte
+		want    int
+		wantErr bool
+	}{
+		{[]byte{0x01, 0x01, 0x01}, 3, false},
+		{[]byte{0x01, 0x03, 0x06}, 8, false},
+		{[]byte{0x01, 0x04, 0x02}, 4, false},
+		{[]byte{0x01, 0x05, 0x00}, 5, false},
+		{[]byte{0x01, 0x06, 0xFF}, 5, false},
+		{[]byte{0x01, 0x0F, 0x00}, 5, false},
+		{[]byte{0x01, 0x10, 0x00}, 5, false},
+		{[]byte{0x01, 0x83, 0x02}, 2, false},
+		{[]byte{0x01, 0x2B, 0x00}, 0, true},
+	}
+	for _, test := range tests {
+		got, err := rtuRemainingLength(test.head)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("rtuRemainingLength(% x) = %d, %v; want %d", test.head, got, err, test.want)
+		}
+	}
+}
+
+func TestModbusSetOutputsOrder(t *testing.T) {
+	const heat_address, fan_address = 0x10, 0x11
+	tests := []struct {
+		name      string
+		heat, fan float64
+		responses [][]byte
+		want      []uint16 // The addresses written, in order.
+		wantErr   bool
+		partial   *PartialOutputError
+	}{
+		{"raise heat writes fan first", 80, 40,
+			[][]byte{rtuFrame(0x01, 0x06, 0x00, fan_address, 0x00, 40), rtuFrame(0x01, 0x06, 0x00, heat_address, 0x00, 80)},
+			[]uint16{fan_address, heat_address}, false, nil},
+		{"lower heat writes heat first", 0, 40,
+			[][]byte{rtuFrame(0x01, 0x06, 0x00, heat_address, 0x00, 0), rtuFrame(0x01, 0x06, 0x00, fan_address, 0x00, 40)},
+			[]uint16{heat_address, fan_address}, false, nil},
+		{"second write fails", 80, 40,
+			[][]byte{rtuFrame(0x01, 0x06, 0x00, fan_address, 0x00, 40), rtuFrame(0x01, 0x86, 0x04)},
+			[]uint16{fan_address, heat_address}, true, &PartialOutputError{Heat: 0, Fan: 40}},
+		{"first write fails", 80, 40,
+			[][]byte{rtuFrame(0x01, 0x86, 0x04)},
+			[]uint16{fan_address}, true, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, port := newRTUTestClient(bytes.Join(test.responses, nil))
+			source := &ModbusSource{
+				Config: &ModbusConfig{Control: &ModbusControl{HeatAddress: heat_address, FanAddress: fan_address, Scale: 1}},
+				client: client,
+			}
+			err := source.SetOutputs(test.heat, test.fan)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, test.wantErr)
+			}
+
+			var partial *PartialOutputError
+			if errors.As(err, &partial) != (test.partial != nil) {
+				t.Fatalf("err = %v, want partial %v", err, test.partial)
+			}
+			if partial != nil && (partial.Heat != test.partial.Heat || partial.Fan != test.partial.Fan) {
+				t.Errorf("partial = heat %v fan %v, want heat %v fan %v", partial.Heat, partial.Fan, test.partial.Heat, test.partial.Fan)
+			}
+
+			var written []uint16
+			for request := port.written.Bytes(); len(request) >= 8; request = request[8:] {
+				written = append(written, binary.BigEndian.Uint16(request[2:]))
+			}
+			if !slices.Equal(written, test.want) {
+				t.Errorf("written = %#x, want %#x", written, test.want)
+			}
+		})
+	}
+}
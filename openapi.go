@@ -0,0 +1,485 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// openapi_json is the OpenAPI 3 description of the REST API, served at
+// /api/v1/openapi.json and used to validate the requests.
+//
+//go:embed openapi.json
+var openapi_json []byte
+
+const max_body_bytes = 1 << 20
+
+// Schema is the subset of the OpenAPI schema object the validator understands.
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Nullable             bool               `json:"nullable"`
+	Enum                 []any              `json:"enum"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	MinItems             *int               `json:"minItems"`
+	Items                *Schema            `json:"items"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties *Schema            `json:"-"` // The schema of the other properties, nil for any.
+	Closed               bool               `json:"-"` // additionalProperties: false.
+}
+
+// UnmarshalJSON reads additionalProperties, which is a boolean or a schema.
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	type plain Schema
+	var raw struct {
+		plain
+		AdditionalProperties json.RawMessage `json:"additionalProperties"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*s = Schema(raw.plain)
+	switch v := string(bytes.TrimSpace(raw.AdditionalProperties)); {
+	case v == "false":
+		s.Closed = true
+	case strings.HasPrefix(v, "{"):
+		s.AdditionalProperties = &Schema{}
+		return json.Unmarshal(raw.AdditionalProperties, s.AdditionalProperties)
+	}
+	return nil
+}
+
+// Parameter is a path, query or header parameter of an operation.
+type Parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+// Operation is a method on a path of the API.
+type Operation struct {
+	Id          string                 `json:"operationId"`
+	Permission  string                 `json:"x-permission"` // The permission it needs, "" when any login will do.
+	Security    *[]map[string][]string `json:"security"`     // An empty list for the operations open without login.
+	Parameters  []Parameter            `json:"parameters"`
+	RequestBody *struct {
+		Required bool `json:"required"`
+		Content  map[string]struct {
+			Schema *Schema `json:"schema"`
+		} `json:"content"`
+	} `json:"requestBody"`
+}
+
+// Public reports whether the operation is open without login.
+func (op *Operation) Public() bool {
+	return op.Security != nil && len(*op.Security) == 0
+}
+
+// apiRoute is a path template of the API with its operations by method.
+type apiRoute struct {
+	segments   []string // The path split on "/"; "{name}" segments match any value.
+	literals   int      // The segments that are not parameters; more specific routes win.
+	operations map[string]*Operation
+}
+
+// APISpec is the parsed OpenAPI document.
+type APISpec struct {
+	routes     []*apiRoute
+	schemas    map[string]*Schema
+	parameters map[string]*Parameter
+}
+
+// LoadAPISpec parses an OpenAPI document.
+func LoadAPISpec(data []byte) (*APISpec, error) {
+	var doc struct {
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas    map[string]*Schema    `json:"schemas"`
+			Parameters map[string]*Parameter `json:"parameters"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	spec := &APISpec{schemas: doc.Components.Schemas, parameters: doc.Components.Parameters}
+	for path, item := range doc.Paths {
+		route := &apiRoute{segments: strings.Split(path, "/"), operations: map[string]*Operation{}}
+		for _, segment := range route.segments {
+			if !strings.HasPrefix(segment, "{") {
+				route.literals++
+			}
+		}
+
+		var shared []Parameter
+		if raw, ok := item["parameters"]; ok {
+			if err := json.Unmarshal(raw, &shared); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+		for method, raw := range item {
+			if method == "parameters" {
+				continue
+			}
+			var op Operation
+			if err := json.Unmarshal(raw, &op); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", method, path, err)
+			}
+			op.Parameters = append(slices.Clone(shared), op.Parameters...)
+			route.operations[strings.ToUpper(method)] = &op
+		}
+		spec.routes = append(spec.routes, route)
+	}
+	return spec, nil
+}
+
+// api_spec is the spec of the REST API.
+var api_spec = mustLoadAPISpec()
+
+func mustLoadAPISpec() *APISpec {
+	spec, err := LoadAPISpec(openapi_json)
+	if err != nil {
+		log.Fatalln("openapi.json invalido,", err)
+	}
+	return spec
+}
+
+// Find returns the route matching a request path and the values of its path parameters.
+func (s *APISpec) Find(path string) (*apiRoute, map[string]string) {
+	segments := strings.Split(path, "/")
+	var best *apiRoute
+	var best_values map[string]string
+	for _, route := range s.routes {
+		if len(route.segments) != len(segments) || (best != nil && route.literals <= best.literals) {
+			continue
+		}
+		values := map[string]string{}
+		ok := true
+		for i, segment := range route.segments {
+			if name, is_param := strings.CutPrefix(segment, "{"); is_param {
+				if segments[i] == "" {
+					ok = false
+					break
+				}
+				values[strings.TrimSuffix(name, "}")] = segments[i]
+			} else if segment != segments[i] {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			best, best_values = route, values
+		}
+	}
+	return best, best_values
+}
+
+// resolve follows a $ref to a component schema.
+func (s *APISpec) resolve(schema *Schema) *Schema {
+	for schema != nil && schema.Ref != "" {
+		schema = s.schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+	}
+	return schema
+}
+
+// ValidateRequest checks the parameters and the body of a request against its
+// operation. It returns the HTTP status and message of the first problem, or 0.
+// The body is read and put back for the handler.
+func (s *APISpec) ValidateRequest(r *http.Request, op *Operation, path_values map[string]string) (int, string) {
+	query := r.URL.Query()
+	for _, param := range op.Parameters {
+		if param.Ref != "" {
+			param = *s.parameters[strings.TrimPrefix(param.Ref, "#/components/parameters/")]
+		}
+
+		var values []string
+		switch param.In {
+		case "path":
+			values = []string{path_values[param.Name]}
+		case "query":
+			values = query[param.Name]
+		case "header":
+			if v := r.Header.Get(param.Name); v != "" {
+				values = []string{v}
+			}
+		}
+		if len(values) == 0 {
+			if param.Required {
+				return http.StatusBadRequest, "falta el parametro " + param.Name
+			}
+			continue
+		}
+		if err := s.validateParam(param, values); err != nil {
+			return http.StatusBadRequest, err.Error()
+		}
+	}
+
+	if op.RequestBody == nil {
+		return 0, ""
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, max_body_bytes))
+	r.Body.Close()
+	if err != nil {
+		return http.StatusRequestEntityTooLarge, fmt.Sprintf("el body admite hasta %d bytes", max_body_bytes)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if len(bytes.TrimSpace(body)) == 0 {
+		if op.RequestBody.Required {
+			return http.StatusBadRequest, "se requiere un body JSON"
+		}
+		return 0, ""
+	}
+	if content_type := r.Header.Get("Content-Type"); content_type != "" {
+		if media, _, err := mime.ParseMediaType(content_type); err != nil || media != "application/json" {
+			return http.StatusUnsupportedMediaType, "el body debe ser application/json"
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil || decoder.More() {
+		return http.StatusBadRequest, "body JSON invalido"
+	}
+	if err := s.validateValue(op.RequestBody.Content["application/json"].Schema, value, "body"); err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	return 0, ""
+}
+
+// validateParam checks the values of a parameter. Arrays are comma separated or repeated.
+func (s *APISpec) validateParam(param Parameter, values []string) error {
+	schema := s.resolve(param.Schema)
+	if schema == nil {
+		return nil
+	}
+	if schema.Type == "array" {
+		items := strings.Split(strings.Join(values, ","), ",")
+		for _, item := range items {
+			if err := s.validateValue(schema.Items, paramValue(s.resolve(schema.Items), strings.TrimSpace(item)), param.Name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return s.validateValue(schema, paramValue(schema, values[0]), param.Name)
+}
+
+// paramValue converts the text of a parameter to the type of its schema, so it is
+// validated like a JSON value. Values that do not convert are left as text and fail.
+func paramValue(schema *Schema, v string) any {
+	if schema == nil {
+		return v
+	}
+	switch schema.Type {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(v, 64); err == nil {
+			return json.Number(v)
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return v
+}
+
+// validateValue checks a decoded JSON value (numbers as json.Number) against a schema.
+// name is the path of the value, for the error message.
+func (s *APISpec) validateValue(schema *Schema, value any, name string) error {
+	schema = s.resolve(schema)
+	if schema == nil {
+		return nil
+	}
+	if value == nil {
+		if schema.Nullable || schema.Type == "" {
+			return nil
+		}
+		return errors.New(name + " no puede ser null")
+	}
+
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return errors.New(name + " debe ser un objeto")
+		}
+		for _, field := range schema.Required {
+			if _, ok := object[field]; !ok {
+				return errors.New("falta " + name + "." + field)
+			}
+		}
+		fields := make([]string, 0, len(object))
+		for field := range object {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			property, ok := schema.Properties[field]
+			if !ok {
+				if schema.Closed {
+					return errors.New("campo desconocido: " + name + "." + field)
+				}
+				property = schema.AdditionalProperties
+			}
+			if err := s.validateValue(property, object[field], name+"."+field); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return errors.New(name + " debe ser una lista")
+		}
+		if schema.MinItems != nil && len(items) < *schema.MinItems {
+			return fmt.Errorf("%s debe tener al menos %d elementos", name, *schema.MinItems)
+		}
+		for i, item := range items {
+			if err := s.validateValue(schema.Items, item, fmt.Sprintf("%s[%d]", name, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			return errors.New(name + " debe ser un texto")
+		}
+		if n := utf8.RuneCountInString(text); schema.MinLength != nil && n < *schema.MinLength {
+			if *schema.MinLength == 1 {
+				return errors.New(name + " no puede estar vacio")
+			}
+			return fmt.Errorf("%s debe tener al menos %d caracteres", name, *schema.MinLength)
+		} else if schema.MaxLength != nil && n > *schema.MaxLength {
+			return fmt.Errorf("%s admite hasta %d caracteres", name, *schema.MaxLength)
+		}
+	case "integer", "number":
+		number, ok := value.(json.Number)
+		if !ok {
+			return errors.New(name + " debe ser un numero")
+		}
+		f, err := number.Float64()
+		if err != nil {
+			return errors.New(name + " debe ser un numero")
+		}
+		if schema.Type == "integer" {
+			if _, err := strconv.ParseInt(number.String(), 10, 64); err != nil {
+				return errors.New(name + " debe ser un entero")
+			}
+		}
+		if schema.Minimum != nil && f < *schema.Minimum {
+			return fmt.Errorf("%s debe ser al menos %v", name, *schema.Minimum)
+		}
+		if schema.Maximum != nil && f > *schema.Maximum {
+			return fmt.Errorf("%s debe ser como mucho %v", name, *schema.Maximum)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return errors.New(name + " debe ser true o false")
+		}
+	}
+
+	if len(schema.Enum) > 0 {
+		for _, allowed := range schema.Enum {
+			if fmt.Sprint(allowed) == fmt.Sprint(value) {
+				return nil
+			}
+		}
+		options := make([]string, len(schema.Enum))
+		for i, allowed := range schema.Enum {
+			options[i] = fmt.Sprint(allowed)
+		}
+		return errors.New(name + " debe ser uno de: " + strings.Join(options, ", "))
+	}
+	return nil
+}
+
+// validateRequests checks the requests to /api/v1/ against the OpenAPI spec before they
+// reach next. The login and the permission of the operation are checked first, so
+// only authorized users learn about the API: 401 and 403 come before unknown paths
+// (404), unknown methods (405) and invalid parameters or bodies (400, 415 for bodies
+// that are not JSON), all with a JSON error body.
+func validateRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/v1/") || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		route, path_values := api_spec.Find(r.URL.Path)
+		method := r.Method
+		if method == http.MethodHead {
+			method = http.MethodGet
+		}
+		var op *Operation
+		if route != nil {
+			op = route.operations[method]
+		}
+
+		if auth_enabled && (op == nil || !op.Public()) {
+			user, err := authenticate(r)
+			if err != nil {
+				enabeCORS(w)
+				writeJSONError(w, http.StatusUnauthorized, err.Error())
+				return
+			}
+			if op != nil && op.Permission != "" && !HasPermission(user, op.Permission) {
+				log.Printf("permiso %s denegado a %s (%s) en %s %s", op.Permission, user.Actor(), user.Role, r.Method, r.URL.Path)
+				enabeCORS(w)
+				writeJSONError(w, http.StatusForbidden, "permiso denegado: se requiere "+op.Permission)
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), user_ctx_key{}, user))
+		}
+
+		if route == nil {
+			enabeCORS(w)
+			writeJSONError(w, http.StatusNotFound, "ruta desconocida: "+r.URL.Path)
+			return
+		}
+		if op == nil {
+			methods := make([]string, 0, len(route.operations))
+			for m := range route.operations {
+				methods = append(methods, m)
+			}
+			sort.Strings(methods)
+			enabeCORS(w)
+			w.Header().Set("Allow", strings.Join(methods, ", "))
+			writeJSONError(w, http.StatusMethodNotAllowed, "metodo no permitido: "+r.Method)
+			return
+		}
+
+		if status, msg := api_spec.ValidateRequest(r, op, path_values); status != 0 {
+			enabeCORS(w)
+			writeJSONError(w, status, msg)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// openAPIHandler serves the OpenAPI spec.
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openapi_json)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// validated returns the status of a request through validateRequests, 200 when it
+// reaches the handler.
+func validated(method, target, content_type, body string) (int, string) {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if content_type != "" {
+		r.Header.Set("Content-Type", content_type)
+	}
+	w := httptest.NewRecorder()
+	validateRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+	return w.Code, w.Body.String()
+}
+
+func TestValidateRequests(t *testing.T) {
+	withAuth(t, false)
+	const json_type = "application/json"
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"not the api", "GET", "/index.html", "", "", 200},
+		{"valid query", "GET", "/api/v1/temp/roast_sessions?sort=score&order=asc&limit=10", "", "", 200},
+		{"head as get", "HEAD", "/api/v1/temp/roast_sessions", "", "", 200},
+		{"preflight", "OPTIONS", "/api/v1/nope", "", "", 200},
+		{"unknown path", "GET", "/api/v1/nope", "", "", 404},
+		{"unknown method", "PATCH", "/api/v1/control/pid", "", "", 405},
+		{"enum", "GET", "/api/v1/temp/roast_sessions?sort=name", "", "", 400},
+		{"minimum", "GET", "/api/v1/temp/roast_sessions?limit=0", "", "", 400},
+		{"integer", "GET", "/api/v1/temp/roast_sessions?limit=diez", "", "", 400},
+		{"path parameter", "GET", "/api/v1/temp/marks/abc", "", "", 400},
+		{"valid body", "POST", "/api/v1/auth/login", json_type, `{"username":"ana","password":"x"}`, 200},
+		{"missing body", "POST", "/api/v1/auth/login", json_type, "", 400},
+		{"not json", "POST", "/api/v1/auth/login", "text/plain", `username=ana`, 415},
+		{"malformed json", "POST", "/api/v1/auth/login", json_type, `{"username":`, 400},
+		{"required property", "POST", "/api/v1/auth/login", json_type, `{"username":"ana"}`, 400},
+		{"min length", "POST", "/api/v1/auth/login", json_type, `{"username":"","password":"x"}`, 400},
+		{"property enum", "POST", "/api/v1/auth/login", json_type, `{"username":"ana","password":"x","role":"root"}`, 400},
+		{"closed object", "PUT", "/api/v1/temp/marks/3", json_type, `{"mark_name":"FC","color":"red"}`, 400},
+		{"property type", "PUT", "/api/v1/temp/marks/3", json_type, `{"create_at":"ayer"}`, 400},
+		{"nested items", "POST", "/api/v1/control/pid", json_type, `{"curve":[{"t":0,"value":100},{"t":10}]}`, 400},
+		{"maximum", "POST", "/api/v1/control/pid", json_type, `{"fan":120}`, 400},
+		{"valid nested", "POST", "/api/v1/control/pid", json_type, `{"curve":[{"t":0,"value":100}],"fan":40}`, 200},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, body := validated(test.method, test.target, test.contentType, test.body)
+			if status != test.want {
+				t.Errorf("status = %d, want %d (%s)", status, test.want, body)
+			}
+			if status != 200 && !strings.Contains(body, `"error":true`) {
+				t.Errorf("body = %s, want a JSON error", body)
+			}
+		})
+	}
+}
+
+func TestValidateRequestsAfterAuth(t *testing.T) {
+	withAuth(t, true)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		// Without login nothing about the API is revealed, not even whether a path exists.
+		{"unknown path", "GET", "/api/v1/nope", "", 401},
+		{"unknown method", "PATCH", "/api/v1/control/pid", "", 401},
+		{"invalid query", "GET", "/api/v1/temp/roast_sessions?sort=name", "", 401},
+		{"invalid body", "POST", "/api/v1/control/pid", `{"fan":120}`, 401},
+		// Public operations are still validated.
+		{"public, invalid", "POST", "/api/v1/auth/login", `{"username":"ana"}`, 400},
+		{"public, valid", "POST", "/api/v1/auth/login", `{"username":"ana","password":"x"}`, 200},
+		{"public spec", "GET", "/api/v1/openapi.json", "", 200},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if status, body := validated(test.method, test.target, "application/json", test.body); status != test.want {
+				t.Errorf("status = %d, want %d (%s)", status, test.want, body)
+			}
+		})
+	}
+}
+
+func TestOperationPermissions(t *testing.T) {
+	public := map[string]bool{"GET /api/v1/openapi.json": true, "POST /api/v1/auth/login": true, "POST /api/v1/auth/logout": true}
+	for _, route := range api_spec.routes {
+		path := strings.Join(route.segments, "/")
+		for method, op := range route.operations {
+			key := method + " " + path
+			if op.Public() != public[key] {
+				t.Errorf("%s public = %v, want %v", key, op.Public(), public[key])
+			}
+			// Outside the account routes, where any login will do, every operation names its permission.
+			if !op.Public() && op.Permission == "" && !strings.HasPrefix(path, "/api/v1/auth/") {
+				t.Errorf("%s has no x-permission", key)
+			}
+		}
+	}
+}
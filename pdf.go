@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// PDF page size (A4) in points.
+const (
+	pdf_page_w = 595.28
+	pdf_page_h = 841.89
+)
+
+// helvetica_widths are the widths of the ASCII characters of Helvetica, from 32 (space),
+// in thousandths of the font size.
+var helvetica_widths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// PDFDocument is a minimal PDF writer with the standard Helvetica fonts, enough to
+// draw reports with vector graphics. It implements Canvas on the current page.
+type PDFDocument struct {
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+}
+
+// NewPDFDocument creates a document with one empty page.
+func NewPDFDocument() *PDFDocument {
+	d := &PDFDocument{}
+	d.AddPage()
+	return d
+}
+
+// AddPage starts a new page; drawing goes to it.
+func (d *PDFDocument) AddPage() {
+	d.page = &bytes.Buffer{}
+	d.pages = append(d.pages, d.page)
+}
+
+// pdfColor converts a #rrggbb color to PDF color components.
+func pdfColor(color string) string {
+	v, err := strconv.ParseUint(strings.TrimPrefix(color, "#"), 16, 32)
+	if err != nil {
+		return "0 0 0"
+	}
+	return fmt.Sprintf("%.3f %.3f %.3f", float64(v>>16&0xff)/255, float64(v>>8&0xff)/255, float64(v&0xff)/255)
+}
+
+// pdfText encodes s in WinAnsi (Latin-1 for the characters used in reports) as a PDF
+// string literal.
+func pdfText(s string) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 32 && r < 127:
+			b.WriteRune(r)
+		case r >= 160 && r <= 255:
+			fmt.Fprintf(&b, "\\%03o", r)
+		case r == '\n' || r == '\t':
+			b.WriteByte(' ')
+		default:
+			b.WriteByte('?')
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// TextWidth returns the width of s in points at the given size.
+func TextWidth(s string, size float64, bold bool) float64 {
+	total := 0
+	for _, r := range s {
+		if r >= 32 && r < 127 {
+			total += helvetica_widths[r-32]
+		} else {
+			total += 556
+		}
+	}
+	w := float64(total) * size / 1000
+	if bold {
+		w *= 1.06
+	}
+	return w
+}
+
+// WrapText splits s in lines no wider than width.
+func WrapText(s string, size float64, width float64) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(s, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			next := word
+			if line != "" {
+				next = line + " " + word
+			}
+			if line != "" && TextWidth(next, size, false) > width {
+				lines = append(lines, line)
+				next = word
+			}
+			line = next
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func (d *PDFDocument) Line(x1, y1, x2, y2 float64, color string, width float64, dashed bool) {
+	dash := "[] 0 d"
+	if dashed {
+		dash = "[3 3] 0 d"
+	}
+	fmt.Fprintf(d.page, "%s RG %.2f w %s %.2f %.2f m %.2f %.2f l S\n", pdfColor(color), width, dash, x1, pdf_page_h-y1, x2, pdf_page_h-y2)
+}
+
+func (d *PDFDocument) Polyline(points [][2]float64, color string, width float64) {
+	if len(points) < 2 {
+		return
+	}
+	fmt.Fprintf(d.page, "%s RG %.2f w [] 0 d 1 j\n", pdfColor(color), width)
+	for i, p := range points {
+		op := "l"
+		if i == 0 {
+			op = "m"
+		}
+		fmt.Fprintf(d.page, "%.2f %.2f %s\n", p[0], pdf_page_h-p[1], op)
+	}
+	d.page.WriteString("S\n")
+}
+
+func (d *PDFDocument) Rect(x, y, w, h float64, fill string) {
+	fmt.Fprintf(d.page, "%s rg %.2f %.2f %.2f %.2f re f\n", pdfColor(fill), x, pdf_page_h-y-h, w, h)
+}
+
+func (d *PDFDocument) Text(x, y float64, size float64, color string, anchor string, bold bool, s string) {
+	switch anchor {
+	case "middle":
+		x -= TextWidth(s, size, bold) / 2
+	case "end":
+		x -= TextWidth(s, size, bold)
+	}
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(d.page, "BT %s rg /%s %.1f Tf %.2f %.2f Td %s Tj ET\n", pdfColor(color), font, size, x, pdf_page_h-y, pdfText(s))
+}
+
+// WriteTo writes the document.
+func (d *PDFDocument) WriteTo(w io.Writer) (int64, error) {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// 1: catalog, 2: pages, 3 and 4: fonts, then a page and its content for every page.
+	kids := []string{}
+	for i := range d.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 5+2*i))
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdf_page_w, pdf_page_h, 6+2*i))
+
+		var content bytes.Buffer
+		z := zlib.NewWriter(&content)
+		z.Write(page.Bytes())
+		z.Close()
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", len(offsets), content.Len())
+		out.Write(content.Bytes())
+		out.WriteString("\nendstream\nendobj\n")
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return out.WriteTo(w)
+}
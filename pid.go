@@ -0,0 +1,335 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// CurvePoint is a point of a target curve.
+type CurvePoint struct {
+	T     float64 `json:"t"`     // Seconds from the start of the curve.
+	Value float64 `json:"value"` // BT in degrees or RoR in degrees per minute, depending on the mode.
+}
+
+// PIDConfig selects the target curve and tunes the controller that follows it.
+type PIDConfig struct {
+	SessionId string       `json:"session_id,omitempty"` // Reference session whose BT (or RoR) curve is followed.
+	Curve     []CurvePoint `json:"curve,omitempty"`      // Recipe curve, used when no session is given.
+	Mode      string       `json:"mode"`                 // "bt" or "ror". Defaults to "bt".
+	Kp        float64      `json:"kp"`                   // Heat percent per degree (or degree/min) of error.
+	Ki        float64      `json:"ki"`                   // Heat percent per degree-second of accumulated error.
+	Kd        float64      `json:"kd"`                   // Heat percent per degree/second of PV change.
+	OutMin    float64      `json:"out_min"`              // Lowest heat the controller outputs.
+	OutMax    float64      `json:"out_max"`              // Highest heat the controller outputs.
+	Fan       float64      `json:"fan"`                  // Fan duty while following; 0 keeps the current one.
+	OffsetS   float64      `json:"offset_s"`             // Start this many seconds into the curve.
+}
+
+// DefaultPIDConfig returns gains that follow a BT curve on the simulator.
+func DefaultPIDConfig() PIDConfig {
+	return PIDConfig{Mode: "bt", Kp: 3, Ki: 0.03, Kd: 0, OutMin: 0, OutMax: 100}
+}
+
+// PID is a PID controller with derivative on measurement and anti-windup by
+// conditional integration and integrator clamping.
+type PID struct {
+	Kp, Ki, Kd     float64
+	OutMin, OutMax float64
+
+	integral float64
+	prev_pv  float64
+	has_prev bool
+}
+
+// Reset clears the integrator and derivative state.
+func (p *PID) Reset() {
+	p.integral = 0
+	p.has_prev = false
+}
+
+// Update returns the output for the setpoint and process value after dt seconds.
+func (p *PID) Update(setpoint float64, pv float64, dt float64) float64 {
+	err := setpoint - pv
+
+	derivative := 0.0
+	if p.has_prev && dt > 0 {
+		derivative = -(pv - p.prev_pv) / dt
+	}
+	p.prev_pv = pv
+	p.has_prev = true
+
+	unsaturated := p.Kp*err + p.Ki*(p.integral+err*dt) + p.Kd*derivative
+	out := math.Max(p.OutMin, math.Min(p.OutMax, unsaturated))
+
+	// Only integrate while the output is not saturated in the direction of the error.
+	if out == unsaturated || (unsaturated > p.OutMax && err < 0) || (unsaturated < p.OutMin && err > 0) {
+		p.integral += err * dt
+	}
+	if p.Ki != 0 {
+		limit := (p.OutMax - p.OutMin) / p.Ki
+		p.integral = math.Max(-limit, math.Min(limit, p.integral))
+	}
+
+	return out
+}
+
+// PIDLog is the state of the profile follower at one sample.
+type PIDLog struct {
+	TimeStamp int64   `json:"timestamp"` // The timestamp of the sample.
+	Setpoint  float64 `json:"setpoint"`  // The target value.
+	PV        float64 `json:"pv"`        // The measured value (BT or RoR).
+	Output    float64 `json:"output"`    // The heat applied.
+	Mode      string  `json:"mode"`      // "auto" or "manual".
+}
+
+// ProfileFollower drives the heat with a PID controller so the roast follows a target curve.
+type ProfileFollower struct {
+	mu       sync.Mutex
+	config   PIDConfig
+	curve    []CurvePoint
+	pid      PID
+	ror      *RoRWindow
+	active   bool
+	manual   bool
+	start_ts int64
+	last_ts  int64
+	last     PIDLog
+}
+
+// NewProfileFollower creates an inactive follower.
+func NewProfileFollower() *ProfileFollower {
+	return &ProfileFollower{ror: NewRoRWindow(30)}
+}
+
+// PIDStatus is the state of the follower reported to clients.
+type PIDStatus struct {
+	Active bool      `json:"active"`
+	Manual bool      `json:"manual"`
+	Config PIDConfig `json:"config"`
+	Last   PIDLog    `json:"last"`
+}
+
+// Status returns the state of the follower.
+func (f *ProfileFollower) Status() PIDStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return PIDStatus{Active: f.active, Manual: f.manual, Config: f.config, Last: f.last}
+}
+
+// Start begins following the curve of config from now.
+func (f *ProfileFollower) Start(config PIDConfig) error {
+	if !controller.HasDriver() {
+		return errors.New("no hay actuador de control configurado")
+	}
+	if config.Mode == "" {
+		config.Mode = "bt"
+	}
+	if config.Mode != "bt" && config.Mode != "ror" {
+		return errors.New("mode debe ser bt o ror")
+	}
+	if config.OutMax <= config.OutMin {
+		return errors.New("out_max debe ser mayor que out_min")
+	}
+
+	curve := config.Curve
+	if config.SessionId != "" {
+		temps := session_data_provider.GetAllBySessionId(config.SessionId)
+		if len(temps) < 2 {
+			return errors.New("la session de referencia no tiene mediciones")
+		}
+		curve = sessionCurve(temps, config.Mode)
+	}
+	if len(curve) < 2 {
+		return errors.New("se requiere una session de referencia o una curva de al menos dos puntos")
+	}
+	sort.Slice(curve, func(i, j int) bool { return curve[i].T < curve[j].T })
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.config = config
+	f.curve = curve
+	f.pid = PID{Kp: config.Kp, Ki: config.Ki, Kd: config.Kd, OutMin: config.OutMin, OutMax: config.OutMax}
+	// Start the integrator at the current heat, like the return from manual, so taking
+	// over a running roast does not drop the heat.
+	if config.Ki != 0 {
+		f.pid.integral = controller.State().Heat / config.Ki
+	}
+	f.ror.Reset()
+	f.active = true
+	f.manual = false
+	f.start_ts = time.Now().UnixMilli()
+	f.last_ts = 0
+
+	log.Printf("pid: siguiendo curva %s de %d puntos", config.Mode, len(curve))
+	return nil
+}
+
+// Stop stops following the curve; the heat stays where it is.
+func (f *ProfileFollower) Stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.active {
+		log.Println("pid: detenido")
+	}
+	f.active = false
+}
+
+// SetManual switches between manual override (the operator drives the heat) and automatic.
+// Returning to automatic resets the controller for a bumpless transfer.
+func (f *ProfileFollower) SetManual(manual bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.manual && !manual {
+		f.pid.Reset()
+		// Start the integrator at the current heat.
+		if f.pid.Ki != 0 {
+			f.pid.integral = controller.State().Heat / f.pid.Ki
+		}
+	}
+	f.manual = manual
+}
+
+// IsActive returns true while a curve is being followed.
+func (f *ProfileFollower) IsActive() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.active
+}
+
+// OnSample is a pipeline subscriber that updates the controller with every sample.
+func (f *ProfileFollower) OnSample(temp TempType) {
+	f.mu.Lock()
+
+	f.ror.Add(temp.TimeStamp, temp.Temp)
+	if !f.active {
+		f.mu.Unlock()
+		return
+	}
+
+	elapsed := float64(temp.TimeStamp-f.start_ts)/1000 + f.config.OffsetS
+	if elapsed > f.curve[len(f.curve)-1].T {
+		f.active = false
+		f.mu.Unlock()
+		log.Println("pid: fin de la curva")
+		return
+	}
+
+	pv := temp.Temp
+	if f.config.Mode == "ror" {
+		ror, ok := f.ror.RoR()
+		if !ok {
+			f.mu.Unlock()
+			return
+		}
+		pv = ror
+	}
+
+	dt := 0.0
+	if f.last_ts != 0 {
+		dt = float64(temp.TimeStamp-f.last_ts) / 1000
+	}
+	f.last_ts = temp.TimeStamp
+
+	entry := PIDLog{TimeStamp: temp.TimeStamp, Setpoint: curveValue(f.curve, elapsed), PV: pv}
+	manual := f.manual
+	fan := f.config.Fan
+	if manual {
+		entry.Mode = "manual"
+		entry.Output = controller.State().Heat
+	} else {
+		entry.Mode = "auto"
+		entry.Output = f.pid.Update(entry.Setpoint, pv, dt)
+	}
+	f.last = entry
+	f.mu.Unlock()
+
+	if !manual {
+		if fan == 0 {
+			fan = controller.State().Fan
+		}
+		state, err := controller.Set(entry.Output, fan, "pid")
+		if err != nil {
+			log.Println("pid:", err)
+		}
+		entry.Output = state.Heat
+	}
+
+	if active, ok := session.Active(); ok {
+		go session_data_provider.InsertPIDLog(active.Id, entry)
+	}
+	send_data_to_clients(map[string]any{"type": "pid", "pid": entry})
+}
+
+// sessionCurve converts stored measurements into a curve starting at 0 seconds.
+func sessionCurve(temps []*TempType, mode string) []CurvePoint {
+	curve := make([]CurvePoint, len(temps))
+	var ror []float64
+	if mode == "ror" {
+		ror = RoRSeries(temps, 30)
+	}
+	for i, temp := range temps {
+		curve[i].T = float64(temp.TimeStamp-temps[0].TimeStamp) / 1000
+		curve[i].Value = temp.Temp
+		if ror != nil {
+			curve[i].Value = ror[i]
+		}
+	}
+	return curve
+}
+
+// curveValue interpolates the curve at t seconds.
+func curveValue(curve []CurvePoint, t float64) float64 {
+	i := sort.Search(len(curve), func(i int) bool { return curve[i].T >= t })
+	if i == 0 {
+		return curve[0].Value
+	}
+	if i == len(curve) {
+		return curve[len(curve)-1].Value
+	}
+	a, b := curve[i-1], curve[i]
+	if b.T == a.T {
+		return b.Value
+	}
+	return a.Value + (b.Value-a.Value)*(t-a.T)/(b.T-a.T)
+}
+
+// pidStatusHandler returns the state of the profile follower.
+func pidStatusHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+	json.NewEncoder(w).Encode(follower.Status())
+}
+
+// pidStartHandler starts following the curve described by the PIDConfig in the body.
+func pidStartHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+
+	config := DefaultPIDConfig()
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "config invalida")
+		return
+	}
+	defer r.Body.Close()
+
+	if err := follower.Start(config); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	Audit(r, "pid.start", config.SessionId, config)
+
+	json.NewEncoder(w).Encode(follower.Status())
+}
+
+// pidStopHandler stops the profile follower.
+func pidStopHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+	follower.Stop()
+	Audit(r, "pid.stop", "", nil)
+	json.NewEncoder(w).Encode(follower.Status())
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPIDUpdate(t *testing.T) {
+	tests := []struct {
+		name string
+		pid  PID
+		// Steps of setpoint and process value, one second apart.
+		steps [][2]float64
+		want  float64 // The output of the last step.
+	}{
+		{"proportional", PID{Kp: 2, OutMax: 100}, [][2]float64{{100, 90}}, 20},
+		{"clamped high", PID{Kp: 20, OutMax: 100}, [][2]float64{{100, 90}}, 100},
+		{"clamped low", PID{Kp: 2, OutMin: 10, OutMax: 100}, [][2]float64{{90, 100}}, 10},
+		{"integral", PID{Ki: 0.5, OutMax: 100}, [][2]float64{{100, 98}, {100, 98}, {100, 98}}, 3},
+		// Derivative on measurement: a setpoint step does not kick the output.
+		{"no derivative kick", PID{Kd: 10, OutMax: 100}, [][2]float64{{100, 100}, {150, 100}}, 0},
+		{"derivative on measurement", PID{Kd: 10, OutMin: -100, OutMax: 100}, [][2]float64{{100, 100}, {100, 102}}, -20},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out float64
+			for _, step := range test.steps {
+				out = test.pid.Update(step[0], step[1], 1)
+			}
+			if math.Abs(out-test.want) > 1e-9 {
+				t.Errorf("output = %v, want %v", out, test.want)
+			}
+		})
+	}
+}
+
+func TestPIDAntiWindup(t *testing.T) {
+	pid := PID{Kp: 1, Ki: 0.1, OutMin: 0, OutMax: 100}
+
+	// A long saturated stretch must not wind the integrator up.
+	for range 1000 {
+		if out := pid.Update(500, 100, 1); out != 100 {
+			t.Fatalf("saturated output = %v, want 100", out)
+		}
+	}
+	if limit := (pid.OutMax - pid.OutMin) / pid.Ki; pid.integral > limit {
+		t.Errorf("integral = %v, over the clamp %v", pid.integral, limit)
+	}
+	if pid.integral != 0 {
+		t.Errorf("integral = %v, want 0: it should not integrate while saturated", pid.integral)
+	}
+
+	// Once the process overshoots, the output drops right away instead of unwinding.
+	if out := pid.Update(500, 510, 1); out != 0 {
+		t.Errorf("output after overshoot = %v, want 0", out)
+	}
+}
+
+func TestCurveValue(t *testing.T) {
+	curve := []CurvePoint{{T: 0, Value: 100}, {T: 10, Value: 200}, {T: 20, Value: 200}, {T: 30, Value: 170}}
+	tests := []struct {
+		t, want float64
+	}{
+		{-5, 100}, {0, 100}, {5, 150}, {10, 200}, {15, 200}, {25, 185}, {30, 170}, {60, 170},
+	}
+	for _, test := range tests {
+		if got := curveValue(curve, test.t); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("curveValue(%v) = %v, want %v", test.t, got, test.want)
+		}
+	}
+}
+
+// chargedModel returns a noiseless simulator with the beans just charged.
+func chargedModel(t *testing.T) *RoastModel {
+	t.Helper()
+	config := DefaultSimConfig()
+	config.Noise = 0
+	config.CooldownS = -1
+	model := NewRoastModel(config)
+	for range 3600 {
+		for _, event := range model.Step(1) {
+			if event == "charge" {
+				return model
+			}
+		}
+	}
+	t.Fatal("el simulador no llego a la carga")
+	return nil
+}
+
+// TestProfileFollowerSimulator records a roast of the simulator following its own heat
+// profile, then has the PID take over a second roast with more airflow and follow
+// the recorded BT curve.
+func TestProfileFollowerSimulator(t *testing.T) {
+	const duration = 480 // Seconds, before the reference roast drops.
+
+	reference := chargedModel(t)
+	curve := []CurvePoint{}
+	for i := range duration + 1 {
+		bt, _ := reference.Reading()
+		curve = append(curve, CurvePoint{T: float64(i), Value: bt})
+		reference.Step(1)
+	}
+
+	sim := &SimSource{Config: reference.config, Model: chargedModel(t)}
+
+	previous := controller
+	controller = NewController(sim, ControlLimits{HeatMax: 100, FanMinWithHeat: 0, MaxBT: 250})
+	t.Cleanup(func() { controller = previous })
+	// The roast is running at the heat of the reference when the follower takes over.
+	if _, err := controller.Set(sim.Config.Heat, sim.Config.Airflow, "ui"); err != nil {
+		t.Fatal(err)
+	}
+
+	f := NewProfileFollower()
+	config := DefaultPIDConfig()
+	config.Curve = curve
+	config.Fan = 40
+	if err := f.Start(config); err != nil {
+		t.Fatal(err)
+	}
+
+	var errors []float64
+	for i := 1; i < duration; i++ {
+		sim.Model.Step(1)
+		bt, _ := sim.Model.Reading()
+		f.OnSample(TempType{Type: "temp", Temp: bt, TimeStamp: f.start_ts + int64(i)*1000})
+
+		status := f.Status()
+		if !status.Active {
+			t.Fatalf("el follower se detuvo en %d s", i)
+		}
+		if heat, fan := sim.Model.Inputs(); heat != status.Last.Output || fan != 40 {
+			t.Fatalf("%d s: simulador con heat %v fan %v, el pid pidio heat %v fan 40", i, heat, fan, status.Last.Output)
+		}
+		if status.Last.Output < config.OutMin || status.Last.Output > config.OutMax {
+			t.Fatalf("%d s: salida %v fuera de [%v, %v]", i, status.Last.Output, config.OutMin, config.OutMax)
+		}
+		errors = append(errors, status.Last.Setpoint-status.Last.PV)
+	}
+
+	// The fan differs from the reference, the PID has to make up for it all along.
+	var sum, worst float64
+	for _, e := range errors {
+		sum += math.Abs(e)
+		worst = math.Max(worst, math.Abs(e))
+	}
+	mean := sum / float64(len(errors))
+	if mean > 1.5 || worst > 4 {
+		t.Errorf("error medio %.2f y maximo %.2f, se esperaba menos de 1.5 y 4", mean, worst)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// font_5x8 is a 5x8 bitmap font for ASCII 32 to 126. Every glyph is 5 columns with
+// the top row in the lowest bit; rows 0 to 6 sit on the baseline and row 7 descends.
+var font_5x8 = [95][5]byte{
+	{0x00, 0x00, 0x00, 0x00, 0x00}, {0x00, 0x00, 0x5f, 0x00, 0x00}, {0x00, 0x07, 0x00, 0x07, 0x00}, {0x14, 0x7f, 0x14, 0x7f, 0x14},
+	{0x24, 0x2a, 0x7f, 0x2a, 0x12}, {0x23, 0x13, 0x08, 0x64, 0x62}, {0x36, 0x49, 0x56, 0x20, 0x50}, {0x00, 0x08, 0x07, 0x03, 0x00},
+	{0x00, 0x1c, 0x22, 0x41, 0x00}, {0x00, 0x41, 0x22, 0x1c, 0x00}, {0x2a, 0x1c, 0x7f, 0x1c, 0x2a}, {0x08, 0x08, 0x3e, 0x08, 0x08},
+	{0x00, 0x80, 0x70, 0x30, 0x00}, {0x08, 0x08, 0x08, 0x08, 0x08}, {0x00, 0x00, 0x60, 0x60, 0x00}, {0x20, 0x10, 0x08, 0x04, 0x02},
+	{0x3e, 0x51, 0x49, 0x45, 0x3e}, {0x00, 0x42, 0x7f, 0x40, 0x00}, {0x72, 0x49, 0x49, 0x49, 0x46}, {0x21, 0x41, 0x49, 0x4d, 0x33},
+	{0x18, 0x14, 0x12, 0x7f, 0x10}, {0x27, 0x45, 0x45, 0x45, 0x39}, {0x3c, 0x4a, 0x49, 0x49, 0x31}, {0x41, 0x21, 0x11, 0x09, 0x07},
+	{0x36, 0x49, 0x49, 0x49, 0x36}, {0x46, 0x49, 0x49, 0x29, 0x1e}, {0x00, 0x00, 0x14, 0x00, 0x00}, {0x00, 0x40, 0x34, 0x00, 0x00},
+	{0x00, 0x08, 0x14, 0x22, 0x41}, {0x14, 0x14, 0x14, 0x14, 0x14}, {0x00, 0x41, 0x22, 0x14, 0x08}, {0x02, 0x01, 0x59, 0x09, 0x06},
+	{0x3e, 0x41, 0x5d, 0x59, 0x4e}, {0x7c, 0x12, 0x11, 0x12, 0x7c}, {0x7f, 0x49, 0x49, 0x49, 0x36}, {0x3e, 0x41, 0x41, 0x41, 0x22},
+	{0x7f, 0x41, 0x41, 0x41, 0x3e}, {0x7f, 0x49, 0x49, 0x49, 0x41}, {0x7f, 0x09, 0x09, 0x09, 0x01}, {0x3e, 0x41, 0x41, 0x51, 0x73},
+	{0x7f, 0x08, 0x08, 0x08, 0x7f}, {0x00, 0x41, 0x7f, 0x41, 0x00}, {0x20, 0x40, 0x41, 0x3f, 0x01}, {0x7f, 0x08, 0x14, 0x22, 0x41},
+	{0x7f, 0x40, 0x40, 0x40, 0x40}, {0x7f, 0x02, 0x1c, 0x02, 0x7f}, {0x7f, 0x04, 0x08, 0x10, 0x7f}, {0x3e, 0x41, 0x41, 0x41, 0x3e},
+	{0x7f, 0x09, 0x09, 0x09, 0x06}, {0x3e, 0x41, 0x51, 0x21, 0x5e}, {0x7f, 0x09, 0x19, 0x29, 0x46}, {0x26, 0x49, 0x49, 0x49, 0x32},
+	{0x03, 0x01, 0x7f, 0x01, 0x03}, {0x3f, 0x40, 0x40, 0x40, 0x3f}, {0x1f, 0x20, 0x40, 0x20, 0x1f}, {0x3f, 0x40, 0x38, 0x40, 0x3f},
+	{0x63, 0x14, 0x08, 0x14, 0x63}, {0x03, 0x04, 0x78, 0x04, 0x03}, {0x61, 0x59, 0x49, 0x4d, 0x43}, {0x00, 0x7f, 0x41, 0x41, 0x41},
+	{0x02, 0x04, 0x08, 0x10, 0x20}, {0x00, 0x41, 0x41, 0x41, 0x7f}, {0x04, 0x02, 0x01, 0x02, 0x04}, {0x40, 0x40, 0x40, 0x40, 0x40},
+	{0x00, 0x03, 0x07, 0x08, 0x00}, {0x20, 0x54, 0x54, 0x78, 0x40}, {0x7f, 0x28, 0x44, 0x44, 0x38}, {0x38, 0x44, 0x44, 0x44, 0x28},
+	{0x38, 0x44, 0x44, 0x28, 0x7f}, {0x38, 0x54, 0x54, 0x54, 0x18}, {0x00, 0x08, 0x7e, 0x09, 0x02}, {0x18, 0xa4, 0xa4, 0x9c, 0x78},
+	{0x7f, 0x08, 0x04, 0x04, 0x78}, {0x00, 0x44, 0x7d, 0x40, 0x00}, {0x20, 0x40, 0x40, 0x3d, 0x00}, {0x7f, 0x10, 0x28, 0x44, 0x00},
+	{0x00, 0x41, 0x7f, 0x40, 0x00}, {0x7c, 0x04, 0x78, 0x04, 0x78}, {0x7c, 0x08, 0x04, 0x04, 0x78}, {0x38, 0x44, 0x44, 0x44, 0x38},
+	{0xfc, 0x18, 0x24, 0x24, 0x18}, {0x18, 0x24, 0x24, 0x18, 0xfc}, {0x7c, 0x08, 0x04, 0x04, 0x08}, {0x48, 0x54, 0x54, 0x54, 0x24},
+	{0x04, 0x04, 0x3f, 0x44, 0x24}, {0x3c, 0x40, 0x40, 0x20, 0x7c}, {0x1c, 0x20, 0x40, 0x20, 0x1c}, {0x3c, 0x40, 0x30, 0x40, 0x3c},
+	{0x44, 0x28, 0x10, 0x28, 0x44}, {0x4c, 0x90, 0x90, 0x90, 0x7c}, {0x44, 0x64, 0x54, 0x4c, 0x44}, {0x00, 0x08, 0x36, 0x41, 0x00},
+	{0x00, 0x00, 0x77, 0x00, 0x00}, {0x00, 0x41, 0x36, 0x08, 0x00}, {0x02, 0x01, 0x02, 0x04, 0x02},
+}
+
+// font_extra are the glyphs of the non ASCII symbols used on charts.
+var font_extra = map[rune][5]byte{
+	'°': {0x00, 0x06, 0x09, 0x09, 0x06},
+	'º': {0x00, 0x06, 0x09, 0x09, 0x06},
+	'·': {0x00, 0x00, 0x08, 0x00, 0x00},
+}
+
+// font_fold drops the accents the bitmap font has no glyphs for.
+var font_fold = strings.NewReplacer(
+	"á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ü", "u", "ñ", "n",
+	"Á", "A", "É", "E", "Í", "I", "Ó", "O", "Ú", "U", "Ü", "U", "Ñ", "N",
+)
+
+// PNGCanvas draws on an RGBA image with antialiased lines and a bitmap font.
+type PNGCanvas struct {
+	img *image.RGBA
+}
+
+// NewPNGCanvas creates a w by h canvas filled with the background color.
+func NewPNGCanvas(w int, h int, background string) *PNGCanvas {
+	c := &PNGCanvas{img: image.NewRGBA(image.Rect(0, 0, w, h))}
+	draw.Draw(c.img, c.img.Bounds(), image.NewUniform(parseColor(background)), image.Point{}, draw.Src)
+	return c
+}
+
+// parseColor converts a #rrggbb color.
+func parseColor(s string) color.RGBA {
+	v, err := strconv.ParseUint(strings.TrimPrefix(s, "#"), 16, 32)
+	if err != nil {
+		return color.RGBA{A: 255}
+	}
+	return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 255}
+}
+
+// stroke draws the segments of a path with one coverage mask, so joints are not
+// painted twice.
+func (c *PNGCanvas) stroke(points [][2]float64, col string, width float64, dashed bool) {
+	if len(points) < 2 {
+		return
+	}
+	hw := math.Max(width, 1) / 2
+	min_x, min_y, max_x, max_y := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, p := range points {
+		min_x, max_x = math.Min(min_x, p[0]), math.Max(max_x, p[0])
+		min_y, max_y = math.Min(min_y, p[1]), math.Max(max_y, p[1])
+	}
+	bounds := image.Rect(int(min_x-hw-1), int(min_y-hw-1), int(max_x+hw+2), int(max_y+hw+2)).Intersect(c.img.Bounds())
+	if bounds.Empty() {
+		return
+	}
+	mask := image.NewAlpha(bounds)
+
+	// Thin lines are drawn lighter instead of thinner than a pixel.
+	strength := math.Min(1, width)
+	walked := 0.0
+	for i := 1; i < len(points); i++ {
+		ax, ay, bx, by := points[i-1][0], points[i-1][1], points[i][0], points[i][1]
+		dx, dy := bx-ax, by-ay
+		length2 := dx*dx + dy*dy
+		length := math.Sqrt(length2)
+		seg := image.Rect(int(math.Min(ax, bx)-hw-1), int(math.Min(ay, by)-hw-1), int(math.Max(ax, bx)+hw+2), int(math.Max(ay, by)+hw+2)).Intersect(bounds)
+		for py := seg.Min.Y; py < seg.Max.Y; py++ {
+			for px := seg.Min.X; px < seg.Max.X; px++ {
+				cx, cy := float64(px)+0.5, float64(py)+0.5
+				t := 0.0
+				if length2 > 0 {
+					t = math.Max(0, math.Min(1, ((cx-ax)*dx+(cy-ay)*dy)/length2))
+				}
+				if dashed && math.Mod(walked+t*length, 6) >= 3 {
+					continue
+				}
+				dist := math.Hypot(cx-(ax+t*dx), cy-(ay+t*dy))
+				coverage := math.Max(0, math.Min(1, hw+0.5-dist)) * strength
+				if a := uint8(coverage * 255); a > mask.AlphaAt(px, py).A {
+					mask.SetAlpha(px, py, color.Alpha{A: a})
+				}
+			}
+		}
+		walked += length
+	}
+	draw.DrawMask(c.img, bounds, image.NewUniform(parseColor(col)), image.Point{}, mask, bounds.Min, draw.Over)
+}
+
+func (c *PNGCanvas) Line(x1, y1, x2, y2 float64, color string, width float64, dashed bool) {
+	c.stroke([][2]float64{{x1, y1}, {x2, y2}}, color, width, dashed)
+}
+
+func (c *PNGCanvas) Polyline(points [][2]float64, color string, width float64) {
+	c.stroke(points, color, width, false)
+}
+
+func (c *PNGCanvas) Rect(x, y, w, h float64, fill string) {
+	r := image.Rect(int(math.Round(x)), int(math.Round(y)), int(math.Round(x+w)), int(math.Round(y+h)))
+	draw.Draw(c.img, r, image.NewUniform(parseColor(fill)), image.Point{}, draw.Over)
+}
+
+// glyph returns the bitmap of a character.
+func glyph(r rune) [5]byte {
+	if r >= 32 && r < 127 {
+		return font_5x8[r-32]
+	}
+	if g, ok := font_extra[r]; ok {
+		return g
+	}
+	return font_5x8['?'-32]
+}
+
+func (c *PNGCanvas) Text(x, y float64, size float64, col string, anchor string, bold bool, s string) {
+	runes := []rune(font_fold.Replace(s))
+	scale := max(1, int(math.Round(size/9)))
+	advance := 6 * scale
+	switch anchor {
+	case "middle":
+		x -= float64(len(runes)*advance) / 2
+	case "end":
+		x -= float64(len(runes) * advance)
+	}
+
+	fill := parseColor(col)
+	left, top := int(math.Round(x)), int(math.Round(y))-7*scale
+	for i, r := range runes {
+		g := glyph(r)
+		for column := 0; column < 5; column++ {
+			for row := 0; row < 8; row++ {
+				if g[column]>>row&1 == 0 {
+					continue
+				}
+				px, py := left+i*advance+column*scale, top+row*scale
+				dot := image.Rect(px, py, px+scale, py+scale)
+				if bold {
+					dot.Max.X++
+				}
+				draw.Draw(c.img, dot, image.NewUniform(fill), image.Point{}, draw.Src)
+			}
+		}
+	}
+}
+
+// WritePNG encodes what was drawn.
+func (c *PNGCanvas) WritePNG(w io.Writer) error {
+	return png.Encode(w, c.img)
+}
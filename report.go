@@ -0,0 +1,281 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Report chart size, in points.
+const (
+	report_chart_w = 520
+	report_chart_h = 260
+)
+
+// ReportRow is a row of the event table of a report.
+type ReportRow struct {
+	Name   string
+	Time   string // m:ss from charge.
+	Temp   string
+	RoR    string
+	Source string
+}
+
+// RoastReport is the content of a roast sheet.
+type RoastReport struct {
+	Profile   *RoastProfile
+	Session   SessionData
+	Phases    PhaseStats
+	Rows      []ReportRow
+	Details   [][2]string // Coffee, roaster, weights and other label/value pairs.
+	Generated time.Time
+}
+
+// NewRoastReport gathers the report of a session.
+func NewRoastReport(profile *RoastProfile) RoastReport {
+	report := RoastReport{
+		Profile:   profile,
+		Session:   profile.Session,
+		Phases:    profile.Phases(),
+		Generated: time.Now(),
+	}
+
+	charge := profile.Events["charge"].TimeStamp
+	for _, name := range roast_event_names {
+		if event, ok := profile.Events[name]; ok {
+			_, ror, _ := profile.At(event.TimeStamp, 0)
+			report.Rows = append(report.Rows, ReportRow{
+				Name:   event_labels[name],
+				Time:   formatClock(event.T),
+				Temp:   fmt.Sprintf("%.1f", event.Temp),
+				RoR:    fmt.Sprintf("%.1f", ror),
+				Source: event.Source,
+			})
+		}
+	}
+	// Marks that are not roast events, as notes of the operator.
+	for _, mark := range profile.Marks {
+		if eventOfMark(mark.MarkName) != "" {
+			continue
+		}
+		i := markSampleIndex(mark, profile.Temps)
+		ror := ""
+		if mark.RoR != nil {
+			ror = fmt.Sprintf("%.1f", *mark.RoR)
+		} else {
+			ror = fmt.Sprintf("%.1f", profile.RoR[i])
+		}
+		report.Rows = append(report.Rows, ReportRow{
+			Name:   mark.MarkName,
+			Time:   formatClock(float64(profile.Temps[i].TimeStamp-charge) / 1000),
+			Temp:   fmt.Sprintf("%.1f", mark.OnTemp),
+			RoR:    ror,
+			Source: "mark",
+		})
+	}
+
+	s := report.Session
+	detail := func(label string, value string) {
+		if value != "" {
+			report.Details = append(report.Details, [2]string{label, value})
+		}
+	}
+	detail("Café", s.Coffee)
+	detail("Tostadora", s.Roaster)
+	detail("Fecha", time.UnixMilli(s.CreateAt).Format("2006-01-02 15:04"))
+	detail("Duración", formatClock(report.Phases.TotalS))
+	detail("Operador", s.StartedBy)
+	if s.GreenWeight > 0 {
+		detail("Peso verde", fmt.Sprintf("%.0f g", s.GreenWeight))
+	}
+	if s.RoastedWeight > 0 {
+		detail("Peso tostado", fmt.Sprintf("%.0f g", s.RoastedWeight))
+	}
+	if s.GreenWeight > 0 && s.RoastedWeight > 0 {
+		detail("Pérdida de peso", fmt.Sprintf("%.1f %%", (s.GreenWeight-s.RoastedWeight)/s.GreenWeight*100))
+	}
+	detail("Temperatura de carga", fmt.Sprintf("%.1f °C", report.Phases.ChargeTemp))
+	detail("Temperatura de descarga", fmt.Sprintf("%.1f °C", report.Phases.DropTemp))
+	detail("RoR medio", fmt.Sprintf("%.1f °C/min", report.Phases.MeanRoR))
+	if report.Phases.DevelopmentRise != nil {
+		detail("Subida en desarrollo", fmt.Sprintf("%.1f °C", *report.Phases.DevelopmentRise))
+	}
+	if s.Score > 0 {
+		detail("Puntaje", fmt.Sprintf("%.2f", s.Score))
+	}
+	detail("Tags", strings.Join(s.Tags, ", "))
+
+	return report
+}
+
+// ChartSVG returns the chart as an SVG document.
+func (r RoastReport) ChartSVG() template.HTML {
+	var c svgCanvas
+	RoastChart{Profiles: []*RoastProfile{r.Profile}, Width: report_chart_w, Height: report_chart_h, Options: DefaultChartOptions()}.Draw(&c, 0, 0)
+	return template.HTML(c.SVG(report_chart_w, report_chart_h))
+}
+
+// PhaseBarSVG returns the phase bar as an SVG document.
+func (r RoastReport) PhaseBarSVG() template.HTML {
+	var c svgCanvas
+	DrawPhaseBar(&c, 0, 0, report_chart_w, 18, r.Phases)
+	return template.HTML(c.SVG(report_chart_w, 18))
+}
+
+var report_template = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="es">
+<head>
+<meta charset="utf-8">
+<title>{{.Session.Name}}</title>
+<style>
+	body { font-family: Helvetica, Arial, sans-serif; color: #111827; max-width: 560px; margin: 24px auto; font-size: 12px; }
+	h1 { font-size: 20px; margin: 0; }
+	.sub { color: #6b7280; margin-bottom: 16px; }
+	h2 { font-size: 13px; margin: 18px 0 6px; border-bottom: 1px solid #e5e7eb; padding-bottom: 2px; }
+	table { border-collapse: collapse; width: 100%; }
+	th, td { text-align: left; padding: 3px 6px; border-bottom: 1px solid #f3f4f6; }
+	td.n { text-align: right; font-variant-numeric: tabular-nums; }
+	.notes { white-space: pre-wrap; }
+	svg { display: block; }
+	@media print { body { margin: 0 auto; } }
+</style>
+</head>
+<body>
+<h1>{{.Session.Name}}</h1>
+<div class="sub">Session {{.Session.Id}} · generado {{.Generated.Format "2006-01-02 15:04"}}</div>
+{{.ChartSVG}}
+<h2>Fases</h2>
+{{.PhaseBarSVG}}
+<h2>Eventos</h2>
+<table>
+<tr><th>Evento</th><th>Tiempo</th><th>BT °C</th><th>RoR °C/min</th><th>Origen</th></tr>
+{{range .Rows}}<tr><td>{{.Name}}</td><td class="n">{{.Time}}</td><td class="n">{{.Temp}}</td><td class="n">{{.RoR}}</td><td>{{.Source}}</td></tr>
+{{end}}</table>
+<h2>Datos del lote</h2>
+<table>
+{{range .Details}}<tr><th>{{index . 0}}</th><td>{{index . 1}}</td></tr>
+{{end}}</table>
+{{if .Session.Notes}}<h2>Notas</h2>
+<div class="notes">{{.Session.Notes}}</div>{{end}}
+</body>
+</html>
+`))
+
+// PDF renders the report as an A4 PDF.
+func (r RoastReport) PDF() *PDFDocument {
+	d := NewPDFDocument()
+	theme := chart_themes["light"]
+	const margin = 40
+	width := pdf_page_w - 2*margin
+	y := float64(margin) + 16
+
+	// newLine moves down h points, starting a new page when the current one is full.
+	newLine := func(h float64) {
+		y += h
+		if y > pdf_page_h-margin {
+			d.AddPage()
+			y = margin + h
+		}
+	}
+	heading := func(text string) {
+		newLine(22)
+		d.Text(margin, y, 11, "#111827", "start", true, text)
+		d.Line(margin, y+4, margin+width, y+4, theme.Grid, 0.8, false)
+		newLine(4)
+	}
+
+	d.Text(margin, y, 18, "#111827", "start", true, r.Session.Name)
+	newLine(14)
+	d.Text(margin, y, 8, theme.Mark, "start", false, "Session "+r.Session.Id+" · generado "+r.Generated.Format("2006-01-02 15:04"))
+	newLine(10)
+
+	RoastChart{Profiles: []*RoastProfile{r.Profile}, Width: width, Height: 280, Options: DefaultChartOptions()}.Draw(d, margin, y)
+	y += 280
+
+	heading("Fases")
+	newLine(4)
+	DrawPhaseBar(d, margin, y, width, 18, r.Phases)
+	y += 18
+
+	heading("Eventos")
+	columns := []struct {
+		title  string
+		x      float64
+		anchor string
+	}{{"Evento", 0, "start"}, {"Tiempo", 210, "end"}, {"BT °C", 280, "end"}, {"RoR °C/min", 370, "end"}, {"Origen", 400, "start"}}
+	newLine(12)
+	for _, col := range columns {
+		d.Text(margin+col.x, y, 9, "#111827", col.anchor, true, col.title)
+	}
+	for _, row := range r.Rows {
+		newLine(13)
+		values := []string{row.Name, row.Time, row.Temp, row.RoR, row.Source}
+		for i, col := range columns {
+			d.Text(margin+col.x, y, 9, theme.Text, col.anchor, false, values[i])
+		}
+	}
+
+	heading("Datos del lote")
+	for _, detail := range r.Details {
+		newLine(13)
+		d.Text(margin, y, 9, "#111827", "start", true, detail[0])
+		d.Text(margin+150, y, 9, theme.Text, "start", false, detail[1])
+	}
+
+	if r.Session.Notes != "" {
+		heading("Notas")
+		for _, line := range WrapText(r.Session.Notes, 9, width) {
+			newLine(12)
+			d.Text(margin, y, 9, theme.Text, "start", false, line)
+		}
+	}
+
+	return d
+}
+
+// roastSessionReportHandler renders the roast sheet of the session {id} as a
+// self-contained HTML page (format=html, the default) or a PDF (format=pdf).
+func roastSessionReportHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+	session_id := r.PathValue("id")
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "html"
+	}
+	if format != "html" && format != "pdf" {
+		writeJSONError(w, http.StatusBadRequest, "format debe ser html o pdf")
+		return
+	}
+
+	profile, err := LoadRoastProfile(session_id)
+	if errors.Is(err, ErrNoMeasurements) {
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	report := NewRoastReport(profile)
+
+	filename := "tostado-" + session_id + "." + format
+	switch format {
+	case "pdf":
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", `inline; filename="`+filename+`"`)
+		if _, err := report.PDF().WriteTo(w); err != nil {
+			log.Println("error al enviar reporte,", err)
+		}
+	default:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Disposition", `inline; filename="`+filename+`"`)
+		if err := report_template.Execute(w, report); err != nil {
+			log.Println("error al generar reporte,", err)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Roast events, in roast order.
+var roast_event_names = []string{"charge", "turning_point", "dry_end", "first_crack", "second_crack", "drop"}
+
+// event_aliases are the mark names recognized as each roast event. The chart posts
+// "loaded"/"unloaded" for charge and drop; the simulator uses the event names.
+var event_aliases = map[string][]string{
+	"charge":        {"charge", "loaded", "carga", "cargado"},
+	"turning_point": {"turning_point", "turning point", "tp"},
+	"dry_end":       {"dry_end", "dry end", "dry", "yellow", "amarillo", "fin de secado", "fin secado"},
+	"first_crack":   {"first_crack", "first crack", "fc", "1c", "primer crack", "primer_crack"},
+	"second_crack":  {"second_crack", "second crack", "sc", "2c", "segundo crack"},
+	"drop":          {"drop", "unloaded", "descarga", "descargado"},
+}
+
+// ErrNoMeasurements is returned for sessions without enough samples to analyze.
+var ErrNoMeasurements = errors.New("la session no tiene mediciones")
+
+// turning_point_window_ms is how long after charge the turning point is searched for.
+const turning_point_window_ms = 4 * 60 * 1000
+
+// RoastEvent is a roast milestone of a session.
+type RoastEvent struct {
+	TimeStamp int64   `json:"timestamp"` // The timestamp of the sample (in milliseconds).
+	T         float64 `json:"t"`         // Seconds from charge.
+	Temp      float64 `json:"temp"`      // The bean temperature.
+	Source    string  `json:"source"`    // "mark", "detected", or "start"/"end" when charge/drop were not marked.
+	index     int
+}
+
+// PhaseStats are the phase durations and temperatures of a roast. Durations are in
+// seconds; percentages are of the time from charge to drop.
+type PhaseStats struct {
+	TotalS          float64  `json:"total_s"`
+	DryingS         *float64 `json:"drying_s,omitempty"`      // Charge to dry end.
+	MaillardS       *float64 `json:"maillard_s,omitempty"`    // Dry end to first crack.
+	DevelopmentS    *float64 `json:"development_s,omitempty"` // First crack to drop.
+	DryingPct       *float64 `json:"drying_pct,omitempty"`
+	MaillardPct     *float64 `json:"maillard_pct,omitempty"`
+	DevelopmentPct  *float64 `json:"development_pct,omitempty"` // The development time ratio (DTR).
+	ChargeTemp      float64  `json:"charge_temp"`
+	DropTemp        float64  `json:"drop_temp"`
+	MeanRoR         float64  `json:"mean_ror"`                   // Charge (or turning point) to drop, in degrees per minute.
+	DevelopmentRise *float64 `json:"development_rise,omitempty"` // Degrees gained from first crack to drop.
+}
+
+// RoastProfile is a stored session with its measurements, marks and detected events.
+type RoastProfile struct {
+	Session SessionData
+	Temps   []*TempType
+	Marks   []Mark
+	RoR     []float64 // The rate of rise at every sample.
+	Events  map[string]RoastEvent
+}
+
+// LoadRoastProfile reads a session and finds its roast events.
+func LoadRoastProfile(session_id string) (*RoastProfile, error) {
+	stored, err := session_data_provider.GetSessionById(session_id)
+	if err != nil || stored.DeletedAt != 0 {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, session_id)
+	}
+	temps := session_data_provider.GetAllBySessionId(session_id)
+	if len(temps) < 2 {
+		return nil, fmt.Errorf("%w: %s", ErrNoMeasurements, session_id)
+	}
+
+	profile := &RoastProfile{
+		Session: stored,
+		Temps:   temps,
+		Marks:   session_data_provider.GetMarksOfSessions(session_id),
+		RoR:     RoRSeries(temps, mark_ror_seconds),
+	}
+	profile.findEvents()
+	return profile, nil
+}
+
+// eventOfMark returns the roast event a mark name stands for, or "".
+func eventOfMark(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for event, aliases := range event_aliases {
+		for _, alias := range aliases {
+			if name == alias || strings.ReplaceAll(name, "-", "_") == alias {
+				return event
+			}
+		}
+	}
+	return ""
+}
+
+// findEvents takes the events from the marks, detects the turning point and falls back
+// to the first and last samples for charge and drop.
+func (p *RoastProfile) findEvents() {
+	p.Events = map[string]RoastEvent{}
+
+	for _, mark := range p.Marks {
+		event := eventOfMark(mark.MarkName)
+		if _, seen := p.Events[event]; event == "" || seen {
+			continue
+		}
+		p.Events[event] = p.event(markSampleIndex(mark, p.Temps), "mark")
+	}
+
+	if _, ok := p.Events["charge"]; !ok {
+		p.Events["charge"] = p.event(0, "start")
+	}
+	if _, ok := p.Events["drop"]; !ok {
+		p.Events["drop"] = p.event(len(p.Temps)-1, "end")
+	}
+
+	if _, ok := p.Events["turning_point"]; !ok {
+		charge := p.Events["charge"]
+		lowest := -1
+		for i := charge.index; i < len(p.Temps) && p.Temps[i].TimeStamp-charge.TimeStamp <= turning_point_window_ms; i++ {
+			if lowest < 0 || p.Temps[i].Temp < p.Temps[lowest].Temp {
+				lowest = i
+			}
+		}
+		// Only a real dip after charge is a turning point.
+		if lowest > charge.index && lowest < len(p.Temps)-1 && p.Temps[lowest].Temp < charge.Temp-1 {
+			p.Events["turning_point"] = p.event(lowest, "detected")
+		}
+	}
+
+	charge := p.Events["charge"].TimeStamp
+	for name, event := range p.Events {
+		event.T = float64(event.TimeStamp-charge) / 1000
+		p.Events[name] = event
+	}
+}
+
+func (p *RoastProfile) event(i int, source string) RoastEvent {
+	return RoastEvent{TimeStamp: p.Temps[i].TimeStamp, Temp: p.Temps[i].Temp, Source: source, index: i}
+}
+
+// Phases computes the phase stats from the events.
+func (p *RoastProfile) Phases() PhaseStats {
+	charge, drop := p.Events["charge"], p.Events["drop"]
+	stats := PhaseStats{TotalS: drop.T - charge.T, ChargeTemp: charge.Temp, DropTemp: drop.Temp}
+
+	span := func(from string, to string) *float64 {
+		a, ok_a := p.Events[from]
+		b, ok_b := p.Events[to]
+		if !ok_a || !ok_b || b.T < a.T {
+			return nil
+		}
+		d := b.T - a.T
+		return &d
+	}
+	pct := func(d *float64) *float64 {
+		if d == nil || stats.TotalS <= 0 {
+			return nil
+		}
+		v := *d / stats.TotalS * 100
+		return &v
+	}
+
+	stats.DryingS = span("charge", "dry_end")
+	stats.MaillardS = span("dry_end", "first_crack")
+	stats.DevelopmentS = span("first_crack", "drop")
+	stats.DryingPct = pct(stats.DryingS)
+	stats.MaillardPct = pct(stats.MaillardS)
+	stats.DevelopmentPct = pct(stats.DevelopmentS)
+
+	if fc, ok := p.Events["first_crack"]; ok && drop.T >= fc.T {
+		rise := drop.Temp - fc.Temp
+		stats.DevelopmentRise = &rise
+	}
+
+	start := charge
+	if tp, ok := p.Events["turning_point"]; ok {
+		start = tp
+	}
+	if drop.T > start.T {
+		stats.MeanRoR = (drop.Temp - start.Temp) / (drop.T - start.T) * 60
+	}
+
+	return stats
+}
+
+// At returns the bean temperature and rate of rise interpolated at t seconds from
+// the given timestamp, and false outside the measured range.
+func (p *RoastProfile) At(origin int64, t float64) (float64, float64, bool) {
+	ts := float64(origin) + t*1000
+	n := len(p.Temps)
+	if ts < float64(p.Temps[0].TimeStamp) || ts > float64(p.Temps[n-1].TimeStamp) {
+		return 0, 0, false
+	}
+
+	lo, hi := 0, n-1
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		if float64(p.Temps[mid].TimeStamp) <= ts {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+
+	a, b := p.Temps[lo], p.Temps[hi]
+	if b.TimeStamp == a.TimeStamp {
+		return a.Temp, p.RoR[lo], true
+	}
+	f := (ts - float64(a.TimeStamp)) / float64(b.TimeStamp-a.TimeStamp)
+	f = math.Max(0, math.Min(1, f))
+	return a.Temp + (b.Temp-a.Temp)*f, p.RoR[lo] + (p.RoR[hi]-p.RoR[lo])*f, true
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand/v2"
+	"os"
+	"sync"
+)
+
+// Phases of a simulated roast.
+const (
+	SimPhasePreheat = "preheat" // Empty drum heating up to the charge temperature.
+	SimPhaseRoast   = "roast"   // Beans in the drum.
+	SimPhaseDropped = "dropped" // Beans dropped, waiting for the next charge.
+)
+
+// HeatStep sets the heat and airflow inputs from a given time after charge.
+type HeatStep struct {
+	AtS     float64 `json:"at_s"`    // Seconds after charge.
+	Heat    float64 `json:"heat"`    // Burner/heater power in percent.
+	Airflow float64 `json:"airflow"` // Fan speed in percent.
+}
+
+// SimConfig holds the parameters of the roast simulator.
+type SimConfig struct {
+	BatchKg        float64    `json:"batch_kg"`         // Green coffee weight. Bigger batches heat slower and pull the drum down more.
+	Ambient        float64    `json:"ambient"`          // Room and green bean temperature.
+	ChargeTemp     float64    `json:"charge_temp"`      // The beans are charged once the probe reaches this temperature.
+	FirstCrackTemp float64    `json:"first_crack_temp"` // Bean temperature at which the endothermic first crack starts.
+	FirstCrackDrop float64    `json:"first_crack_drop"` // Degrees of heating absorbed by first crack (how flat the curve gets).
+	DropTemp       float64    `json:"drop_temp"`        // Bean temperature at which the batch is dropped.
+	MaxRoastS      float64    `json:"max_roast_s"`      // Drop anyway after this many seconds.
+	CooldownS      float64    `json:"cooldown_s"`       // Seconds between drop and the next preheat; negative stops after one roast.
+	Heat           float64    `json:"heat"`             // Initial heat in percent.
+	Airflow        float64    `json:"airflow"`          // Initial airflow in percent.
+	HeatProfile    []HeatStep `json:"heat_profile"`     // Input changes during the roast, sorted by at_s.
+	Noise          float64    `json:"noise"`            // Standard deviation of the sensor noise.
+	SampleMs       int64      `json:"sample_ms"`        // Interval between samples.
+	TimeScale      float64    `json:"time_scale"`       // Simulated seconds per real second (e.g., 10 for a 1 minute roast).
+}
+
+// DefaultSimConfig returns the parameters of a typical 1 kg medium roast.
+func DefaultSimConfig() *SimConfig {
+	return &SimConfig{
+		BatchKg:        1,
+		Ambient:        25,
+		ChargeTemp:     200,
+		FirstCrackTemp: 196,
+		FirstCrackDrop: 6,
+		DropTemp:       210,
+		MaxRoastS:      20 * 60,
+		CooldownS:      60,
+		Heat:           75,
+		Airflow:        30,
+		HeatProfile: []HeatStep{
+			{AtS: 240, Heat: 70, Airflow: 40},
+			{AtS: 420, Heat: 60, Airflow: 50},
+		},
+		Noise:     0.3,
+		SampleMs:  1000,
+		TimeScale: 1,
+	}
+}
+
+// LoadSimConfig reads simulator parameters from a JSON file; missing fields keep the defaults.
+func LoadSimConfig(path string) (*SimConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := DefaultSimConfig()
+	config.HeatProfile = nil
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+	if config.SampleMs <= 0 {
+		config.SampleMs = 1000
+	}
+	if config.TimeScale <= 0 {
+		config.TimeScale = 1
+	}
+	if config.BatchKg <= 0 {
+		config.BatchKg = 1
+	}
+	return config, nil
+}
+
+// Constants of the thermal model, tuned so the default config gives a turning point
+// around 1:20, first crack around 7:30 and drop around 10:00.
+const (
+	simHeatGain    = 0.1    // ET rise per second per percent of heat.
+	simLoss        = 0.02   // ET loss per second per degree above ambient.
+	simAirflowLoss = 0.008  // Extra ET loss per degree at full airflow.
+	simBeanLoad    = 0.025  // ET pulled down per second per degree of ET-bean difference and kg.
+	simTransfer    = 0.0035 // Bean heating per second per degree of ET-bean difference.
+	simAirTransfer = 0.0015 // Extra bean heating at full airflow (convection).
+	simDryingDip   = 0.35   // Fraction of the bean heating spent on evaporation during drying.
+	simProbeTau    = 35.0   // Time constant of the bean probe in seconds.
+	simEmptyProbe  = 0.85   // Fraction of ET seen by the probe in the empty drum.
+)
+
+// RoastModel is a lumped thermal model of a drum roaster: an environment (air and drum)
+// heated by the burner and a bean mass heated by the environment, read through a
+// probe with a first order lag.
+type RoastModel struct {
+	config *SimConfig
+	mu     sync.Mutex
+
+	phase   string
+	t       float64 // Seconds since charge, or since the phase started when not roasting.
+	et      float64 // Environment temperature.
+	bean    float64 // Real bean temperature.
+	probe   float64 // Bean probe reading.
+	fc_left float64 // Degrees of first crack heating still to absorb.
+	heat    float64
+	airflow float64
+	manual  bool // Inputs were set by hand, the heat profile is ignored.
+	profile int  // Next heat profile step.
+}
+
+// NewRoastModel creates a model at ambient temperature in the preheat phase.
+func NewRoastModel(config *SimConfig) *RoastModel {
+	m := &RoastModel{config: config}
+	m.et = config.Ambient
+	m.probe = config.Ambient
+	m.bean = config.Ambient
+	m.preheat()
+	return m
+}
+
+// preheat empties the drum and restores the initial inputs.
+func (m *RoastModel) preheat() {
+	m.phase = SimPhasePreheat
+	m.t = 0
+	m.heat = m.config.Heat
+	m.airflow = m.config.Airflow
+	m.profile = 0
+	m.manual = false
+}
+
+// charge drops a new batch of green beans into the drum.
+func (m *RoastModel) charge() {
+	m.phase = SimPhaseRoast
+	m.t = 0
+	m.bean = m.config.Ambient
+	m.fc_left = m.config.FirstCrackDrop
+}
+
+// SetInputs overrides the heat and airflow (in percent); the heat profile stops applying
+// until the next charge.
+func (m *RoastModel) SetInputs(heat float64, airflow float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.heat = math.Max(0, math.Min(100, heat))
+	m.airflow = math.Max(0, math.Min(100, airflow))
+	m.manual = true
+}
+
+// Inputs returns the current heat and airflow.
+func (m *RoastModel) Inputs() (float64, float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.heat, m.airflow
+}
+
+// Phase returns the current phase and the seconds spent in it.
+func (m *RoastModel) Phase() (string, float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.phase, m.t
+}
+
+// Step advances the model by dt simulated seconds and returns the phase events that happened.
+func (m *RoastModel) Step(dt float64) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var events []string
+	c := m.config
+	air := m.airflow / 100
+
+	if m.phase == SimPhaseRoast && !m.manual {
+		for m.profile < len(c.HeatProfile) && m.t >= c.HeatProfile[m.profile].AtS {
+			m.heat = c.HeatProfile[m.profile].Heat
+			m.airflow = c.HeatProfile[m.profile].Airflow
+			m.profile++
+		}
+	}
+
+	d_et := m.heat*simHeatGain - (simLoss+simAirflowLoss*air)*(m.et-c.Ambient)
+
+	switch m.phase {
+	case SimPhaseRoast:
+		diff := m.et - m.bean
+		d_et -= simBeanLoad * c.BatchKg * diff
+
+		// Larger batches need proportionally more energy per degree.
+		d_bean := (simTransfer + simAirTransfer*air) * diff / math.Sqrt(c.BatchKg)
+
+		// Evaporation during drying slows the beans down until ~160°C.
+		if m.bean > 100 && m.bean < 160 {
+			d_bean *= 1 - simDryingDip*math.Sin(math.Pi*(m.bean-100)/60)
+		}
+
+		// First crack absorbs heat for a while, flattening the curve.
+		if m.bean >= c.FirstCrackTemp && m.fc_left > 0 {
+			if m.fc_left == c.FirstCrackDrop {
+				events = append(events, "first_crack")
+			}
+			absorbed := math.Min(m.fc_left, d_bean*0.7*dt)
+			m.fc_left -= absorbed
+			d_bean -= absorbed / dt
+		}
+
+		m.bean += d_bean * dt
+		m.probe += (m.bean - m.probe) * math.Min(1, dt/simProbeTau)
+
+		if m.bean >= c.DropTemp || m.t >= c.MaxRoastS {
+			m.phase = SimPhaseDropped
+			m.t = 0
+			events = append(events, "drop")
+		}
+	default:
+		m.probe += (m.et*simEmptyProbe - m.probe) * math.Min(1, dt/simProbeTau)
+	}
+
+	m.et += d_et * dt
+	m.t += dt
+
+	switch m.phase {
+	case SimPhasePreheat:
+		if m.probe >= c.ChargeTemp {
+			m.charge()
+			events = append(events, "charge")
+		}
+	case SimPhaseDropped:
+		if c.CooldownS >= 0 && m.t >= c.CooldownS {
+			m.preheat()
+			events = append(events, "preheat")
+		}
+	}
+
+	return events
+}
+
+// Reading returns the noisy bean probe and environment temperatures.
+func (m *RoastModel) Reading() (bt float64, et float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	noise := m.config.Noise
+	return m.probe + rand.NormFloat64()*noise, m.et + rand.NormFloat64()*noise
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+// User roles.
+const (
+	RoleViewer   = "viewer"   // Watches the live curve and the history.
+	RoleOperator = "operator" // Runs roasts: start/stop, marks, control and PID.
+	RoleAdmin    = "admin"    // Everything, plus deleting sessions, users and the admin APIs.
+)
+
+// Permissions checked by the REST handlers and the WebSocket commands.
+const (
+	PermView    = "view"    // Read the live data, sessions and incidents.
+	PermOperate = "operate" // Start and stop sessions.
+	PermMark    = "mark"    // Set marks on sessions.
+	PermControl = "control" // Drive the heat/fan and the PID.
+	PermDelete  = "delete"  // Delete stored sessions and restore them from the trash.
+	PermExport  = "export"  // Download session data and reports.
+	PermAdmin   = "admin"   // Manage users and roles, replay.
+)
+
+// role_permissions is the permission matrix of each role.
+var role_permissions = map[string][]string{
+	RoleViewer:   {PermView},
+	RoleOperator: {PermView, PermOperate, PermMark, PermControl, PermExport},
+	RoleAdmin:    {PermView, PermOperate, PermMark, PermControl, PermDelete, PermExport, PermAdmin},
+}
+
+// API token scopes.
+const (
+	ScopeSessionsRead = "sessions:read" // Read and export sessions, watch the live data.
+	ScopeMarksWrite   = "marks:write"   // Set marks.
+	ScopeControl      = "control"       // Drive the heat/fan and the PID.
+)
+
+// scope_permissions are the permissions each API token scope grants, on top of the
+// limits of the role of the user who created the token.
+var scope_permissions = map[string][]string{
+	ScopeSessionsRead: {PermView, PermExport},
+	ScopeMarksWrite:   {PermMark},
+	ScopeControl:      {PermControl},
+}
+
+// ws_permissions is the permission each WebSocket command needs.
+var ws_permissions = map[string]string{
+	"get":     PermView,
+	"sync":    PermView,
+	"resume":  PermView,
+	"start":   PermOperate,
+	"stop":    PermOperate,
+	"mark":    PermMark,
+	"control": PermControl,
+	"pid":     PermControl,
+}
+
+// grpc_permissions is the permission each gRPC method needs. Every method of the
+// service must be listed: the gRPC server does not start otherwise.
+var grpc_permissions = map[string]string{
+	"ListSessions":  PermView,
+	"GetSession":    PermView,
+	"WatchReadings": PermView,
+	"DeleteSession": PermDelete,
+	"AddMark":       PermMark,
+	"StartSession":  PermOperate,
+	"StopSession":   PermOperate,
+}
+
+// ValidRole returns true for a known role.
+func ValidRole(role string) bool {
+	_, ok := role_permissions[role]
+	return ok
+}
+
+// HasPermission returns true if the user's role grants perm and, for API tokens, one of
+// the token scopes does too. Roles are enforced unless the server runs with -insecure,
+// which allows everything to everyone.
+func HasPermission(user User, perm string) bool {
+	if !auth_enabled {
+		return true
+	}
+	if !slices.Contains(role_permissions[user.Role], perm) {
+		return false
+	}
+	if user.TokenId == 0 {
+		return true
+	}
+	for _, scope := range user.Scopes {
+		if slices.Contains(scope_permissions[scope], perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// requirePermission rejects requests without a login (401) or whose user lacks perm (403).
+func requirePermission(perm string, next http.HandlerFunc) http.HandlerFunc {
+	return requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		user := currentUser(r)
+		if !HasPermission(user, perm) {
+			log.Printf("permiso %s denegado a %s (%s) en %s %s", perm, user.Actor(), user.Role, r.Method, r.URL.Path)
+			enabeCORS(w)
+			writeJSONError(w, http.StatusForbidden, fmt.Sprintf("permiso denegado: se requiere %s", perm))
+			return
+		}
+		next(w, r)
+	})
+}
+
+// rolesHandler returns the roles and their permissions.
+func rolesHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+	json.NewEncoder(w).Encode(map[string]any{"roles": role_permissions, "scopes": scope_permissions, "ws_commands": ws_permissions, "grpc_methods": grpc_permissions})
+}
+
+// setUserRoleHandler changes the role of the user {id}. The last administrator cannot
+// be demoted.
+func setUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+
+	user_id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "id invalido")
+		return
+	}
+
+	var body struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "body invalido")
+		return
+	}
+	defer r.Body.Close()
+
+	if !ValidRole(body.Role) {
+		writeJSONError(w, http.StatusBadRequest, "rol desconocido: "+body.Role)
+		return
+	}
+
+	user, err := user_data_provider.GetUserById(user_id)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if user.Role == RoleAdmin && body.Role != RoleAdmin && user_data_provider.CountRole(RoleAdmin) <= 1 {
+		writeJSONError(w, http.StatusConflict, "no se puede quitar el rol al ultimo administrador")
+		return
+	}
+
+	if err := user_data_provider.SetRole(user.Id, body.Role); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	log.Printf("%s cambio el rol de %s: %s -> %s", currentUser(r).Username, user.Username, user.Role, body.Role)
+
+	Audit(r, "user.role", user.Username, map[string]any{"from": user.Role, "to": body.Role})
+	user.Role = body.Role
+	json.NewEncoder(w).Encode(map[string]any{"status": true, "user": user})
+}
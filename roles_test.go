@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestHasPermission(t *testing.T) {
+	tests := []struct {
+		name string
+		auth bool
+		user User
+		perm string
+		want bool
+	}{
+		{"viewer watches", true, User{Role: RoleViewer}, PermView, true},
+		{"viewer cannot operate", true, User{Role: RoleViewer}, PermOperate, false},
+		{"operator controls", true, User{Role: RoleOperator}, PermControl, true},
+		{"operator cannot delete", true, User{Role: RoleOperator}, PermDelete, false},
+		{"admin deletes", true, User{Role: RoleAdmin}, PermDelete, true},
+		{"unknown role", true, User{Role: "root"}, PermView, false},
+		{"no user", true, User{}, PermView, false},
+		{"token within its scopes", true, User{Role: RoleAdmin, TokenId: 1, Scopes: []string{ScopeMarksWrite}}, PermMark, true},
+		{"token beyond its scopes", true, User{Role: RoleAdmin, TokenId: 1, Scopes: []string{ScopeMarksWrite}}, PermDelete, false},
+		{"token beyond the role", true, User{Role: RoleViewer, TokenId: 1, Scopes: []string{ScopeControl}}, PermControl, false},
+		{"insecure", false, User{}, PermAdmin, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withAuth(t, test.auth)
+			if got := HasPermission(test.user, test.perm); got != test.want {
+				t.Errorf("HasPermission(%+v, %s) = %v, want %v", test.user, test.perm, got, test.want)
+			}
+		})
+	}
+}
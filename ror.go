@@ -0,0 +1,78 @@
+package main
+
+// RoRWindow estimates the rate of rise of a temperature in degrees per minute, as the
+// least squares slope of the samples of the last few seconds.
+type RoRWindow struct {
+	WindowMs int64 // The length of the window.
+	ts       []int64
+	temps    []float64
+}
+
+// NewRoRWindow creates an estimator over the given window in seconds.
+func NewRoRWindow(seconds float64) *RoRWindow {
+	return &RoRWindow{WindowMs: int64(seconds * 1000)}
+}
+
+// Add appends a sample and drops the ones that fell out of the window.
+func (w *RoRWindow) Add(ts int64, temp float64) {
+	w.ts = append(w.ts, ts)
+	w.temps = append(w.temps, temp)
+
+	first := 0
+	for first < len(w.ts)-1 && ts-w.ts[first] > w.WindowMs {
+		first++
+	}
+	w.ts = w.ts[first:]
+	w.temps = w.temps[first:]
+}
+
+// Reset forgets every sample.
+func (w *RoRWindow) Reset() {
+	w.ts = nil
+	w.temps = nil
+}
+
+// RoR returns the rate of rise in degrees per minute and false while there are not
+// enough samples.
+func (w *RoRWindow) RoR() (float64, bool) {
+	return rorSlope(w.ts, w.temps)
+}
+
+// rorSlope returns the least squares slope of temps over ts (milliseconds) in degrees per minute.
+func rorSlope(ts []int64, temps []float64) (float64, bool) {
+	n := len(ts)
+	if n < 2 || ts[n-1] == ts[0] {
+		return 0, false
+	}
+
+	var mean_t, mean_v float64
+	for i := range ts {
+		mean_t += float64(ts[i]-ts[0]) / 60000
+		mean_v += temps[i]
+	}
+	mean_t /= float64(n)
+	mean_v /= float64(n)
+
+	var num, den float64
+	for i := range ts {
+		dt := float64(ts[i]-ts[0])/60000 - mean_t
+		num += dt * (temps[i] - mean_v)
+		den += dt * dt
+	}
+	if den == 0 {
+		return 0, false
+	}
+	return num / den, true
+}
+
+// RoRSeries returns the rate of rise at every sample of a session, computed over a
+// trailing window of the given seconds. Samples without enough history get 0.
+func RoRSeries(temps []*TempType, seconds float64) []float64 {
+	ror := make([]float64, len(temps))
+	window := NewRoRWindow(seconds)
+	for i, temp := range temps {
+		window.Add(temp.TimeStamp, temp.Temp)
+		ror[i], _ = window.RoR()
+	}
+	return ror
+}
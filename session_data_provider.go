@@ -2,8 +2,11 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"log"
+	"math"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -21,51 +24,223 @@ func NewSessionDataProvider(db *sql.DB) *SessionDataProvider {
 	return sdp
 }
 
-// GetSessions retrieves all roasting sessions from the database.
+// GetSessions retrieves all roasting sessions from the database, except those in the trash.
 func (this SessionDataProvider) GetSessions() []SessionData {
+	return this.querySessions("deleted_at = 0")
+}
+
+// GetTrash retrieves the sessions in the trash, most recently deleted first.
+func (this SessionDataProvider) GetTrash() []SessionData {
+	return this.querySessions("deleted_at <> 0 ORDER BY deleted_at DESC")
+}
+
+// QuerySessions retrieves a page of the sessions outside the trash matching the query,
+// and how many match in total.
+func (this SessionDataProvider) QuerySessions(query SessionQuery) SessionPage {
+	page := SessionPage{Sessions: []SessionData{}}
+
+	where := []string{"deleted_at = 0"}
+	args := []any{}
+
+	if match := ftsMatch(query.Search); match != "" {
+		where = append(where, "session_id IN (SELECT session_id FROM sessions_fts WHERE sessions_fts MATCH ?)")
+		args = append(args, match)
+	}
+	if query.From > 0 {
+		where = append(where, "created_at >= ?")
+		args = append(args, query.From)
+	}
+	if query.To > 0 {
+		where = append(where, "created_at <= ?")
+		args = append(args, query.To)
+	}
+	if query.Coffee != "" {
+		where = append(where, "coffee = ? COLLATE NOCASE")
+		args = append(args, query.Coffee)
+	}
+	if query.Roaster != "" {
+		where = append(where, "roaster = ? COLLATE NOCASE")
+		args = append(args, query.Roaster)
+	}
+	if query.User != "" {
+		where = append(where, "started_by = ?")
+		args = append(args, query.User)
+	}
+	if len(query.Tags) > 0 {
+		where = append(where, "session_id IN (SELECT session_id FROM session_tags WHERE tag IN (?"+strings.Repeat(",?", len(query.Tags)-1)+") GROUP BY session_id HAVING count(*) = ?)")
+		for _, tag := range query.Tags {
+			args = append(args, tag)
+		}
+		args = append(args, len(query.Tags))
+	}
+
+	count_sql := "SELECT count(*) FROM sessions WHERE " + strings.Join(where, " AND ")
+	if err := this.Db.QueryRow(count_sql, args...).Scan(&page.Total); err != nil {
+		log.Println("error al contar sessions,", err)
+	}
+
+	sort_expr := session_sort_columns[query.Sort]
+	order, cmp := "ASC", ">"
+	if query.Desc {
+		order, cmp = "DESC", "<"
+	}
+	if query.Cursor != nil {
+		where = append(where, "("+sort_expr+" "+cmp+" ? OR ("+sort_expr+" = ? AND session_id "+cmp+" ?))")
+		args = append(args, query.Cursor.Value, query.Cursor.Value, query.Cursor.Id)
+	}
+
+	sql := strings.Join(where, " AND ") + " ORDER BY " + sort_expr + " " + order + ", session_id " + order
+	if query.Limit == 0 {
+		page.Sessions = this.querySessions(sql, args...)
+		return page
+	}
+
+	// One extra row tells whether there is a next page.
+	args = append(args, query.Limit+1)
+	page.Sessions = this.querySessions(sql+" LIMIT ?", args...)
+
+	if len(page.Sessions) > query.Limit {
+		page.Sessions = page.Sessions[:query.Limit]
+		last := page.Sessions[len(page.Sessions)-1]
+		cursor := SessionCursor{Sort: query.Sort, Desc: query.Desc, Id: last.Id}
+		switch query.Sort {
+		case "created_at":
+			cursor.Value = float64(last.CreateAt)
+		case "duration":
+			if last.EndAt > 0 {
+				cursor.Value = float64(last.EndAt - last.CreateAt)
+			}
+		case "score":
+			cursor.Value = last.Score
+		}
+		page.NextCursor = cursor.Encode()
+	}
+
+	return page
+}
+
+// session_columns are the columns read by scanSession.
+const session_columns = `session_id,session_name,created_at,end_at,started_by,stopped_by,deleted_at,deleted_by,
+	coffee,roaster,score,notes,green_weight,roasted_weight,version`
+
+// scanSession reads a row of session_columns.
+func scanSession(row interface{ Scan(...any) error }, session *SessionData) error {
+	return row.Scan(&session.Id, &session.Name, &session.CreateAt, &session.EndAt, &session.StartedBy, &session.StoppedBy, &session.DeletedAt, &session.DeletedBy,
+		&session.Coffee, &session.Roaster, &session.Score, &session.Notes, &session.GreenWeight, &session.RoastedWeight, &session.Version)
+}
+
+// querySessions retrieves the sessions matching the where clause.
+func (this SessionDataProvider) querySessions(where string, args ...any) []SessionData {
 	data := []SessionData{}
 	get_sql := `
-		SELECT session_id,session_name,created_at,end_at FROM sessions 
-	`
+		SELECT ` + session_columns + ` FROM sessions 
+		WHERE ` + where
 
-	rows, err := this.Db.Query(get_sql)
+	rows, err := this.Db.Query(get_sql, args...)
 	if err != nil {
 		log.Println("error al obtener temps,", err)
 		return data
 	}
 
 	for rows.Next() {
-		var sID string
-		var sName string
-		var sCat int64
-		var sEat int64
+		var session SessionData
 
-		if err := rows.Scan(&sID, &sName, &sCat, &sEat); err != nil {
+		if err := scanSession(rows, &session); err != nil {
 			log.Println(err)
 		}
 
-		session := SessionData{
-			Id:       sID,
-			Name:     sName,
-			CreateAt: sCat,
-			EndAt:    sEat,
-		}
 		data = append(data, session)
 	}
+	rows.Close()
 
+	this.attachTags(data)
 	return data
 }
 
+// attachTags fills the tags of the sessions.
+func (this SessionDataProvider) attachTags(data []SessionData) {
+	if len(data) == 0 {
+		return
+	}
+
+	ids := make([]any, len(data))
+	index := map[string]int{}
+	for i := range data {
+		ids[i] = data[i].Id
+		index[data[i].Id] = i
+		data[i].Tags = []string{}
+	}
+
+	rows, err := this.Db.Query(`SELECT session_id,tag FROM session_tags WHERE session_id IN (?`+strings.Repeat(",?", len(ids)-1)+`) ORDER BY tag`, ids...)
+	if err != nil {
+		log.Println("error al obtener tags,", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var session_id, tag string
+		if err := rows.Scan(&session_id, &tag); err != nil {
+			log.Println(err)
+			continue
+		}
+		data[index[session_id]].Tags = append(data[index[session_id]].Tags, tag)
+	}
+}
+
+// SetSessionTags replaces the tags of a session.
+func (this SessionDataProvider) SetSessionTags(session_id string, tags []string) error {
+	tx, err := this.Db.Begin()
+	if err != nil {
+		log.Println("error al guardar tags", err)
+		return errors.New("error_set_tags")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM session_tags WHERE session_id = ?`, session_id); err != nil {
+		log.Println("error al guardar tags", err)
+		return errors.New("error_set_tags")
+	}
+	for _, tag := range tags {
+		if _, err := tx.Exec(`INSERT INTO session_tags (session_id,tag) VALUES (?,?)`, session_id, tag); err != nil {
+			log.Println("error al guardar tags", err)
+			return errors.New("error_set_tags")
+		}
+	}
+	return tx.Commit()
+}
+
+// GetSessionById retrieves a single roasting session from the database.
+func (this SessionDataProvider) GetSessionById(session_id string) (SessionData, error) {
+	get_sql := `
+		SELECT ` + session_columns + ` FROM sessions WHERE session_id = ?
+	`
+
+	var data SessionData
+	err := scanSession(this.Db.QueryRow(get_sql, session_id), &data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return data, errors.New("session no encontrada: " + session_id)
+	}
+	if err != nil {
+		log.Println("error al obtener session,", err)
+		return data, errors.New("error_get_session")
+	}
+
+	sessions := []SessionData{data}
+	this.attachTags(sessions)
+	return sessions[0], nil
+}
+
 // StartNewSession creates a new roasting session in the database.
-func (this SessionDataProvider) StartNewSession(session_id string, session_name string) error {
+func (this SessionDataProvider) StartNewSession(session_id string, session_name string, started_by string) error {
 
 	sql := `
-INSERT INTO sessions (session_id,session_name,created_at,end_at)
-VALUES (?,?,?,?) 
+INSERT INTO sessions (session_id,session_name,created_at,end_at,started_by)
+VALUES (?,?,?,?,?) 
 	`
 	current_time := time.Now()
 
-	_, err := this.Db.Exec(sql, session_id, session_name, current_time.UnixMilli(), 0)
+	_, err := this.Db.Exec(sql, session_id, session_name, current_time.UnixMilli(), 0, started_by)
 	if err != nil {
 		log.Println("error al crear session", err)
 		return errors.New("error_create_session")
@@ -74,32 +249,189 @@ VALUES (?,?,?,?)
 }
 
 // StopSession updates the end time of a roasting session in the database.
-func (this SessionDataProvider) StopSession(session_id string) {
+func (this SessionDataProvider) StopSession(session_id string, stopped_by string) {
 	log.Println("stop session: ", session_id)
 	sql := `
-UPDATE sessions set end_at = ?
+UPDATE sessions set end_at = ?, stopped_by = ?
 WHERE session_id = ?
 	`
 	current_time := time.Now()
 
-	_, err := this.Db.Exec(sql, current_time.UnixMilli(), session_id)
+	_, err := this.Db.Exec(sql, current_time.UnixMilli(), stopped_by, session_id)
 	if err != nil {
 		log.Println("error al detener session ", err)
 	}
 }
 
-// DeleteSession deletes a roasting session and its associated measurements from the database.
-func (this SessionDataProvider) DeleteSession(session_id string) {
+// DeleteSession moves a roasting session, with its measurements and marks, to the trash.
+func (this SessionDataProvider) DeleteSession(session_id string, deleted_by string) error {
 
 	sql := `
-	DELETE FROM sessions WHERE session_id = ?;
-	DELETE FROM measurements WHERE session_id = ?;
+UPDATE sessions set deleted_at = ?, deleted_by = ?
+WHERE session_id = ? AND deleted_at = 0
 	`
 
-	_, err := this.Db.Exec(sql, session_id, session_id)
+	res, err := this.Db.Exec(sql, time.Now().UnixMilli(), deleted_by, session_id)
+	if err != nil {
+		log.Println("error al eliminar session", err)
+		return errors.New("error_delete_session")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errors.New("session no encontrada: " + session_id)
+	}
+	return nil
+}
+
+// RestoreSession takes a roasting session out of the trash.
+func (this SessionDataProvider) RestoreSession(session_id string) error {
+
+	sql := `
+UPDATE sessions set deleted_at = 0, deleted_by = ''
+WHERE session_id = ? AND deleted_at <> 0
+	`
+
+	res, err := this.Db.Exec(sql, session_id)
+	if err != nil {
+		log.Println("error al restaurar session", err)
+		return errors.New("error_restore_session")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errors.New("la session no esta en la papelera: " + session_id)
+	}
+	return nil
+}
+
+// PurgeSession permanently deletes a roasting session in the trash and its associated
+// measurements, marks, control changes and PID log.
+func (this SessionDataProvider) PurgeSession(session_id string) error {
+
+	tables := []string{"measurements", "measurement_channels", "control_changes", "pid_log", "session_marks", "session_tags", "sessions"}
+
+	// Everything goes in one transaction, a failure halfway must not leave orphans.
+	tx, err := this.Db.Begin()
+	if err != nil {
+		log.Println("error al purgar session", err)
+		return errors.New("error_purge_session")
+	}
+	defer tx.Rollback()
+
+	var deleted_at int64
+	err = tx.QueryRow(`SELECT deleted_at FROM sessions WHERE session_id = ?`, session_id).Scan(&deleted_at)
+	if err != nil || deleted_at == 0 {
+		return errors.New("la session no esta en la papelera: " + session_id)
+	}
+
+	for _, table := range tables {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE session_id = ?`, session_id); err != nil {
+			log.Println("error al purgar session", err)
+			return errors.New("error_purge_session")
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("error al purgar session", err)
+		return errors.New("error_purge_session")
+	}
+	return nil
+}
+
+// UpdateSession applies the changes of a patch to a session outside the trash, if it is
+// still at the given version, and returns the updated session.
+func (this SessionDataProvider) UpdateSession(session_id string, version int64, patch SessionPatch) (SessionData, error) {
+	set := []string{"version = version + 1"}
+	args := []any{}
+
+	add := func(column string, value any) {
+		set = append(set, column+" = ?")
+		args = append(args, value)
+	}
+	if patch.Name != nil {
+		add("session_name", *patch.Name)
+	}
+	if patch.Notes != nil {
+		add("notes", *patch.Notes)
+	}
+	if patch.Coffee != nil {
+		add("coffee", *patch.Coffee)
+	}
+	if patch.Roaster != nil {
+		add("roaster", *patch.Roaster)
+	}
+	if patch.GreenWeight != nil {
+		add("green_weight", *patch.GreenWeight)
+	}
+	if patch.RoastedWeight != nil {
+		add("roasted_weight", *patch.RoastedWeight)
+	}
+	if patch.Score != nil {
+		add("score", *patch.Score)
+	}
+	if patch.CreateAt != nil {
+		add("created_at", *patch.CreateAt)
+	}
+	if patch.EndAt != nil {
+		add("end_at", *patch.EndAt)
+	}
+
+	tx, err := this.Db.Begin()
+	if err != nil {
+		log.Println("error al actualizar session", err)
+		return SessionData{}, errors.New("error_update_session")
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`UPDATE sessions SET `+strings.Join(set, ", ")+` WHERE session_id = ? AND version = ? AND deleted_at = 0`,
+		append(args, session_id, version)...)
+	if err != nil {
+		log.Println("error al actualizar session", err)
+		return SessionData{}, errors.New("error_update_session")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		current, err := this.GetSessionById(session_id)
+		if err != nil || current.DeletedAt != 0 {
+			return current, ErrSessionNotFound
+		}
+		return current, ErrVersionConflict
+	}
+
+	if patch.Tags != nil {
+		if _, err := tx.Exec(`DELETE FROM session_tags WHERE session_id = ?`, session_id); err != nil {
+			log.Println("error al guardar tags", err)
+			return SessionData{}, errors.New("error_set_tags")
+		}
+		for _, tag := range *patch.Tags {
+			if _, err := tx.Exec(`INSERT INTO session_tags (session_id,tag) VALUES (?,?)`, session_id, tag); err != nil {
+				log.Println("error al guardar tags", err)
+				return SessionData{}, errors.New("error_set_tags")
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("error al actualizar session", err)
+		return SessionData{}, errors.New("error_update_session")
+	}
+
+	return this.GetSessionById(session_id)
+}
+
+// GetExpiredTrash returns the ids of the sessions deleted before the given timestamp.
+func (this SessionDataProvider) GetExpiredTrash(before int64) []string {
+	ids := []string{}
+
+	rows, err := this.Db.Query(`SELECT session_id FROM sessions WHERE deleted_at <> 0 AND deleted_at < ?`, before)
 	if err != nil {
-		log.Println(err)
+		log.Println("error al obtener la papelera,", err)
+		return ids
 	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
 }
 
 // InsertTempValToSession inserts a temperature value for a given session into the database.
@@ -114,62 +446,195 @@ func (this SessionDataProvider) InsertTempValToSession(session_id string, temp T
 		log.Println("error al insertar temp", err)
 	}
 
+	channel_sql := `
+		INSERT INTO measurement_channels (session_id,timestamp,channel,value)
+		VALUES(?,?,?,?)`
+
+	for channel, value := range temp.Channels {
+		_, err := this.Db.Exec(channel_sql, session_id, temp.TimeStamp, channel, value)
+		if err != nil {
+			log.Println("error al insertar canal", channel, err)
+		}
+	}
+
 }
 
 // GetAllBySessionId retrieves all temperature measurements for a given session from the database.
 func (this *SessionDataProvider) GetAllBySessionId(session_id string) []*TempType {
+	return this.GetMeasurements(session_id, MeasurementQuery{})
+}
+
+// GetMeasurements retrieves the measurements of a session in a time range, with the
+// selected channels.
+func (this *SessionDataProvider) GetMeasurements(session_id string, query MeasurementQuery) []*TempType {
 
 	data := []*TempType{}
+	where, args := query.where(session_id)
 	get_sql := `
-		SELECT * FROM measurements WHERE session_id = ? ORDER BY timestamp 
+		SELECT timestamp,temp_val FROM measurements WHERE ` + where + ` ORDER BY timestamp
 	`
 
-	rows, err := this.Db.Query(get_sql, session_id)
+	rows, err := this.Db.Query(get_sql, args...)
 	if err != nil {
 		log.Println("error al obtener temps,", err)
 		return data
 	}
+	defer rows.Close()
 
 	for rows.Next() {
-		var sID string
 		var ts int64
 		var temp float64
 
-		if err := rows.Scan(&sID, &ts, &temp); err != nil {
+		if err := rows.Scan(&ts, &temp); err != nil {
 			log.Println(err)
+			continue
 		}
 
-		var temp_ *TempType = &TempType{Temp: temp, TimeStamp: ts}
-		data = append(data, temp_)
+		data = append(data, &TempType{Temp: temp, TimeStamp: ts})
 	}
 
+	this.attachChannels(session_id, data, query)
+
 	return data
 
 }
 
-// SetMark inserts a new mark for a session into the database.
-func (this SessionDataProvider) SetMark(mark Mark) {
+// attachChannels loads the named channel readings of a session and attaches them to
+// the measurements with the same timestamp.
+func (this *SessionDataProvider) attachChannels(session_id string, data []*TempType, query MeasurementQuery) {
+	if len(data) == 0 {
+		return
+	}
+	where, args := query.where(session_id)
+	if query.Channels != nil {
+		if len(query.Channels) == 0 {
+			return
+		}
+		for _, channel := range query.Channels {
+			args = append(args, channel)
+		}
+		where += " AND channel IN (" + strings.TrimSuffix(strings.Repeat("?,", len(query.Channels)), ",") + ")"
+	}
+	get_sql := `
+		SELECT timestamp,channel,value FROM measurement_channels WHERE ` + where
 
-	if mark.SessionId == "" {
+	rows, err := this.Db.Query(get_sql, args...)
+	if err != nil {
+		log.Println("error al obtener canales,", err)
 		return
 	}
+	defer rows.Close()
+
+	by_ts := make(map[int64]*TempType, len(data))
+	for _, temp := range data {
+		by_ts[temp.TimeStamp] = temp
+	}
+
+	for rows.Next() {
+		var ts int64
+		var channel string
+		var value float64
+
+		if err := rows.Scan(&ts, &channel, &value); err != nil {
+			log.Println(err)
+			continue
+		}
+
+		temp, ok := by_ts[ts]
+		if !ok {
+			continue
+		}
+		if temp.Channels == nil {
+			temp.Channels = map[string]float64{}
+		}
+		temp.Channels[channel] = value
+	}
+}
+
+// GetMarkTimestamp returns the timestamp of the sample a mark points at, as
+// markSampleIndex does on loaded measurements, and false for sessions without them.
+func (this SessionDataProvider) GetMarkTimestamp(session_id string, mark Mark) (int64, bool) {
+	var first, last sql.NullInt64
+	err := this.Db.QueryRow(`SELECT MIN(timestamp),MAX(timestamp) FROM measurements WHERE session_id = ?`, session_id).Scan(&first, &last)
+	if err != nil || !first.Valid {
+		return 0, false
+	}
+
+	var ts sql.NullInt64
+	if mark.CreatedAt < first.Int64 {
+		// Marks of the chart hold the index of the sample.
+		err = this.Db.QueryRow(`SELECT timestamp FROM measurements WHERE session_id = ? ORDER BY timestamp LIMIT 1 OFFSET ?`,
+			session_id, max(mark.CreatedAt, 0)).Scan(&ts)
+	} else {
+		err = this.Db.QueryRow(`SELECT MIN(timestamp) FROM measurements WHERE session_id = ? AND timestamp >= ?`,
+			session_id, mark.CreatedAt).Scan(&ts)
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Println("error al obtener temps,", err)
+		return 0, false
+	}
+	if !ts.Valid {
+		return last.Int64, true
+	}
+	return ts.Int64, true
+}
+
+// SetMark inserts a new mark for an existing session into the database and returns it
+// with its ID.
+func (this SessionDataProvider) SetMark(mark Mark) (Mark, error) {
+
+	if mark.SessionId == "" {
+		return mark, errors.New("se requiere session_id")
+	}
+	if stored, err := this.GetSessionById(mark.SessionId); err != nil || stored.DeletedAt != 0 {
+		return mark, ErrSessionNotFound
+	}
 	sql := `
 
-INSERT INTO session_marks (session_id,mark_name,created_at,on_temp) 
-VALUES (?,?,?,?);
+INSERT INTO session_marks (session_id,mark_name,created_at,on_temp,created_by,channels,ror) 
+VALUES (?,?,?,?,?,?,?);
 `
 
-	_, err := this.Db.Exec(sql, mark.SessionId, mark.MarkName, mark.CreatedAt, mark.OnTemp)
+	channels := ""
+	if len(mark.Channels) > 0 {
+		data, _ := json.Marshal(mark.Channels)
+		channels = string(data)
+	}
+
+	res, err := this.Db.Exec(sql, mark.SessionId, mark.MarkName, mark.CreatedAt, mark.OnTemp, mark.CreatedBy, channels, mark.RoR)
 	if err != nil {
 		log.Println("error al set mark", err)
+		return mark, errors.New("error_set_mark")
 	}
+	mark.Id, _ = res.LastInsertId()
+	return mark, nil
 }
 
-// GetMarksOfSessions retrieves all marks for a given session from the database.
+// mark_columns are the columns read by scanMark.
+const mark_columns = `id,session_id,mark_name,created_at,on_temp,created_by,channels,ror`
+
+// scanMark reads a row of mark_columns.
+func scanMark(row interface{ Scan(...any) error }, mark *Mark) error {
+	var channels string
+	var ror sql.NullFloat64
+	if err := row.Scan(&mark.Id, &mark.SessionId, &mark.MarkName, &mark.CreatedAt, &mark.OnTemp, &mark.CreatedBy, &channels, &ror); err != nil {
+		return err
+	}
+	if channels != "" {
+		json.Unmarshal([]byte(channels), &mark.Channels)
+	}
+	if ror.Valid {
+		mark.RoR = &ror.Float64
+	}
+	return nil
+}
+
+// GetMarksOfSessions retrieves all marks for a given session from the database, in time order.
 func (this SessionDataProvider) GetMarksOfSessions(session_id string) []Mark {
 	marks := []Mark{}
 	get_sql := `
-		SELECT mark_name,created_at,on_temp from session_marks where session_id = ?
+		SELECT ` + mark_columns + ` from session_marks where session_id = ?
+		ORDER BY created_at, id
 	`
 
 	rows, err := this.Db.Query(get_sql, session_id)
@@ -177,27 +642,262 @@ func (this SessionDataProvider) GetMarksOfSessions(session_id string) []Mark {
 		log.Println("error al obtener temps,", err)
 		return marks
 	}
+	defer rows.Close()
 
 	for rows.Next() {
-		var markName string
-		var markCat int64
-		var markOnTemp float64
+		var mark Mark
 
-		if err := rows.Scan(&markName, &markCat, &markOnTemp); err != nil {
+		if err := scanMark(rows, &mark); err != nil {
 			log.Println(err)
 		}
 
-		mark := Mark{
-			MarkName:  markName,
-			CreatedAt: markCat,
-			OnTemp:    markOnTemp,
-		}
 		marks = append(marks, mark)
 	}
 
 	return marks
 }
 
+// GetMarkById retrieves a single mark.
+func (this SessionDataProvider) GetMarkById(mark_id int64) (Mark, error) {
+	var mark Mark
+
+	err := scanMark(this.Db.QueryRow(`SELECT `+mark_columns+` from session_marks where id = ?`, mark_id), &mark)
+	if errors.Is(err, sql.ErrNoRows) {
+		return mark, errors.New("mark no encontrada")
+	}
+	if err != nil {
+		log.Println("error al obtener mark,", err)
+		return mark, errors.New("error_get_mark")
+	}
+	return mark, nil
+}
+
+// UpdateMark changes the name, time, temperature, channels and RoR of a mark.
+func (this SessionDataProvider) UpdateMark(mark Mark) error {
+	channels := ""
+	if len(mark.Channels) > 0 {
+		data, _ := json.Marshal(mark.Channels)
+		channels = string(data)
+	}
+	_, err := this.Db.Exec(`UPDATE session_marks SET mark_name = ?, created_at = ?, on_temp = ?, channels = ?, ror = ? WHERE id = ?`,
+		mark.MarkName, mark.CreatedAt, mark.OnTemp, channels, mark.RoR, mark.Id)
+	if err != nil {
+		log.Println("error al actualizar mark", err)
+		return errors.New("error_update_mark")
+	}
+	return nil
+}
+
+// DeleteMark deletes a mark.
+func (this SessionDataProvider) DeleteMark(mark_id int64) error {
+	res, err := this.Db.Exec(`DELETE FROM session_marks WHERE id = ?`, mark_id)
+	if err != nil {
+		log.Println("error al eliminar mark", err)
+		return errors.New("error_delete_mark")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errors.New("mark no encontrada")
+	}
+	return nil
+}
+
+// TempAt returns the bean temperature of a session at timestamp, interpolated between
+// the surrounding measurements, or the nearest one outside the measured range.
+func (this SessionDataProvider) TempAt(session_id string, timestamp int64) (float64, bool) {
+	var before_ts, after_ts int64
+	var before, after float64
+
+	err_before := this.Db.QueryRow(`SELECT timestamp,temp_val FROM measurements WHERE session_id = ? AND timestamp <= ? ORDER BY timestamp DESC LIMIT 1`, session_id, timestamp).
+		Scan(&before_ts, &before)
+	err_after := this.Db.QueryRow(`SELECT timestamp,temp_val FROM measurements WHERE session_id = ? AND timestamp >= ? ORDER BY timestamp ASC LIMIT 1`, session_id, timestamp).
+		Scan(&after_ts, &after)
+
+	switch {
+	case err_before != nil && err_after != nil:
+		return 0, false
+	case err_before != nil:
+		return after, true
+	case err_after != nil || after_ts == before_ts:
+		return before, true
+	}
+	return before + (after-before)*float64(timestamp-before_ts)/float64(after_ts-before_ts), true
+}
+
+// InsertControlChange stores a control change applied during a session.
+func (this SessionDataProvider) InsertControlChange(session_id string, state ControlState) {
+
+	insert_sql := `
+		INSERT INTO control_changes (session_id,timestamp,heat,fan,origin,limited)
+		VALUES(?,?,?,?,?,?)`
+
+	_, err := this.Db.Exec(insert_sql, session_id, state.TimeStamp, state.Heat, state.Fan, state.Origin, state.Limited)
+	if err != nil {
+		log.Println("error al insertar control", err)
+	}
+}
+
+// GetControlsOfSession retrieves the control changes of a session, ordered by time.
+func (this SessionDataProvider) GetControlsOfSession(session_id string) []ControlState {
+	controls := []ControlState{}
+	get_sql := `
+		SELECT timestamp,heat,fan,origin,limited FROM control_changes WHERE session_id = ? ORDER BY timestamp
+	`
+
+	rows, err := this.Db.Query(get_sql, session_id)
+	if err != nil {
+		log.Println("error al obtener controles,", err)
+		return controls
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var state ControlState
+		if err := rows.Scan(&state.TimeStamp, &state.Heat, &state.Fan, &state.Origin, &state.Limited); err != nil {
+			log.Println(err)
+			continue
+		}
+		controls = append(controls, state)
+	}
+
+	return controls
+}
+
+// InsertPIDLog stores the setpoint, process value and output of the profile follower at one sample.
+func (this SessionDataProvider) InsertPIDLog(session_id string, entry PIDLog) {
+
+	insert_sql := `
+		INSERT INTO pid_log (session_id,timestamp,setpoint,pv,output,mode)
+		VALUES(?,?,?,?,?,?)`
+
+	_, err := this.Db.Exec(insert_sql, session_id, entry.TimeStamp, entry.Setpoint, entry.PV, entry.Output, entry.Mode)
+	if err != nil {
+		log.Println("error al insertar pid", err)
+	}
+}
+
+// GetPIDLogOfSession retrieves the profile follower log of a session, ordered by time.
+func (this SessionDataProvider) GetPIDLogOfSession(session_id string) []PIDLog {
+	entries := []PIDLog{}
+	get_sql := `
+		SELECT timestamp,setpoint,pv,output,mode FROM pid_log WHERE session_id = ? ORDER BY timestamp
+	`
+
+	rows, err := this.Db.Query(get_sql, session_id)
+	if err != nil {
+		log.Println("error al obtener pid,", err)
+		return entries
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry PIDLog
+		if err := rows.Scan(&entry.TimeStamp, &entry.Setpoint, &entry.PV, &entry.Output, &entry.Mode); err != nil {
+			log.Println(err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// InsertIncident appends a watchdog incident to the incident log and returns its id.
+func (this SessionDataProvider) InsertIncident(incident Incident) int64 {
+
+	insert_sql := `
+		INSERT INTO incidents (session_id,timestamp,kind,level,channel,value,msg,actions)
+		VALUES(?,?,?,?,?,?,?,?)`
+
+	res, err := this.Db.Exec(insert_sql, incident.SessionId, incident.TimeStamp, incident.Kind, incident.Level, incident.Channel, incident.Value, incident.Msg, incident.Actions)
+	if err != nil {
+		log.Println("error al insertar incidente", err)
+		return 0
+	}
+	id, _ := res.LastInsertId()
+	return id
+}
+
+// GetIncidents retrieves the latest incidents, newest first, optionally only those of a session.
+func (this SessionDataProvider) GetIncidents(session_id string, limit int) []Incident {
+	incidents := []Incident{}
+	get_sql := `
+		SELECT id,session_id,timestamp,kind,level,channel,value,msg,actions FROM incidents
+		WHERE ? = '' OR session_id = ?
+		ORDER BY timestamp DESC LIMIT ?
+	`
+
+	rows, err := this.Db.Query(get_sql, session_id, session_id, limit)
+	if err != nil {
+		log.Println("error al obtener incidentes,", err)
+		return incidents
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var incident Incident
+		if err := rows.Scan(&incident.Id, &incident.SessionId, &incident.TimeStamp, &incident.Kind, &incident.Level, &incident.Channel, &incident.Value, &incident.Msg, &incident.Actions); err != nil {
+			log.Println(err)
+			continue
+		}
+		incidents = append(incidents, incident)
+	}
+
+	return incidents
+}
+
+// InsertAudit appends an entry to the audit log.
+func (this SessionDataProvider) InsertAudit(entry AuditEntry) {
+
+	insert_sql := `
+		INSERT INTO audit_log (timestamp,actor,action,target,detail,remote)
+		VALUES(?,?,?,?,?,?)`
+
+	_, err := this.Db.Exec(insert_sql, entry.TimeStamp, entry.Actor, entry.Action, entry.Target, string(entry.Detail), entry.Remote)
+	if err != nil {
+		log.Println("error al insertar auditoria", err)
+	}
+}
+
+// GetAudit retrieves the audit log entries matching filter, newest first.
+func (this SessionDataProvider) GetAudit(filter AuditFilter) []AuditEntry {
+	entries := []AuditEntry{}
+
+	to := filter.To
+	if to <= 0 {
+		to = math.MaxInt64
+	}
+	action, prefix := strings.CutSuffix(filter.Action, "*")
+
+	get_sql := `
+		SELECT id,timestamp,actor,action,target,detail,remote FROM audit_log
+		WHERE (? = '' OR actor = ?) AND (? = '' OR action = ? OR (? AND action LIKE ? || '%'))
+			AND timestamp >= ? AND timestamp <= ?
+		ORDER BY id DESC LIMIT ?
+	`
+
+	rows, err := this.Db.Query(get_sql, filter.Actor, filter.Actor, action, action, prefix, action, filter.From, to, filter.Limit)
+	if err != nil {
+		log.Println("error al obtener auditoria,", err)
+		return entries
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry AuditEntry
+		var detail string
+		if err := rows.Scan(&entry.Id, &entry.TimeStamp, &entry.Actor, &entry.Action, &entry.Target, &detail, &entry.Remote); err != nil {
+			log.Println(err)
+			continue
+		}
+		if detail != "" {
+			entry.Detail = json.RawMessage(detail)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
 // Prepare creates the necessary tables in the database if they don't already exist.
 func (this SessionDataProvider) Prepare() {
 
@@ -210,6 +910,75 @@ create table if NOT EXISTS measurements
   	PRIMARY KEY (session_id,timestamp)
 );
 
+create table if NOT EXISTS measurement_channels
+(
+	session_id text NOT NULL,
+  	timestamp integer not null,
+	channel text not null,
+	value real not null,
+  	PRIMARY KEY (session_id,timestamp,channel)
+);
+
+create table if NOT EXISTS control_changes
+(
+	session_id text NOT NULL,
+  	timestamp integer not null,
+	heat real not null,
+	fan real not null,
+	origin text not null,
+	limited integer not null default 0
+);
+
+create index if NOT EXISTS control_changes_session on control_changes (session_id,timestamp);
+
+create table if NOT EXISTS pid_log
+(
+	session_id text NOT NULL,
+  	timestamp integer not null,
+	setpoint real not null,
+	pv real not null,
+	output real not null,
+	mode text not null,
+  	PRIMARY KEY (session_id,timestamp)
+);
+
+create table if NOT EXISTS incidents
+(
+	id integer PRIMARY KEY AUTOINCREMENT,
+	session_id text not null,
+  	timestamp integer not null,
+	kind text not null,
+	level text not null,
+	channel text not null,
+	value real not null,
+	msg text not null,
+	actions text not null
+);
+
+create table if NOT EXISTS audit_log
+(
+	id integer PRIMARY KEY AUTOINCREMENT,
+  	timestamp integer not null,
+	actor text not null,
+	action text not null,
+	target text not null,
+	detail text not null,
+	remote text not null
+);
+
+create index if NOT EXISTS audit_log_timestamp on audit_log (timestamp);
+
+-- The audit log is append-only.
+create trigger if NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+BEGIN
+	SELECT RAISE(ABORT, 'audit_log es solo de escritura');
+END;
+
+create trigger if NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+BEGIN
+	SELECT RAISE(ABORT, 'audit_log es solo de escritura');
+END;
+
 create table if NOT EXISTS sessions 
 (
 	session_id text NOT NULL,
@@ -219,13 +988,41 @@ create table if NOT EXISTS sessions
   	PRIMARY KEY (created_at,session_id)
 );
 
+create table if NOT EXISTS session_tags
+(
+	session_id text NOT NULL,
+	tag text not null,
+  	PRIMARY KEY (session_id,tag)
+);
+
+create index if NOT EXISTS session_tags_tag on session_tags (tag);
+
+-- Full-text index of the session names, kept in sync by triggers.
+create virtual table if NOT EXISTS sessions_fts using fts4(session_id, session_name, notindexed=session_id, tokenize=unicode61);
+
+create trigger if NOT EXISTS sessions_fts_insert AFTER INSERT ON sessions
+BEGIN
+	INSERT INTO sessions_fts (session_id,session_name) VALUES (new.session_id, new.session_name);
+END;
+
+create trigger if NOT EXISTS sessions_fts_update AFTER UPDATE OF session_name ON sessions
+BEGIN
+	UPDATE sessions_fts SET session_name = new.session_name WHERE session_id = new.session_id;
+END;
+
+create trigger if NOT EXISTS sessions_fts_delete AFTER DELETE ON sessions
+BEGIN
+	DELETE FROM sessions_fts WHERE session_id = old.session_id;
+END;
+
 create table if NOT EXISTS session_marks
 (
+	id integer PRIMARY KEY AUTOINCREMENT,
 	session_id text NOT NULL,
   	mark_name text not null,
   	created_at integer not null,
 	on_temp real not null,
-  	PRIMARY KEY (session_id,created_at)
+	created_by text not null default ''
 );
 	`
 
@@ -234,5 +1031,101 @@ create table if NOT EXISTS session_marks
 		log.Printf("error al crear la tablas")
 	}
 
+	// Columns added after the first release.
+	addColumn(this.Db, "sessions", "started_by", "text not null default ''")
+	addColumn(this.Db, "sessions", "stopped_by", "text not null default ''")
+	addColumn(this.Db, "session_marks", "created_by", "text not null default ''")
+	this.migrateMarkIds()
+	addColumn(this.Db, "session_marks", "channels", "text not null default ''")
+	addColumn(this.Db, "session_marks", "ror", "real")
+	addColumn(this.Db, "sessions", "deleted_at", "integer not null default 0")
+	addColumn(this.Db, "sessions", "deleted_by", "text not null default ''")
+	addColumn(this.Db, "sessions", "coffee", "text not null default ''")
+	addColumn(this.Db, "sessions", "roaster", "text not null default ''")
+	addColumn(this.Db, "sessions", "score", "real not null default 0")
+	addColumn(this.Db, "sessions", "notes", "text not null default ''")
+	addColumn(this.Db, "sessions", "green_weight", "real not null default 0")
+	addColumn(this.Db, "sessions", "roasted_weight", "real not null default 0")
+	addColumn(this.Db, "sessions", "version", "integer not null default 1")
+
+	// Index the sessions created before the full-text index existed.
+	_, err = this.Db.Exec(`INSERT INTO sessions_fts (session_id,session_name) SELECT session_id,session_name FROM sessions WHERE session_id NOT IN (SELECT session_id FROM sessions_fts)`)
+	if err != nil {
+		log.Println("error al indexar sessions", err)
+	}
+
 	log.Println("tablas creadas con exito.")
 }
+
+// migrateMarkIds rebuilds the session_marks table of databases where marks were keyed by
+// (session_id, created_at) so every mark gets its own ID.
+func (this SessionDataProvider) migrateMarkIds() {
+	if hasColumn(this.Db, "session_marks", "id") {
+		this.Db.Exec(`create index if NOT EXISTS session_marks_session on session_marks (session_id,created_at)`)
+		return
+	}
+
+	migrate_sql := `
+create table session_marks_new
+(
+	id integer PRIMARY KEY AUTOINCREMENT,
+	session_id text NOT NULL,
+  	mark_name text not null,
+  	created_at integer not null,
+	on_temp real not null,
+	created_by text not null default ''
+);
+INSERT INTO session_marks_new (session_id,mark_name,created_at,on_temp,created_by)
+	SELECT session_id,mark_name,created_at,on_temp,created_by FROM session_marks ORDER BY session_id,created_at;
+DROP TABLE session_marks;
+ALTER TABLE session_marks_new RENAME TO session_marks;
+create index session_marks_session on session_marks (session_id,created_at);
+`
+
+	tx, err := this.Db.Begin()
+	if err != nil {
+		log.Println("error al migrar session_marks", err)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(migrate_sql); err != nil {
+		log.Println("error al migrar session_marks", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("error al migrar session_marks", err)
+		return
+	}
+	log.Println("session_marks migrada a ids propios")
+}
+
+// hasColumn returns true if the table has the column.
+func hasColumn(db *sql.DB, table string, column string) bool {
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		log.Println("error al leer columnas de", table, err)
+		return false
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err == nil && name == column {
+			return true
+		}
+	}
+	return false
+}
+
+// addColumn adds a column to an existing table unless it is already there.
+func addColumn(db *sql.DB, table string, column string, definition string) {
+	if hasColumn(db, table, column) {
+		return
+	}
+	if _, err := db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition); err != nil {
+		log.Println("error al agregar columna", table, column, err)
+		return
+	}
+	log.Printf("columna %s.%s agregada", table, column)
+}
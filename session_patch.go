@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrSessionNotFound = errors.New("session no encontrada")
+	ErrSessionActive   = errors.New("no se puede eliminar la session en curso")
+	ErrVersionConflict = errors.New("la session fue modificada por otro cliente")
+)
+
+// SessionPatch holds the session fields to change; nil fields are left as they are.
+type SessionPatch struct {
+	Name          *string   `json:"name,omitempty"`
+	Notes         *string   `json:"notes,omitempty"`
+	Tags          *[]string `json:"tags,omitempty"`
+	Coffee        *string   `json:"coffee,omitempty"`
+	Roaster       *string   `json:"roaster,omitempty"`
+	GreenWeight   *float64  `json:"green_weight,omitempty"`
+	RoastedWeight *float64  `json:"roasted_weight,omitempty"`
+	Score         *float64  `json:"score,omitempty"`
+	CreateAt      *int64    `json:"create_at,omitempty"`
+	EndAt         *int64    `json:"end_at,omitempty"`
+	Version       *int64    `json:"version,omitempty"` // The version being edited, when If-Match is not sent.
+}
+
+// Validate normalizes the patch and checks it against the current session.
+func (p *SessionPatch) Validate(current SessionData) error {
+	text := func(name string, v *string, max int, required bool) error {
+		if v == nil {
+			return nil
+		}
+		*v = strings.TrimSpace(*v)
+		if required && *v == "" {
+			return fmt.Errorf("%s no puede estar vacio", name)
+		}
+		if utf8.RuneCountInString(*v) > max {
+			return fmt.Errorf("%s admite hasta %d caracteres", name, max)
+		}
+		return nil
+	}
+	if err := errors.Join(
+		text("name", p.Name, 200, true),
+		text("notes", p.Notes, 10000, false),
+		text("coffee", p.Coffee, 200, false),
+		text("roaster", p.Roaster, 200, false),
+	); err != nil {
+		return err
+	}
+
+	if p.Tags != nil {
+		tags := NormalizeTags(*p.Tags)
+		if len(tags) > 20 {
+			return errors.New("se admiten hasta 20 tags")
+		}
+		for _, tag := range tags {
+			if utf8.RuneCountInString(tag) > 40 {
+				return errors.New("los tags admiten hasta 40 caracteres")
+			}
+		}
+		p.Tags = &tags
+	}
+
+	green, roasted := current.GreenWeight, current.RoastedWeight
+	if p.GreenWeight != nil {
+		green = *p.GreenWeight
+	}
+	if p.RoastedWeight != nil {
+		roasted = *p.RoastedWeight
+	}
+	if green < 0 || roasted < 0 {
+		return errors.New("los pesos no pueden ser negativos")
+	}
+	if green > 0 && roasted > green {
+		return errors.New("roasted_weight no puede ser mayor que green_weight")
+	}
+
+	if p.Score != nil && (*p.Score < 0 || *p.Score > 100) {
+		return errors.New("score debe estar entre 0 y 100")
+	}
+
+	if p.CreateAt != nil || p.EndAt != nil {
+		if session.IsCurrent(current.Id) {
+			return errors.New("no se puede cambiar el horario de la session en curso")
+		}
+		create_at, end_at := current.CreateAt, current.EndAt
+		if p.CreateAt != nil {
+			create_at = *p.CreateAt
+		}
+		if p.EndAt != nil {
+			end_at = *p.EndAt
+		}
+		if create_at <= 0 || end_at <= create_at {
+			return errors.New("end_at debe ser posterior a create_at")
+		}
+	}
+
+	return nil
+}
+
+// sessionETag returns the entity tag of a session version.
+func sessionETag(s SessionData) string {
+	return `"v` + strconv.FormatInt(s.Version, 10) + `"`
+}
+
+// parseETag returns the version of an entity tag made by sessionETag.
+func parseETag(etag string) (int64, bool) {
+	etag = strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+	v, ok := strings.CutPrefix(strings.Trim(etag, `"`), "v")
+	if !ok {
+		return 0, false
+	}
+	version, err := strconv.ParseInt(v, 10, 64)
+	return version, err == nil
+}
+
+// roastSessionPatchHandler edits the metadata of the session {id}. The version being
+// edited must be given with If-Match (the ETag of the session) or in the body;
+// concurrent edits fail with 412 and the current session.
+func roastSessionPatchHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+	session_id := r.PathValue("id")
+
+	var patch SessionPatch
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patch); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "body invalido: "+err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	var version int64
+	if if_match := r.Header.Get("If-Match"); if_match != "" {
+		v, ok := parseETag(if_match)
+		if !ok {
+			writeJSONError(w, http.StatusBadRequest, "If-Match invalido")
+			return
+		}
+		version = v
+	} else if patch.Version != nil {
+		version = *patch.Version
+	} else {
+		writeJSONError(w, http.StatusPreconditionRequired, "se requiere If-Match o version")
+		return
+	}
+
+	current, err := session_data_provider.GetSessionById(session_id)
+	if err != nil || current.DeletedAt != 0 {
+		writeJSONError(w, http.StatusNotFound, ErrSessionNotFound.Error())
+		return
+	}
+	if err := patch.Validate(current); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	updated, err := session_data_provider.UpdateSession(session_id, version, patch)
+	switch {
+	case errors.Is(err, ErrVersionConflict):
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", sessionETag(updated))
+		w.WriteHeader(http.StatusPreconditionFailed)
+		json.NewEncoder(w).Encode(map[string]any{"status": false, "error": true, "msg": err.Error(), "session": updated})
+		return
+	case errors.Is(err, ErrSessionNotFound):
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if patch.Name != nil {
+		session.Rename(session_id, updated.Name)
+	}
+	live_roaster.Update(updated)
+
+	patch.Version = nil
+	log.Printf("session %s editada (version %d)", session_id, updated.Version)
+	Audit(r, "session.update", session_id, patch)
+	send_data_to_clients(map[string]any{"type": "session_updated", "session": updated, "changes": patch})
+
+	w.Header().Set("ETag", sessionETag(updated))
+	json.NewEncoder(w).Encode(map[string]any{"status": true, "session": updated})
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// SessionQuery filters, sorts and paginates the session list.
+type SessionQuery struct {
+	Search  string   // Full-text search on the session name.
+	From    int64    // Only sessions created at or after this timestamp (in milliseconds).
+	To      int64    // Only sessions created at or before this timestamp (in milliseconds); 0 for no limit.
+	Coffee  string   // Only sessions of this coffee (case insensitive).
+	Roaster string   // Only sessions on this roaster (case insensitive).
+	User    string   // Only sessions started by this user.
+	Tags    []string // Only sessions having all of these tags.
+	Sort    string   // "created_at", "duration" or "score".
+	Desc    bool     // Sort in descending order.
+	Limit   int      // The page size; 0 returns every session, like the list before pagination.
+	Cursor  *SessionCursor
+}
+
+// SessionPage is a page of the session list.
+type SessionPage struct {
+	Sessions   []SessionData `json:"sessions"`
+	Total      int           `json:"total"`                 // The number of sessions matching the filters, on every page.
+	NextCursor string        `json:"next_cursor,omitempty"` // Pass as cursor to get the next page; empty on the last page.
+}
+
+// SessionCursor is the position after the last session of a page. It is sent to
+// clients as an opaque string.
+type SessionCursor struct {
+	Sort  string  `json:"s"`
+	Desc  bool    `json:"d"`
+	Value float64 `json:"v"` // The sort value of the last session.
+	Id    string  `json:"i"` // The id of the last session, to break ties.
+}
+
+// session_sort_columns are the sort keys of the session list and their SQL expressions.
+var session_sort_columns = map[string]string{
+	"created_at": "created_at",
+	"duration":   "(CASE WHEN end_at > 0 THEN end_at - created_at ELSE 0 END)",
+	"score":      "score",
+}
+
+const (
+	session_page_default = 50
+	session_page_max     = 500
+)
+
+// Encode returns the cursor as an opaque string.
+func (c SessionCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeSessionCursor parses a cursor returned by Encode.
+func DecodeSessionCursor(s string) (*SessionCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("cursor invalido")
+	}
+	var cursor SessionCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Id == "" {
+		return nil, errors.New("cursor invalido")
+	}
+	return &cursor, nil
+}
+
+// ParseSessionQuery reads the session list parameters from a query string:
+// q, from, to, coffee, roaster, user, tag (repeatable, or comma separated tags),
+// sort, order, limit and cursor. Without limit nor cursor every session is returned,
+// as clients written before pagination expect.
+func ParseSessionQuery(values url.Values) (SessionQuery, error) {
+	query := SessionQuery{
+		Search:  strings.TrimSpace(values.Get("q")),
+		Coffee:  strings.TrimSpace(values.Get("coffee")),
+		Roaster: strings.TrimSpace(values.Get("roaster")),
+		User:    strings.TrimSpace(values.Get("user")),
+		Sort:    values.Get("sort"),
+		Desc:    values.Get("order") != "asc",
+	}
+
+	var err error
+	if query.From, err = parseTimeParam(values.Get("from"), false); err != nil {
+		return query, errors.New("from: " + err.Error())
+	}
+	if query.To, err = parseTimeParam(values.Get("to"), true); err != nil {
+		return query, errors.New("to: " + err.Error())
+	}
+
+	for _, v := range append(values["tag"], values["tags"]...) {
+		query.Tags = append(query.Tags, NormalizeTags(strings.Split(v, ","))...)
+	}
+
+	if query.Sort == "" {
+		query.Sort = "created_at"
+	}
+	if _, ok := session_sort_columns[query.Sort]; !ok {
+		return query, errors.New("sort debe ser created_at, duration o score")
+	}
+	if order := values.Get("order"); order != "" && order != "asc" && order != "desc" {
+		return query, errors.New("order debe ser asc o desc")
+	}
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return query, errors.New("limit invalido")
+		}
+		query.Limit = min(limit, session_page_max)
+	}
+
+	if v := values.Get("cursor"); v != "" {
+		cursor, err := DecodeSessionCursor(v)
+		if err != nil {
+			return query, err
+		}
+		if cursor.Sort != query.Sort || cursor.Desc != query.Desc {
+			return query, errors.New("el cursor es de otro orden")
+		}
+		query.Cursor = cursor
+		if query.Limit == 0 {
+			query.Limit = session_page_default
+		}
+	}
+
+	return query, nil
+}
+
+// parseTimeParam parses a timestamp in milliseconds or a YYYY-MM-DD date (local time).
+// A date used as the end of a range covers the whole day.
+func parseTimeParam(v string, end_of_day bool) (int64, error) {
+	if v == "" {
+		return 0, nil
+	}
+	if ts, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return ts, nil
+	}
+	day, err := time.ParseInLocation(time.DateOnly, v, time.Local)
+	if err != nil {
+		return 0, errors.New("debe ser un timestamp en milisegundos o una fecha YYYY-MM-DD")
+	}
+	if end_of_day {
+		return day.AddDate(0, 0, 1).UnixMilli() - 1, nil
+	}
+	return day.UnixMilli(), nil
+}
+
+// NormalizeTags trims and lowercases tags, dropping empty and repeated ones.
+func NormalizeTags(tags []string) []string {
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// ftsMatch turns a search text into an FTS query matching every word as a prefix,
+// e.g. "etiopia nat" -> "etiopia* nat*". Punctuation is dropped so user input can
+// not inject FTS operators.
+func ftsMatch(search string) string {
+	words := strings.FieldsFunc(strings.ToLower(search), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		words[i] = word + "*"
+	}
+	return strings.Join(words, " ")
+}
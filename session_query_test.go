@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/url"
+	"slices"
+	"testing"
+)
+
+func TestSessionCursorRoundTrip(t *testing.T) {
+	cursors := []SessionCursor{
+		{Sort: "created_at", Desc: true, Value: 1792384512794, Id: "28cc2318-a109-4309-8796-e59f2d1399a4"},
+		{Sort: "duration", Desc: false, Value: 0, Id: "a"},
+		{Sort: "score", Desc: true, Value: 87.25, Id: "b"},
+	}
+	for _, cursor := range cursors {
+		decoded, err := DecodeSessionCursor(cursor.Encode())
+		if err != nil {
+			t.Fatalf("DecodeSessionCursor(%+v): %v", cursor, err)
+		}
+		if *decoded != cursor {
+			t.Errorf("round trip = %+v, want %+v", *decoded, cursor)
+		}
+	}
+}
+
+func TestDecodeSessionCursorInvalid(t *testing.T) {
+	for _, s := range []string{"", "%%%", "bm90IGpzb24", SessionCursor{Sort: "created_at"}.Encode()} {
+		if _, err := DecodeSessionCursor(s); err == nil {
+			t.Errorf("DecodeSessionCursor(%q) succeeded", s)
+		}
+	}
+}
+
+func TestParseSessionQuery(t *testing.T) {
+	desc_cursor := SessionCursor{Sort: "created_at", Desc: true, Value: 10, Id: "x"}.Encode()
+	tests := []struct {
+		query   string
+		check   func(SessionQuery) bool
+		wantErr bool
+	}{
+		// Without paging parameters every session is returned, newest first.
+		{"", func(q SessionQuery) bool { return q.Limit == 0 && q.Sort == "created_at" && q.Desc && q.Cursor == nil }, false},
+		{"limit=20&order=asc", func(q SessionQuery) bool { return q.Limit == 20 && !q.Desc }, false},
+		{"limit=100000", func(q SessionQuery) bool { return q.Limit == session_page_max }, false},
+		{"cursor=" + desc_cursor, func(q SessionQuery) bool { return q.Limit == session_page_default && q.Cursor.Id == "x" }, false},
+		{"cursor=" + desc_cursor + "&limit=5", func(q SessionQuery) bool { return q.Limit == 5 }, false},
+		{"tag=Etiopia,natural,,etiopia&tag=lavado", func(q SessionQuery) bool { return slices.Equal(q.Tags, []string{"etiopia", "natural", "lavado"}) }, false},
+		{"sort=score&q=+etiopia+", func(q SessionQuery) bool { return q.Sort == "score" && q.Search == "etiopia" }, false},
+		{"from=1000&to=2000", func(q SessionQuery) bool { return q.From == 1000 && q.To == 2000 }, false},
+		{"cursor=" + desc_cursor + "&order=asc", nil, true},
+		{"cursor=nope", nil, true},
+		{"sort=name", nil, true},
+		{"order=up", nil, true},
+		{"limit=0", nil, true},
+		{"limit=abc", nil, true},
+		{"from=ayer", nil, true},
+	}
+	for _, test := range tests {
+		values, err := url.ParseQuery(test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		query, err := ParseSessionQuery(values)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseSessionQuery(%q) err = %v, wantErr %v", test.query, err, test.wantErr)
+			continue
+		}
+		if !test.wantErr && !test.check(query) {
+			t.Errorf("ParseSessionQuery(%q) = %+v", test.query, query)
+		}
+	}
+}
+
+func TestFtsMatch(t *testing.T) {
+	tests := []struct{ search, want string }{
+		{"etiopia nat", "etiopia* nat*"},
+		{"  Café  ", "café*"},
+		{`a" OR b*`, "a* or* b*"},
+		{"---", ""},
+	}
+	for _, test := range tests {
+		if got := ftsMatch(test.search); got != test.want {
+			t.Errorf("ftsMatch(%q) = %q, want %q", test.search, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Source produces temperature samples for the ingestion pipeline.
+type Source interface {
+	// Name returns the registry name of the source (e.g., "esp32").
+	Name() string
+	// Run reads samples and hands them to out until stop is closed or the source fails.
+	Run(out func(TempType), stop <-chan struct{}) error
+}
+
+// TimeScaler is implemented by sources whose samples run faster or slower than the
+// wall clock, like the simulator and the replay.
+type TimeScaler interface {
+	// TimeScale returns the seconds of roast per second of wall clock.
+	TimeScale() float64
+}
+
+// SourceOptions holds the command-line settings the source factories can draw from.
+type SourceOptions struct {
+	Host   string         // The host of the ESP32 sensor WebSocket.
+	Modbus *ModbusConfig  // The Modbus device and register map.
+	Sim    *SimConfig     // The roast simulator parameters.
+	Replay *ReplayOptions // The stored session to play back.
+}
+
+// SourceFactory builds a source from the options.
+type SourceFactory func(options SourceOptions) (Source, error)
+
+var source_registry = map[string]SourceFactory{} // The registered source factories by name.
+
+// RegisterSource makes a source available under name; it is meant to be called from init.
+func RegisterSource(name string, factory SourceFactory) {
+	if _, exists := source_registry[name]; exists {
+		panic("source registrada dos veces: " + name)
+	}
+	source_registry[name] = factory
+}
+
+// SourceNames returns the names of the registered sources, sorted.
+func SourceNames() []string {
+	names := make([]string, 0, len(source_registry))
+	for name := range source_registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewSource builds the registered source called name.
+func NewSource(name string, options SourceOptions) (Source, error) {
+	factory, exists := source_registry[name]
+	if !exists {
+		return nil, fmt.Errorf("source desconocida %q, disponibles: %s", name, strings.Join(SourceNames(), ", "))
+	}
+	return factory(options)
+}
+
+// Pipeline receives the samples of every running source, stamps them with the server
+// clock, publishes them as the current data, broadcasts them and stores them in the
+// active session.
+type Pipeline struct {
+	mu          sync.Mutex
+	last_ts     int64
+	ror         *RoRWindow // The rate of rise sent with the live frames.
+	subscribers []func(TempType)
+	sources     map[Source]struct{} // The sources running.
+	stop        chan struct{}
+	done        chan struct{}
+	running     sync.WaitGroup
+	once        sync.Once
+}
+
+// NewPipeline creates an idle pipeline.
+func NewPipeline() *Pipeline {
+	return &Pipeline{ror: NewRoRWindow(mark_ror_seconds), sources: map[Source]struct{}{}, stop: make(chan struct{}), done: make(chan struct{})}
+}
+
+// Start runs source in its own goroutine, feeding the pipeline. The returned function
+// stops only this source.
+func (p *Pipeline) Start(source Source) func() {
+	p.running.Add(1)
+	p.mu.Lock()
+	p.sources[source] = struct{}{}
+	p.mu.Unlock()
+	log.Printf("iniciando source %s", source.Name())
+
+	stop := make(chan struct{})
+	var once sync.Once
+	stop_source := func() { once.Do(func() { close(stop) }) }
+
+	go func() {
+		select {
+		case <-p.stop:
+			stop_source()
+		case <-stop:
+		}
+	}()
+
+	go func() {
+		defer p.running.Done()
+		defer stop_source()
+		defer func() {
+			p.mu.Lock()
+			delete(p.sources, source)
+			p.mu.Unlock()
+		}()
+		if err := source.Run(p.Publish, stop); err != nil {
+			log.Printf("source %s terminada: %v", source.Name(), err)
+			return
+		}
+		log.Printf("source %s terminada", source.Name())
+	}()
+
+	return stop_source
+}
+
+// Running returns the sources that have not returned yet.
+func (p *Pipeline) Running() []Source {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sources := make([]Source, 0, len(p.sources))
+	for source := range p.sources {
+		sources = append(sources, source)
+	}
+	return sources
+}
+
+// TimeScale returns the largest time scale of the running sources, 1 when none of them
+// runs off the wall clock. Samples are stamped with the wall clock, so rates computed
+// from their timestamps are this many times the rates of the roast.
+func (p *Pipeline) TimeScale() float64 {
+	scale := 0.0
+	for _, source := range p.Running() {
+		if scaler, ok := source.(TimeScaler); ok {
+			scale = max(scale, scaler.TimeScale())
+		}
+	}
+	if scale <= 0 {
+		return 1
+	}
+	return scale
+}
+
+// Wait closes the channel returned by Done once every started source has returned.
+func (p *Pipeline) Wait() {
+	go func() {
+		p.running.Wait()
+		close(p.done)
+	}()
+}
+
+// Done returns a channel that is closed when every source has finished.
+func (p *Pipeline) Done() <-chan struct{} { return p.done }
+
+// Stop asks every source to stop.
+func (p *Pipeline) Stop() {
+	p.once.Do(func() { close(p.stop) })
+}
+
+// Subscribe registers fn to be called with every published sample, after it has been
+// stamped and stored. fn runs on the goroutine of the source and must not block.
+func (p *Pipeline) Subscribe(fn func(TempType)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.subscribers = append(p.subscribers, fn)
+}
+
+// Publish processes one sample coming from a source.
+func (p *Pipeline) Publish(temp TempType) {
+	p.mu.Lock()
+
+	// Timestamps are the primary key of the measurements, keep them strictly increasing.
+	temp.TimeStamp = time.Now().UnixMilli()
+	if temp.TimeStamp <= p.last_ts {
+		temp.TimeStamp = p.last_ts + 1
+	}
+	p.last_ts = temp.TimeStamp
+	temp.Type = "temp"
+	p.ror.Add(temp.TimeStamp, temp.Temp)
+	if ror, ok := p.ror.RoR(); ok {
+		temp.RoR = &ror
+	}
+
+	current_mu.Lock()
+	current_data = temp
+	current_mu.Unlock()
+
+	// Under p.mu, so samples are numbered in timestamp order.
+	send_data_to_clients(temp)
+
+	if active, ok := session.Active(); ok {
+		go session_data_provider.InsertTempValToSession(active.Id, temp)
+	}
+
+	subscribers := p.subscribers
+	p.mu.Unlock()
+
+	for _, fn := range subscribers {
+		fn(temp)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/url"
+	"sync"
+
+	ws_client "golang.org/x/net/websocket"
+)
+
+func init() {
+	RegisterSource("esp32", func(options SourceOptions) (Source, error) {
+		if options.Host == "" {
+			return nil, errors.New("esp32: falta el host del sensor")
+		}
+		return &ESP32Source{Host: options.Host}, nil
+	})
+}
+
+// ESP32Source reads the temperatures pushed by the ESP32 sensor over WebSocket.
+type ESP32Source struct {
+	Host string // The host:port of the sensor.
+
+	mu sync.Mutex
+	ws *ws_client.Conn // The open connection, nil while disconnected.
+}
+
+// Name returns the registry name of the source.
+func (s *ESP32Source) Name() string { return "esp32" }
+
+// CanControl returns true, the sensor firmware always accepts control commands.
+func (s *ESP32Source) CanControl() bool { return true }
+
+// SetOutputs sends a control command back to the sensor over the same WebSocket,
+// making the ESP32 a ControlDriver. The firmware expects
+// {"cmd":"control","heat":<0-100>,"fan":<0-100>}.
+func (s *ESP32Source) SetOutputs(heat float64, fan float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ws == nil {
+		return errors.New("esp32 no conectado")
+	}
+
+	msg, err := json.Marshal(map[string]any{"cmd": "control", "heat": heat, "fan": fan})
+	if err != nil {
+		return err
+	}
+	return ws_client.Message.Send(s.ws, string(msg))
+}
+
+// Run connects to the sensor and forwards every message until stop is closed or the connection drops.
+func (s *ESP32Source) Run(out func(TempType), stop <-chan struct{}) error {
+	u := url.URL{Scheme: "ws", Host: s.Host, Path: "/"}
+	log.Printf("connecting to %s", u.String())
+
+	ws, err := ws_client.Dial(u.String(), "", "http://localhost/")
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.ws = ws
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.ws = nil
+		s.mu.Unlock()
+	}()
+
+	// Cleanly close the connection when the pipeline stops.
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-stop:
+		case <-finished:
+		}
+		if err := ws.Close(); err != nil {
+			log.Println("close:", err)
+		}
+	}()
+
+	for {
+		var msg string
+		if err := ws_client.Message.Receive(ws, &msg); err != nil {
+			select {
+			case <-stop:
+				return nil
+			default:
+				return err
+			}
+		}
+
+		var temp TempType
+		if err := json.Unmarshal([]byte(msg), &temp); err != nil {
+			log.Println("read:", err)
+			continue
+		}
+
+		out(temp)
+		log.Printf("received: %s", msg)
+	}
+}
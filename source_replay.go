@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+func init() {
+	RegisterSource("replay", func(options SourceOptions) (Source, error) {
+		if options.Replay == nil || options.Replay.SessionId == "" {
+			return nil, errors.New("replay: falta la session a reproducir (-replay)")
+		}
+		replay := *options.Replay
+		replay.StartedBy = "replay"
+		return NewReplaySource(replay), nil
+	})
+}
+
+// ReplayOptions selects the stored session to play back and how.
+type ReplayOptions struct {
+	SessionId string  `json:"session_id"` // The session to replay.
+	Speed     float64 `json:"speed"`      // Playback speed, 1 is the original pace.
+	Record    bool    `json:"record"`     // Record the replay into a new session.
+	StartedBy string  `json:"-"`          // The user who asked for the replay.
+}
+
+// ReplaySource feeds the measurements and marks of a stored session back through the
+// live pipeline.
+type ReplaySource struct {
+	Options      ReplayOptions
+	recording_id string // The session receiving the replay when recording.
+}
+
+// NewReplaySource creates a replay source, defaulting to the original speed.
+func NewReplaySource(options ReplayOptions) *ReplaySource {
+	if options.Speed <= 0 {
+		options.Speed = 1
+	}
+	return &ReplaySource{Options: options}
+}
+
+// Name returns the registry name of the source.
+func (s *ReplaySource) Name() string { return "replay" }
+
+// TimeScale returns the playback speed.
+func (s *ReplaySource) TimeScale() float64 { return s.Options.Speed }
+
+// Run plays the session back. Once it is over the source stays idle until stop is
+// closed, so a replay does not shut the server down.
+func (s *ReplaySource) Run(out func(TempType), stop <-chan struct{}) error {
+	original, err := session_data_provider.GetSessionById(s.Options.SessionId)
+	if err != nil {
+		return err
+	}
+
+	temps := session_data_provider.GetAllBySessionId(original.Id)
+	marks := session_data_provider.GetMarksOfSessions(original.Id)
+	if len(temps) == 0 {
+		return fmt.Errorf("replay: la session %s no tiene mediciones", original.Id)
+	}
+
+	if s.Options.Record {
+		if err := s.startRecording(original); err != nil {
+			return err
+		}
+		defer s.stopRecording()
+	}
+
+	log.Printf("replay de %s (%d mediciones, %d marcas) a %.1fx", original.Name, len(temps), len(marks), s.Options.Speed)
+
+	// Marks fire right after the sample they refer to.
+	by_index := map[int][]Mark{}
+	for _, mark := range marks {
+		i := markSampleIndex(mark, temps)
+		by_index[i] = append(by_index[i], mark)
+	}
+
+	for i, temp := range temps {
+		if i > 0 {
+			wait := time.Duration(float64(temp.TimeStamp-temps[i-1].TimeStamp)/s.Options.Speed) * time.Millisecond
+			select {
+			case <-stop:
+				return nil
+			case <-time.After(wait):
+			}
+		}
+
+		out(*temp)
+
+		for _, mark := range by_index[i] {
+			s.emitMark(mark)
+		}
+	}
+
+	log.Printf("replay de %s terminado", original.Name)
+	if s.Options.Record {
+		s.stopRecording()
+	}
+
+	<-stop
+	return nil
+}
+
+// startRecording opens a new session that receives the replayed samples.
+func (s *ReplaySource) startRecording(original SessionData) error {
+	session_mu.Lock()
+	defer session_mu.Unlock()
+
+	started, err := startSession("replay "+original.Name, s.Options.StartedBy, "", map[string]any{"replay_of": s.Options.SessionId})
+	if err != nil {
+		return err
+	}
+	s.recording_id = started.Id
+	send_data_to_clients(map[string]any{"type": "start_response", "msg": "session iniciada", "session_id": started.Id, "session_name": started.Name})
+	return nil
+}
+
+// stopRecording closes the session opened by startRecording, if it is still active.
+func (s *ReplaySource) stopRecording() {
+	if s.recording_id != "" {
+		stopSession(s.recording_id, s.Options.StartedBy, "")
+	}
+}
+
+// emitMark broadcasts a replayed mark and stores it in the recording session.
+func (s *ReplaySource) emitMark(mark Mark) {
+	mark.SessionId = ""
+	mark.CreatedAt = currentData().TimeStamp
+
+	if s.Options.Record && session.IsCurrent(s.recording_id) {
+		mark.SessionId = s.recording_id
+		mark.CreatedBy = s.Options.StartedBy
+		session_data_provider.SetMark(mark)
+	}
+
+	send_data_to_clients(map[string]any{"type": "mark", "mark": mark})
+}
+
+// markSampleIndex finds the sample a mark refers to. Marks store either a timestamp
+// or, when posted by the chart, the index of the sample.
+func markSampleIndex(mark Mark, temps []*TempType) int {
+	if mark.CreatedAt < temps[0].TimeStamp {
+		return int(min(max(mark.CreatedAt, 0), int64(len(temps)-1)))
+	}
+	for i, temp := range temps {
+		if temp.TimeStamp >= mark.CreatedAt {
+			return i
+		}
+	}
+	return len(temps) - 1
+}
+
+var replay_mu sync.Mutex        // Protects replay_stop and replay_source.
+var replay_stop func()          // Stops the replay started through the admin API, nil when none is running.
+var replay_source *ReplaySource // The replay started through the admin API.
+
+// replayUnrecorded returns an error while a replay started through the admin API without
+// recording is running: its samples would end up in any session started meanwhile.
+// Called with replay_mu held.
+func replayUnrecorded() error {
+	if replay_stop != nil && !replay_source.Options.Record {
+		return errors.New("hay un replay en curso, detengalo antes de iniciar una session")
+	}
+	return nil
+}
+
+// adminReplayStartHandler starts replaying a stored session through the live pipeline.
+// Replays are only started with the roaster idle: without a session, whose
+// measurements the replayed samples would mix with, and without other sources
+// running, whose samples would mix with the replayed ones.
+func adminReplayStartHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+
+	var options ReplayOptions
+	if err := json.NewDecoder(r.Body).Decode(&options); err != nil || options.SessionId == "" {
+		writeJSONError(w, http.StatusBadRequest, "se requiere session_id")
+		return
+	}
+	defer r.Body.Close()
+
+	if _, err := session_data_provider.GetSessionById(options.SessionId); err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	options.StartedBy = currentUser(r).Actor()
+	if options.StartedBy == "" {
+		options.StartedBy = "replay"
+	}
+
+	// Held until the replay started, so no session starts meanwhile.
+	session_mu.Lock()
+	defer session_mu.Unlock()
+	replay_mu.Lock()
+	defer replay_mu.Unlock()
+
+	if session.IsActive() {
+		writeJSONError(w, http.StatusConflict, "hay una session de tostado activa, detengala antes del replay")
+		return
+	}
+	for _, source := range pipeline.Running() {
+		if replay, ok := source.(*ReplaySource); !ok || replay != replay_source {
+			writeJSONError(w, http.StatusConflict, fmt.Sprintf("la source %s esta en marcha, el replay se mezclaria con sus mediciones", source.Name()))
+			return
+		}
+	}
+
+	if replay_stop != nil {
+		replay_stop()
+	}
+	replay_source = NewReplaySource(options)
+	replay_stop = pipeline.Start(replay_source)
+	Audit(r, "replay.start", options.SessionId, options)
+
+	json.NewEncoder(w).Encode(map[string]any{"status": true, "msg": "replay iniciado", "session_id": options.SessionId})
+}
+
+// adminReplayStopHandler stops the replay started through the admin API.
+func adminReplayStopHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+
+	replay_mu.Lock()
+	defer replay_mu.Unlock()
+
+	if replay_stop == nil {
+		json.NewEncoder(w).Encode(map[string]any{"status": false, "msg": "no hay replay en curso"})
+		return
+	}
+	replay_stop()
+	replay_stop, replay_source = nil, nil
+	Audit(r, "replay.stop", "", nil)
+
+	json.NewEncoder(w).Encode(map[string]any{"status": true, "msg": "replay detenido"})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// idleSource is a live source that sends nothing until it is stopped.
+type idleSource struct{}
+
+func (idleSource) Name() string { return "idle" }
+
+func (idleSource) Run(out func(TempType), stop <-chan struct{}) error {
+	<-stop
+	return nil
+}
+
+// usePipeline gives the test a pipeline of its own, stopped at the end once its sources
+// returned.
+func usePipeline(t *testing.T) {
+	t.Helper()
+	previous := pipeline
+	pipeline = NewPipeline()
+	t.Cleanup(func() {
+		replay_mu.Lock()
+		replay_stop, replay_source = nil, nil
+		replay_mu.Unlock()
+		pipeline.Stop()
+		pipeline.Wait()
+		<-pipeline.Done()
+		pipeline = previous
+	})
+}
+
+func TestAdminReplayStartNeedsAnIdleRoaster(t *testing.T) {
+	tests := []struct {
+		name    string
+		session bool
+		source  bool
+		replay  bool
+		want    int
+	}{
+		{"idle", false, false, false, http.StatusOK},
+		{"replacing a replay", false, false, true, http.StatusOK},
+		{"active session", true, false, false, http.StatusConflict},
+		{"live source", false, true, false, http.StatusConflict},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := useTestDatabase(t)
+			insertSession(t, db, "roast", "Guji #1", 1000)
+			session_data_provider.InsertTempValToSession("roast", TempType{TimeStamp: 1000, Temp: 100})
+			usePipeline(t)
+			if test.session {
+				session.Start("activa")
+				t.Cleanup(session.Stop)
+			}
+			if test.source {
+				pipeline.Start(idleSource{})
+			}
+			if test.replay {
+				replay_source = NewReplaySource(ReplayOptions{SessionId: "roast"})
+				replay_stop = pipeline.Start(replay_source)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/admin/replay", strings.NewReader(`{"session_id":"roast","speed":100}`))
+			w := httptest.NewRecorder()
+			adminReplayStartHandler(w, r)
+			if w.Code != test.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, test.want, w.Body)
+			}
+			if running := replay_stop != nil; running != (test.want == http.StatusOK || test.replay) {
+				t.Errorf("replay running = %v", running)
+			}
+		})
+	}
+}
+
+func TestStartSessionDuringUnrecordedReplay(t *testing.T) {
+	tests := []struct {
+		name    string
+		record  bool
+		wantErr bool
+	}{
+		{"unrecorded", false, true},
+		{"recorded", true, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTestDatabase(t)
+			usePipeline(t)
+			replay_source = NewReplaySource(ReplayOptions{SessionId: "roast", Record: test.record})
+			replay_stop = func() {}
+
+			_, err := StartSession("Guji #2", "test", "")
+			if err == nil {
+				t.Cleanup(session.Stop)
+			}
+			if (err != nil) != test.wantErr {
+				t.Fatalf("StartSession error = %v, want error %v", err, test.wantErr)
+			}
+			if session.IsActive() == test.wantErr {
+				t.Errorf("session active = %v", session.IsActive())
+			}
+		})
+	}
+}
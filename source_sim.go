@@ -0,0 +1,68 @@
+package main
+
+import (
+	"log"
+	"math"
+	"time"
+)
+
+func init() {
+	RegisterSource("sim", func(options SourceOptions) (Source, error) {
+		config := options.Sim
+		if config == nil {
+			config = DefaultSimConfig()
+		}
+		return &SimSource{Config: config, Model: NewRoastModel(config)}, nil
+	})
+}
+
+// SimSource runs mock roasts on a RoastModel when no sensor is available.
+type SimSource struct {
+	Config *SimConfig  // The simulator parameters.
+	Model  *RoastModel // The thermal model, exposed so the inputs can be driven from outside.
+}
+
+// Name returns the registry name of the source.
+func (s *SimSource) Name() string { return "sim" }
+
+// TimeScale returns the simulated seconds per real second.
+func (s *SimSource) TimeScale() float64 { return s.Config.TimeScale }
+
+// CanControl returns true, the simulator always accepts control commands.
+func (s *SimSource) CanControl() bool { return true }
+
+// SetOutputs drives the heat and airflow inputs of the model, making the simulator a
+// ControlDriver.
+func (s *SimSource) SetOutputs(heat float64, fan float64) error {
+	s.Model.SetInputs(heat, fan)
+	return nil
+}
+
+// Run advances the model and emits one sample every SampleMs until stop is closed.
+func (s *SimSource) Run(out func(TempType), stop <-chan struct{}) error {
+	interval := time.Duration(s.Config.SampleMs) * time.Millisecond
+	simulated := interval.Seconds() * s.Config.TimeScale
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// Integrate in steps of at most one simulated second to keep the model stable.
+		steps := int(math.Ceil(simulated))
+		for range steps {
+			for _, event := range s.Model.Step(simulated / float64(steps)) {
+				phase, _ := s.Model.Phase()
+				log.Printf("simulador: %s (fase %s)", event, phase)
+			}
+		}
+
+		bt, et := s.Model.Reading()
+		out(TempType{Temp: bt, Unit: "C", Channels: map[string]float64{"bt": bt, "et": et}})
+
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
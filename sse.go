@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sse_ping_interval = 15 * time.Second
+	sse_retry_ms      = 2000 // Reconnection delay suggested to the clients.
+)
+
+// lastEventId returns the Last-Event-ID header, or the last_event_id query parameter
+// for clients that cannot set headers, and whether there was one.
+func lastEventId(r *http.Request) (uint64, bool, error) {
+	v := r.Header.Get("Last-Event-ID")
+	if v == "" {
+		v = r.URL.Query().Get("last_event_id")
+	}
+	if v == "" {
+		return 0, false, nil
+	}
+	seq, err := strconv.ParseUint(strings.TrimSpace(v), 10, 64)
+	if err != nil {
+		return 0, false, errors.New("Last-Event-ID debe ser el seq de un frame")
+	}
+	return seq, true, nil
+}
+
+// liveEventsHandler streams the live frames as Server-Sent Events, with the broadcast
+// seq as the event id. Clients reconnecting with Last-Event-ID get the frames they
+// missed. types, channels and roaster filter the frames.
+func liveEventsHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "la conexion no admite streaming")
+		return
+	}
+	last, resume, err := lastEventId(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	client := subscribeLive(ParseLiveFilter(r.URL.Query()), last, resume)
+	defer unsubscribeLive(client)
+	log.Printf("cliente sse conectado desde: %s", r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	fmt.Fprintf(w, "retry: %d\n\n", sse_retry_ms)
+	flusher.Flush()
+
+	ping := time.NewTicker(sse_ping_interval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			log.Printf("cliente sse desconectado de: %s", r.RemoteAddr)
+			return
+		case frame, ok := <-client.frames:
+			if !ok {
+				return
+			}
+			if frame.Seq != 0 {
+				fmt.Fprintf(w, "id: %d\n", frame.Seq)
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", frame.Data); err != nil {
+				log.Printf("Error al enviar a %s: %v", r.RemoteAddr, err)
+				return
+			}
+		case <-ping.C:
+			fmt.Fprint(w, ": ping\n\n")
+		}
+		flusher.Flush()
+	}
+}
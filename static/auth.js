@@ -0,0 +1,144 @@
+// Login del tostador para las páginas de static/.
+//
+// Guarda el token de /api/v1/auth/login y lo envía al servidor del tostador en cada
+// llamada: como "Authorization: Bearer" en fetch y, como los navegadores no permiten
+// cabeceras en WebSocket ni EventSource, como ?access_token= en esas conexiones.
+// Sin login, o cuando el servidor responde 401, lleva a login.html.
+(function () {
+    const TOKEN_KEY = 'tostador_token';
+    const SERVER_KEY = 'tostador_server';
+    const LOGIN_PAGE = 'login.html';
+
+    // El servidor por defecto: el que sirve la página o, abierta como archivo, el local.
+    function defaultServer() {
+        if (location.protocol === 'http:' || location.protocol === 'https:') {
+            return location.origin;
+        }
+        return 'http://127.0.0.1:8080';
+    }
+
+    function server() {
+        return localStorage.getItem(SERVER_KEY) || defaultServer();
+    }
+
+    function token() {
+        return localStorage.getItem(TOKEN_KEY);
+    }
+
+    // localhost y 127.0.0.1 son el mismo servidor.
+    function sameHost(a, b) {
+        const local = (h) => (h === 'localhost' || h === '127.0.0.1' || h === '[::1]') ? 'localhost' : h;
+        return local(a.hostname) === local(b.hostname) && a.port === b.port;
+    }
+
+    // Solo el servidor del tostador recibe el token, nunca otras APIs (ej. Gemini).
+    function isTostador(url) {
+        let u;
+        try {
+            u = new URL(url, location.href);
+        } catch (e) {
+            return false;
+        }
+        const http = new URL(u.href.replace(/^ws/, 'http'));
+        const known = [server(), defaultServer()].map((s) => new URL(s));
+        if (!known.some((s) => sameHost(http, s))) {
+            return false;
+        }
+        return http.pathname.startsWith('/api/') || http.pathname === '/temp';
+    }
+
+    function withAccessToken(url) {
+        const u = new URL(url, location.href);
+        u.searchParams.set('access_token', token());
+        return u.href;
+    }
+
+    function toLogin() {
+        if (location.pathname.endsWith('/' + LOGIN_PAGE)) {
+            return;
+        }
+        const next = location.pathname.split('/').pop() + location.search;
+        location.href = LOGIN_PAGE + '?next=' + encodeURIComponent(next);
+    }
+
+    const nativeFetch = window.fetch.bind(window);
+    window.fetch = async function (input, init) {
+        const url = input instanceof Request ? input.url : String(input);
+        if (!isTostador(url)) {
+            return nativeFetch(input, init);
+        }
+        const headers = new Headers((init && init.headers) || (input instanceof Request ? input.headers : undefined));
+        if (token() && !headers.has('Authorization')) {
+            headers.set('Authorization', 'Bearer ' + token());
+        }
+        const response = await nativeFetch(input, Object.assign({}, init, { headers }));
+        if (response.status === 401 && !new URL(url, location.href).pathname.startsWith('/api/v1/auth/login')) {
+            localStorage.removeItem(TOKEN_KEY);
+            toLogin();
+        }
+        return response;
+    };
+
+    const NativeWebSocket = window.WebSocket;
+    window.WebSocket = function (url, protocols) {
+        if (token() && isTostador(url)) {
+            url = withAccessToken(url);
+        }
+        return protocols === undefined ? new NativeWebSocket(url) : new NativeWebSocket(url, protocols);
+    };
+    window.WebSocket.prototype = NativeWebSocket.prototype;
+    Object.assign(window.WebSocket, {
+        CONNECTING: NativeWebSocket.CONNECTING,
+        OPEN: NativeWebSocket.OPEN,
+        CLOSING: NativeWebSocket.CLOSING,
+        CLOSED: NativeWebSocket.CLOSED,
+    });
+
+    if (window.EventSource) {
+        const NativeEventSource = window.EventSource;
+        window.EventSource = function (url, options) {
+            if (token() && isTostador(url)) {
+                url = withAccessToken(url);
+            }
+            return new NativeEventSource(url, options);
+        };
+        window.EventSource.prototype = NativeEventSource.prototype;
+    }
+
+    window.tostadorAuth = {
+        server,
+        token,
+
+        // Inicia sesión en serverUrl y guarda el token.
+        async login(serverUrl, username, password) {
+            const base = serverUrl.replace(/\/+$/, '');
+            const response = await nativeFetch(base + '/api/v1/auth/login', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ username, password }),
+            });
+            const data = await response.json().catch(() => ({}));
+            if (!response.ok) {
+                throw new Error(data.msg || 'no se pudo iniciar sesión');
+            }
+            localStorage.setItem(SERVER_KEY, base);
+            localStorage.setItem(TOKEN_KEY, data.token);
+            return data.user;
+        },
+
+        // Cierra la sesión en el servidor y vuelve al login.
+        async logout() {
+            try {
+                await window.fetch(server() + '/api/v1/auth/logout', { method: 'POST' });
+            } finally {
+                localStorage.removeItem(TOKEN_KEY);
+                toLogin();
+            }
+        },
+    };
+
+    // Las páginas que solo usan el WebSocket no verían el 401: se comprueba al cargar.
+    if (!location.pathname.endsWith('/' + LOGIN_PAGE)) {
+        window.fetch(server() + '/api/v1/auth/me').catch(() => {});
+    }
+})();
@@ -0,0 +1,1400 @@
+// gRPC API of the roaster server. It mirrors the REST and WebSocket APIs: the same
+// permissions apply, with the login or API token sent as "authorization: Bearer <token>"
+// metadata.
+//
+// The Go code in tostadorapb is generated from this file with:
+//
+//	protoc --go_out=. --go_opt=module=tostadora_server \
+//	    --go-grpc_out=. --go-grpc_opt=module=tostadora_server proto/tostadora.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.8
+// 	protoc        (unknown)
+// source: proto/tostadora.proto
+
+package tostadorapb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Session is a stored roasting session. Timestamps are in milliseconds.
+type Session struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	CreateAt      int64                  `protobuf:"varint,3,opt,name=create_at,json=createAt,proto3" json:"create_at,omitempty"`
+	EndAt         int64                  `protobuf:"varint,4,opt,name=end_at,json=endAt,proto3" json:"end_at,omitempty"`
+	StartedBy     string                 `protobuf:"bytes,5,opt,name=started_by,json=startedBy,proto3" json:"started_by,omitempty"`
+	StoppedBy     string                 `protobuf:"bytes,6,opt,name=stopped_by,json=stoppedBy,proto3" json:"stopped_by,omitempty"`
+	Coffee        string                 `protobuf:"bytes,7,opt,name=coffee,proto3" json:"coffee,omitempty"`
+	Roaster       string                 `protobuf:"bytes,8,opt,name=roaster,proto3" json:"roaster,omitempty"`
+	Tags          []string               `protobuf:"bytes,9,rep,name=tags,proto3" json:"tags,omitempty"`
+	Score         float64                `protobuf:"fixed64,10,opt,name=score,proto3" json:"score,omitempty"`
+	Notes         string                 `protobuf:"bytes,11,opt,name=notes,proto3" json:"notes,omitempty"`
+	GreenWeight   float64                `protobuf:"fixed64,12,opt,name=green_weight,json=greenWeight,proto3" json:"green_weight,omitempty"`       // In grams.
+	RoastedWeight float64                `protobuf:"fixed64,13,opt,name=roasted_weight,json=roastedWeight,proto3" json:"roasted_weight,omitempty"` // In grams.
+	Version       int64                  `protobuf:"varint,14,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Session) Reset() {
+	*x = Session{}
+	mi := &file_proto_tostadora_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Session) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Session) ProtoMessage() {}
+
+func (x *Session) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_tostadora_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Session.ProtoReflect.Descriptor instead.
+func (*Session) Descriptor() ([]byte, []int) {
+	return file_proto_tostadora_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Session) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Session) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Session) GetCreateAt() int64 {
+	if x != nil {
+		return x.CreateAt
+	}
+	return 0
+}
+
+func (x *Session) GetEndAt() int64 {
+	if x != nil {
+		return x.EndAt
+	}
+	return 0
+}
+
+func (x *Session) GetStartedBy() string {
+	if x != nil {
+		return x.StartedBy
+	}
+	return ""
+}
+
+func (x *Session) GetStoppedBy() string {
+	if x != nil {
+		return x.StoppedBy
+	}
+	return ""
+}
+
+func (x *Session) GetCoffee() string {
+	if x != nil {
+		return x.Coffee
+	}
+	return ""
+}
+
+func (x *Session) GetRoaster() string {
+	if x != nil {
+		return x.Roaster
+	}
+	return ""
+}
+
+func (x *Session) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+func (x *Session) GetScore() float64 {
+	if x != nil {
+		return x.Score
+	}
+	return 0
+}
+
+func (x *Session) GetNotes() string {
+	if x != nil {
+		return x.Notes
+	}
+	return ""
+}
+
+func (x *Session) GetGreenWeight() float64 {
+	if x != nil {
+		return x.GreenWeight
+	}
+	return 0
+}
+
+func (x *Session) GetRoastedWeight() float64 {
+	if x != nil {
+		return x.RoastedWeight
+	}
+	return 0
+}
+
+func (x *Session) GetVersion() int64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+// Reading is a temperature sample.
+type Reading struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Timestamp     int64                  `protobuf:"varint,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Temp          float64                `protobuf:"fixed64,2,opt,name=temp,proto3" json:"temp,omitempty"` // The bean temperature.
+	Unit          string                 `protobuf:"bytes,3,opt,name=unit,proto3" json:"unit,omitempty"`
+	Channels      map[string]float64     `protobuf:"bytes,4,rep,name=channels,proto3" json:"channels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"fixed64,2,opt,name=value"`
+	Ror           *float64               `protobuf:"fixed64,5,opt,name=ror,proto3,oneof" json:"ror,omitempty"` // The rate of rise in degrees per minute, on live readings.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Reading) Reset() {
+	*x = Reading{}
+	mi := &file_proto_tostadora_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Reading) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Reading) ProtoMessage() {}
+
+func (x *Reading) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_tostadora_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Reading.ProtoReflect.Descriptor instead.
+func (*Reading) Descriptor() ([]byte, []int) {
+	return file_proto_tostadora_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Reading) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *Reading) GetTemp() float64 {
+	if x != nil {
+		return x.Temp
+	}
+	return 0
+}
+
+func (x *Reading) GetUnit() string {
+	if x != nil {
+		return x.Unit
+	}
+	return ""
+}
+
+func (x *Reading) GetChannels() map[string]float64 {
+	if x != nil {
+		return x.Channels
+	}
+	return nil
+}
+
+func (x *Reading) GetRor() float64 {
+	if x != nil && x.Ror != nil {
+		return *x.Ror
+	}
+	return 0
+}
+
+type Mark struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	SessionId     string                 `protobuf:"bytes,2,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	MarkName      string                 `protobuf:"bytes,3,opt,name=mark_name,json=markName,proto3" json:"mark_name,omitempty"`
+	CreateAt      int64                  `protobuf:"varint,4,opt,name=create_at,json=createAt,proto3" json:"create_at,omitempty"`
+	OnTemp        float64                `protobuf:"fixed64,5,opt,name=on_temp,json=onTemp,proto3" json:"on_temp,omitempty"`
+	CreatedBy     string                 `protobuf:"bytes,6,opt,name=created_by,json=createdBy,proto3" json:"created_by,omitempty"`
+	Channels      map[string]float64     `protobuf:"bytes,7,rep,name=channels,proto3" json:"channels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"fixed64,2,opt,name=value"`
+	Ror           *float64               `protobuf:"fixed64,8,opt,name=ror,proto3,oneof" json:"ror,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Mark) Reset() {
+	*x = Mark{}
+	mi := &file_proto_tostadora_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Mark) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Mark) ProtoMessage() {}
+
+func (x *Mark) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_tostadora_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Mark.ProtoReflect.Descriptor instead.
+func (*Mark) Descriptor() ([]byte, []int) {
+	return file_proto_tostadora_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Mark) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Mark) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+func (x *Mark) GetMarkName() string {
+	if x != nil {
+		return x.MarkName
+	}
+	return ""
+}
+
+func (x *Mark) GetCreateAt() int64 {
+	if x != nil {
+		return x.CreateAt
+	}
+	return 0
+}
+
+func (x *Mark) GetOnTemp() float64 {
+	if x != nil {
+		return x.OnTemp
+	}
+	return 0
+}
+
+func (x *Mark) GetCreatedBy() string {
+	if x != nil {
+		return x.CreatedBy
+	}
+	return ""
+}
+
+func (x *Mark) GetChannels() map[string]float64 {
+	if x != nil {
+		return x.Channels
+	}
+	return nil
+}
+
+func (x *Mark) GetRor() float64 {
+	if x != nil && x.Ror != nil {
+		return *x.Ror
+	}
+	return 0
+}
+
+// SessionState tells whether a session is being recorded.
+type SessionState struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Active        bool                   `protobuf:"varint,1,opt,name=active,proto3" json:"active,omitempty"`
+	SessionId     string                 `protobuf:"bytes,2,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	SessionName   string                 `protobuf:"bytes,3,opt,name=session_name,json=sessionName,proto3" json:"session_name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SessionState) Reset() {
+	*x = SessionState{}
+	mi := &file_proto_tostadora_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SessionState) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SessionState) ProtoMessage() {}
+
+func (x *SessionState) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_tostadora_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SessionState.ProtoReflect.Descriptor instead.
+func (*SessionState) Descriptor() ([]byte, []int) {
+	return file_proto_tostadora_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *SessionState) GetActive() bool {
+	if x != nil {
+		return x.Active
+	}
+	return false
+}
+
+func (x *SessionState) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+func (x *SessionState) GetSessionName() string {
+	if x != nil {
+		return x.SessionName
+	}
+	return ""
+}
+
+type ListSessionsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Q             string                 `protobuf:"bytes,1,opt,name=q,proto3" json:"q,omitempty"`        // Full-text search on the name.
+	From          int64                  `protobuf:"varint,2,opt,name=from,proto3" json:"from,omitempty"` // Created at or after, in milliseconds.
+	To            int64                  `protobuf:"varint,3,opt,name=to,proto3" json:"to,omitempty"`     // Created at or before, in milliseconds.
+	Coffee        string                 `protobuf:"bytes,4,opt,name=coffee,proto3" json:"coffee,omitempty"`
+	Roaster       string                 `protobuf:"bytes,5,opt,name=roaster,proto3" json:"roaster,omitempty"`
+	User          string                 `protobuf:"bytes,6,opt,name=user,proto3" json:"user,omitempty"`
+	Tags          []string               `protobuf:"bytes,7,rep,name=tags,proto3" json:"tags,omitempty"`
+	Sort          string                 `protobuf:"bytes,8,opt,name=sort,proto3" json:"sort,omitempty"`      // created_at, duration or score.
+	Order         string                 `protobuf:"bytes,9,opt,name=order,proto3" json:"order,omitempty"`    // asc or desc.
+	Limit         int32                  `protobuf:"varint,10,opt,name=limit,proto3" json:"limit,omitempty"`  // Page size, 50 when 0.
+	Cursor        string                 `protobuf:"bytes,11,opt,name=cursor,proto3" json:"cursor,omitempty"` // The next_cursor of the previous page.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListSessionsRequest) Reset() {
+	*x = ListSessionsRequest{}
+	mi := &file_proto_tostadora_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListSessionsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListSessionsRequest) ProtoMessage() {}
+
+func (x *ListSessionsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_tostadora_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListSessionsRequest.ProtoReflect.Descriptor instead.
+func (*ListSessionsRequest) Descriptor() ([]byte, []int) {
+	return file_proto_tostadora_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ListSessionsRequest) GetQ() string {
+	if x != nil {
+		return x.Q
+	}
+	return ""
+}
+
+func (x *ListSessionsRequest) GetFrom() int64 {
+	if x != nil {
+		return x.From
+	}
+	return 0
+}
+
+func (x *ListSessionsRequest) GetTo() int64 {
+	if x != nil {
+		return x.To
+	}
+	return 0
+}
+
+func (x *ListSessionsRequest) GetCoffee() string {
+	if x != nil {
+		return x.Coffee
+	}
+	return ""
+}
+
+func (x *ListSessionsRequest) GetRoaster() string {
+	if x != nil {
+		return x.Roaster
+	}
+	return ""
+}
+
+func (x *ListSessionsRequest) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+func (x *ListSessionsRequest) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+func (x *ListSessionsRequest) GetSort() string {
+	if x != nil {
+		return x.Sort
+	}
+	return ""
+}
+
+func (x *ListSessionsRequest) GetOrder() string {
+	if x != nil {
+		return x.Order
+	}
+	return ""
+}
+
+func (x *ListSessionsRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *ListSessionsRequest) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
+
+type ListSessionsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Sessions      []*Session             `protobuf:"bytes,1,rep,name=sessions,proto3" json:"sessions,omitempty"`
+	Total         int32                  `protobuf:"varint,2,opt,name=total,proto3" json:"total,omitempty"`
+	NextCursor    string                 `protobuf:"bytes,3,opt,name=next_cursor,json=nextCursor,proto3" json:"next_cursor,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListSessionsResponse) Reset() {
+	*x = ListSessionsResponse{}
+	mi := &file_proto_tostadora_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListSessionsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListSessionsResponse) ProtoMessage() {}
+
+func (x *ListSessionsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_tostadora_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListSessionsResponse.ProtoReflect.Descriptor instead.
+func (*ListSessionsResponse) Descriptor() ([]byte, []int) {
+	return file_proto_tostadora_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ListSessionsResponse) GetSessions() []*Session {
+	if x != nil {
+		return x.Sessions
+	}
+	return nil
+}
+
+func (x *ListSessionsResponse) GetTotal() int32 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+func (x *ListSessionsResponse) GetNextCursor() string {
+	if x != nil {
+		return x.NextCursor
+	}
+	return ""
+}
+
+type GetSessionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	From          int64                  `protobuf:"varint,2,opt,name=from,proto3" json:"from,omitempty"`                            // Readings at or after, in milliseconds.
+	To            int64                  `protobuf:"varint,3,opt,name=to,proto3" json:"to,omitempty"`                                // Readings at or before, in milliseconds.
+	MaxPoints     int32                  `protobuf:"varint,4,opt,name=max_points,json=maxPoints,proto3" json:"max_points,omitempty"` // Downsample the readings to this many points.
+	Downsample    string                 `protobuf:"bytes,5,opt,name=downsample,proto3" json:"downsample,omitempty"`                 // lttb or minmax.
+	Channels      []string               `protobuf:"bytes,6,rep,name=channels,proto3" json:"channels,omitempty"`                     // The channels to return; every channel when empty.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetSessionRequest) Reset() {
+	*x = GetSessionRequest{}
+	mi := &file_proto_tostadora_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetSessionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetSessionRequest) ProtoMessage() {}
+
+func (x *GetSessionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_tostadora_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetSessionRequest.ProtoReflect.Descriptor instead.
+func (*GetSessionRequest) Descriptor() ([]byte, []int) {
+	return file_proto_tostadora_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *GetSessionRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *GetSessionRequest) GetFrom() int64 {
+	if x != nil {
+		return x.From
+	}
+	return 0
+}
+
+func (x *GetSessionRequest) GetTo() int64 {
+	if x != nil {
+		return x.To
+	}
+	return 0
+}
+
+func (x *GetSessionRequest) GetMaxPoints() int32 {
+	if x != nil {
+		return x.MaxPoints
+	}
+	return 0
+}
+
+func (x *GetSessionRequest) GetDownsample() string {
+	if x != nil {
+		return x.Downsample
+	}
+	return ""
+}
+
+func (x *GetSessionRequest) GetChannels() []string {
+	if x != nil {
+		return x.Channels
+	}
+	return nil
+}
+
+type GetSessionResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Session       *Session               `protobuf:"bytes,1,opt,name=session,proto3" json:"session,omitempty"`
+	Readings      []*Reading             `protobuf:"bytes,2,rep,name=readings,proto3" json:"readings,omitempty"`
+	ReadingsTotal int32                  `protobuf:"varint,3,opt,name=readings_total,json=readingsTotal,proto3" json:"readings_total,omitempty"` // The readings in the range, before downsampling.
+	Marks         []*Mark                `protobuf:"bytes,4,rep,name=marks,proto3" json:"marks,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetSessionResponse) Reset() {
+	*x = GetSessionResponse{}
+	mi := &file_proto_tostadora_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetSessionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetSessionResponse) ProtoMessage() {}
+
+func (x *GetSessionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_tostadora_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetSessionResponse.ProtoReflect.Descriptor instead.
+func (*GetSessionResponse) Descriptor() ([]byte, []int) {
+	return file_proto_tostadora_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *GetSessionResponse) GetSession() *Session {
+	if x != nil {
+		return x.Session
+	}
+	return nil
+}
+
+func (x *GetSessionResponse) GetReadings() []*Reading {
+	if x != nil {
+		return x.Readings
+	}
+	return nil
+}
+
+func (x *GetSessionResponse) GetReadingsTotal() int32 {
+	if x != nil {
+		return x.ReadingsTotal
+	}
+	return 0
+}
+
+func (x *GetSessionResponse) GetMarks() []*Mark {
+	if x != nil {
+		return x.Marks
+	}
+	return nil
+}
+
+type DeleteSessionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteSessionRequest) Reset() {
+	*x = DeleteSessionRequest{}
+	mi := &file_proto_tostadora_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteSessionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteSessionRequest) ProtoMessage() {}
+
+func (x *DeleteSessionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_tostadora_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteSessionRequest.ProtoReflect.Descriptor instead.
+func (*DeleteSessionRequest) Descriptor() ([]byte, []int) {
+	return file_proto_tostadora_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *DeleteSessionRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type DeleteSessionResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteSessionResponse) Reset() {
+	*x = DeleteSessionResponse{}
+	mi := &file_proto_tostadora_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteSessionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteSessionResponse) ProtoMessage() {}
+
+func (x *DeleteSessionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_tostadora_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteSessionResponse.ProtoReflect.Descriptor instead.
+func (*DeleteSessionResponse) Descriptor() ([]byte, []int) {
+	return file_proto_tostadora_proto_rawDescGZIP(), []int{9}
+}
+
+type AddMarkRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SessionId     string                 `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"` // Empty for the active session.
+	MarkName      string                 `protobuf:"bytes,2,opt,name=mark_name,json=markName,proto3" json:"mark_name,omitempty"`
+	CreateAt      int64                  `protobuf:"varint,3,opt,name=create_at,json=createAt,proto3" json:"create_at,omitempty"` // 0 to mark the active session at the current reading.
+	OnTemp        float64                `protobuf:"fixed64,4,opt,name=on_temp,json=onTemp,proto3" json:"on_temp,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddMarkRequest) Reset() {
+	*x = AddMarkRequest{}
+	mi := &file_proto_tostadora_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddMarkRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddMarkRequest) ProtoMessage() {}
+
+func (x *AddMarkRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_tostadora_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddMarkRequest.ProtoReflect.Descriptor instead.
+func (*AddMarkRequest) Descriptor() ([]byte, []int) {
+	return file_proto_tostadora_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *AddMarkRequest) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+func (x *AddMarkRequest) GetMarkName() string {
+	if x != nil {
+		return x.MarkName
+	}
+	return ""
+}
+
+func (x *AddMarkRequest) GetCreateAt() int64 {
+	if x != nil {
+		return x.CreateAt
+	}
+	return 0
+}
+
+func (x *AddMarkRequest) GetOnTemp() float64 {
+	if x != nil {
+		return x.OnTemp
+	}
+	return 0
+}
+
+type StartSessionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StartSessionRequest) Reset() {
+	*x = StartSessionRequest{}
+	mi := &file_proto_tostadora_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StartSessionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StartSessionRequest) ProtoMessage() {}
+
+func (x *StartSessionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_tostadora_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StartSessionRequest.ProtoReflect.Descriptor instead.
+func (*StartSessionRequest) Descriptor() ([]byte, []int) {
+	return file_proto_tostadora_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *StartSessionRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type StopSessionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StopSessionRequest) Reset() {
+	*x = StopSessionRequest{}
+	mi := &file_proto_tostadora_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StopSessionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StopSessionRequest) ProtoMessage() {}
+
+func (x *StopSessionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_tostadora_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StopSessionRequest.ProtoReflect.Descriptor instead.
+func (*StopSessionRequest) Descriptor() ([]byte, []int) {
+	return file_proto_tostadora_proto_rawDescGZIP(), []int{12}
+}
+
+type WatchReadingsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Types         []string               `protobuf:"bytes,1,rep,name=types,proto3" json:"types,omitempty"`                           // Frame types (temp, mark, session, alarm...); every type when empty.
+	Channels      []string               `protobuf:"bytes,2,rep,name=channels,proto3" json:"channels,omitempty"`                     // Channels kept in readings and alarms; every channel when empty.
+	Roaster       string                 `protobuf:"bytes,3,opt,name=roaster,proto3" json:"roaster,omitempty"`                       // Only frames of sessions on this roaster.
+	LastSeq       *uint64                `protobuf:"varint,4,opt,name=last_seq,json=lastSeq,proto3,oneof" json:"last_seq,omitempty"` // Resume after this frame, like Last-Event-ID.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchReadingsRequest) Reset() {
+	*x = WatchReadingsRequest{}
+	mi := &file_proto_tostadora_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchReadingsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchReadingsRequest) ProtoMessage() {}
+
+func (x *WatchReadingsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_tostadora_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchReadingsRequest.ProtoReflect.Descriptor instead.
+func (*WatchReadingsRequest) Descriptor() ([]byte, []int) {
+	return file_proto_tostadora_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *WatchReadingsRequest) GetTypes() []string {
+	if x != nil {
+		return x.Types
+	}
+	return nil
+}
+
+func (x *WatchReadingsRequest) GetChannels() []string {
+	if x != nil {
+		return x.Channels
+	}
+	return nil
+}
+
+func (x *WatchReadingsRequest) GetRoaster() string {
+	if x != nil {
+		return x.Roaster
+	}
+	return ""
+}
+
+func (x *WatchReadingsRequest) GetLastSeq() uint64 {
+	if x != nil && x.LastSeq != nil {
+		return *x.LastSeq
+	}
+	return 0
+}
+
+// LiveFrame is a broadcast frame. Readings, marks and session changes are typed; the
+// other frames (control, pid, alarm...) are sent as their JSON.
+type LiveFrame struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Seq   uint64                 `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"` // 0 for frames that were not broadcast (the initial state, resync).
+	Type  string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	// Types that are valid to be assigned to Frame:
+	//
+	//	*LiveFrame_Reading
+	//	*LiveFrame_Mark
+	//	*LiveFrame_Session
+	//	*LiveFrame_Json
+	Frame         isLiveFrame_Frame `protobuf_oneof:"frame"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LiveFrame) Reset() {
+	*x = LiveFrame{}
+	mi := &file_proto_tostadora_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LiveFrame) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LiveFrame) ProtoMessage() {}
+
+func (x *LiveFrame) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_tostadora_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LiveFrame.ProtoReflect.Descriptor instead.
+func (*LiveFrame) Descriptor() ([]byte, []int) {
+	return file_proto_tostadora_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *LiveFrame) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *LiveFrame) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *LiveFrame) GetFrame() isLiveFrame_Frame {
+	if x != nil {
+		return x.Frame
+	}
+	return nil
+}
+
+func (x *LiveFrame) GetReading() *Reading {
+	if x != nil {
+		if x, ok := x.Frame.(*LiveFrame_Reading); ok {
+			return x.Reading
+		}
+	}
+	return nil
+}
+
+func (x *LiveFrame) GetMark() *Mark {
+	if x != nil {
+		if x, ok := x.Frame.(*LiveFrame_Mark); ok {
+			return x.Mark
+		}
+	}
+	return nil
+}
+
+func (x *LiveFrame) GetSession() *SessionState {
+	if x != nil {
+		if x, ok := x.Frame.(*LiveFrame_Session); ok {
+			return x.Session
+		}
+	}
+	return nil
+}
+
+func (x *LiveFrame) GetJson() string {
+	if x != nil {
+		if x, ok := x.Frame.(*LiveFrame_Json); ok {
+			return x.Json
+		}
+	}
+	return ""
+}
+
+type isLiveFrame_Frame interface {
+	isLiveFrame_Frame()
+}
+
+type LiveFrame_Reading struct {
+	Reading *Reading `protobuf:"bytes,3,opt,name=reading,proto3,oneof"`
+}
+
+type LiveFrame_Mark struct {
+	Mark *Mark `protobuf:"bytes,4,opt,name=mark,proto3,oneof"`
+}
+
+type LiveFrame_Session struct {
+	Session *SessionState `protobuf:"bytes,5,opt,name=session,proto3,oneof"`
+}
+
+type LiveFrame_Json struct {
+	Json string `protobuf:"bytes,6,opt,name=json,proto3,oneof"`
+}
+
+func (*LiveFrame_Reading) isLiveFrame_Frame() {}
+
+func (*LiveFrame_Mark) isLiveFrame_Frame() {}
+
+func (*LiveFrame_Session) isLiveFrame_Frame() {}
+
+func (*LiveFrame_Json) isLiveFrame_Frame() {}
+
+var File_proto_tostadora_proto protoreflect.FileDescriptor
+
+const file_proto_tostadora_proto_rawDesc = "" +
+	"\n" +
+	"\x15proto/tostadora.proto\x12\ftostadora.v1\"\xf5\x02\n" +
+	"\aSession\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x1b\n" +
+	"\tcreate_at\x18\x03 \x01(\x03R\bcreateAt\x12\x15\n" +
+	"\x06end_at\x18\x04 \x01(\x03R\x05endAt\x12\x1d\n" +
+	"\n" +
+	"started_by\x18\x05 \x01(\tR\tstartedBy\x12\x1d\n" +
+	"\n" +
+	"stopped_by\x18\x06 \x01(\tR\tstoppedBy\x12\x16\n" +
+	"\x06coffee\x18\a \x01(\tR\x06coffee\x12\x18\n" +
+	"\aroaster\x18\b \x01(\tR\aroaster\x12\x12\n" +
+	"\x04tags\x18\t \x03(\tR\x04tags\x12\x14\n" +
+	"\x05score\x18\n" +
+	" \x01(\x01R\x05score\x12\x14\n" +
+	"\x05notes\x18\v \x01(\tR\x05notes\x12!\n" +
+	"\fgreen_weight\x18\f \x01(\x01R\vgreenWeight\x12%\n" +
+	"\x0eroasted_weight\x18\r \x01(\x01R\rroastedWeight\x12\x18\n" +
+	"\aversion\x18\x0e \x01(\x03R\aversion\"\xec\x01\n" +
+	"\aReading\x12\x1c\n" +
+	"\ttimestamp\x18\x01 \x01(\x03R\ttimestamp\x12\x12\n" +
+	"\x04temp\x18\x02 \x01(\x01R\x04temp\x12\x12\n" +
+	"\x04unit\x18\x03 \x01(\tR\x04unit\x12?\n" +
+	"\bchannels\x18\x04 \x03(\v2#.tostadora.v1.Reading.ChannelsEntryR\bchannels\x12\x15\n" +
+	"\x03ror\x18\x05 \x01(\x01H\x00R\x03ror\x88\x01\x01\x1a;\n" +
+	"\rChannelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x01R\x05value:\x028\x01B\x06\n" +
+	"\x04_ror\"\xc1\x02\n" +
+	"\x04Mark\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x02 \x01(\tR\tsessionId\x12\x1b\n" +
+	"\tmark_name\x18\x03 \x01(\tR\bmarkName\x12\x1b\n" +
+	"\tcreate_at\x18\x04 \x01(\x03R\bcreateAt\x12\x17\n" +
+	"\aon_temp\x18\x05 \x01(\x01R\x06onTemp\x12\x1d\n" +
+	"\n" +
+	"created_by\x18\x06 \x01(\tR\tcreatedBy\x12<\n" +
+	"\bchannels\x18\a \x03(\v2 .tostadora.v1.Mark.ChannelsEntryR\bchannels\x12\x15\n" +
+	"\x03ror\x18\b \x01(\x01H\x00R\x03ror\x88\x01\x01\x1a;\n" +
+	"\rChannelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x01R\x05value:\x028\x01B\x06\n" +
+	"\x04_ror\"h\n" +
+	"\fSessionState\x12\x16\n" +
+	"\x06active\x18\x01 \x01(\bR\x06active\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x02 \x01(\tR\tsessionId\x12!\n" +
+	"\fsession_name\x18\x03 \x01(\tR\vsessionName\"\xf9\x01\n" +
+	"\x13ListSessionsRequest\x12\f\n" +
+	"\x01q\x18\x01 \x01(\tR\x01q\x12\x12\n" +
+	"\x04from\x18\x02 \x01(\x03R\x04from\x12\x0e\n" +
+	"\x02to\x18\x03 \x01(\x03R\x02to\x12\x16\n" +
+	"\x06coffee\x18\x04 \x01(\tR\x06coffee\x12\x18\n" +
+	"\aroaster\x18\x05 \x01(\tR\aroaster\x12\x12\n" +
+	"\x04user\x18\x06 \x01(\tR\x04user\x12\x12\n" +
+	"\x04tags\x18\a \x03(\tR\x04tags\x12\x12\n" +
+	"\x04sort\x18\b \x01(\tR\x04sort\x12\x14\n" +
+	"\x05order\x18\t \x01(\tR\x05order\x12\x14\n" +
+	"\x05limit\x18\n" +
+	" \x01(\x05R\x05limit\x12\x16\n" +
+	"\x06cursor\x18\v \x01(\tR\x06cursor\"\x80\x01\n" +
+	"\x14ListSessionsResponse\x121\n" +
+	"\bsessions\x18\x01 \x03(\v2\x15.tostadora.v1.SessionR\bsessions\x12\x14\n" +
+	"\x05total\x18\x02 \x01(\x05R\x05total\x12\x1f\n" +
+	"\vnext_cursor\x18\x03 \x01(\tR\n" +
+	"nextCursor\"\xa2\x01\n" +
+	"\x11GetSessionRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04from\x18\x02 \x01(\x03R\x04from\x12\x0e\n" +
+	"\x02to\x18\x03 \x01(\x03R\x02to\x12\x1d\n" +
+	"\n" +
+	"max_points\x18\x04 \x01(\x05R\tmaxPoints\x12\x1e\n" +
+	"\n" +
+	"downsample\x18\x05 \x01(\tR\n" +
+	"downsample\x12\x1a\n" +
+	"\bchannels\x18\x06 \x03(\tR\bchannels\"\xc9\x01\n" +
+	"\x12GetSessionResponse\x12/\n" +
+	"\asession\x18\x01 \x01(\v2\x15.tostadora.v1.SessionR\asession\x121\n" +
+	"\breadings\x18\x02 \x03(\v2\x15.tostadora.v1.ReadingR\breadings\x12%\n" +
+	"\x0ereadings_total\x18\x03 \x01(\x05R\rreadingsTotal\x12(\n" +
+	"\x05marks\x18\x04 \x03(\v2\x12.tostadora.v1.MarkR\x05marks\"&\n" +
+	"\x14DeleteSessionRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\x17\n" +
+	"\x15DeleteSessionResponse\"\x82\x01\n" +
+	"\x0eAddMarkRequest\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\tR\tsessionId\x12\x1b\n" +
+	"\tmark_name\x18\x02 \x01(\tR\bmarkName\x12\x1b\n" +
+	"\tcreate_at\x18\x03 \x01(\x03R\bcreateAt\x12\x17\n" +
+	"\aon_temp\x18\x04 \x01(\x01R\x06onTemp\")\n" +
+	"\x13StartSessionRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\"\x14\n" +
+	"\x12StopSessionRequest\"\x8f\x01\n" +
+	"\x14WatchReadingsRequest\x12\x14\n" +
+	"\x05types\x18\x01 \x03(\tR\x05types\x12\x1a\n" +
+	"\bchannels\x18\x02 \x03(\tR\bchannels\x12\x18\n" +
+	"\aroaster\x18\x03 \x01(\tR\aroaster\x12\x1e\n" +
+	"\blast_seq\x18\x04 \x01(\x04H\x00R\alastSeq\x88\x01\x01B\v\n" +
+	"\t_last_seq\"\xe5\x01\n" +
+	"\tLiveFrame\x12\x10\n" +
+	"\x03seq\x18\x01 \x01(\x04R\x03seq\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x121\n" +
+	"\areading\x18\x03 \x01(\v2\x15.tostadora.v1.ReadingH\x00R\areading\x12(\n" +
+	"\x04mark\x18\x04 \x01(\v2\x12.tostadora.v1.MarkH\x00R\x04mark\x126\n" +
+	"\asession\x18\x05 \x01(\v2\x1a.tostadora.v1.SessionStateH\x00R\asession\x12\x14\n" +
+	"\x04json\x18\x06 \x01(\tH\x00R\x04jsonB\a\n" +
+	"\x05frame2\xb6\x04\n" +
+	"\tTostadora\x12U\n" +
+	"\fListSessions\x12!.tostadora.v1.ListSessionsRequest\x1a\".tostadora.v1.ListSessionsResponse\x12O\n" +
+	"\n" +
+	"GetSession\x12\x1f.tostadora.v1.GetSessionRequest\x1a .tostadora.v1.GetSessionResponse\x12X\n" +
+	"\rDeleteSession\x12\".tostadora.v1.DeleteSessionRequest\x1a#.tostadora.v1.DeleteSessionResponse\x12;\n" +
+	"\aAddMark\x12\x1c.tostadora.v1.AddMarkRequest\x1a\x12.tostadora.v1.Mark\x12M\n" +
+	"\fStartSession\x12!.tostadora.v1.StartSessionRequest\x1a\x1a.tostadora.v1.SessionState\x12K\n" +
+	"\vStopSession\x12 .tostadora.v1.StopSessionRequest\x1a\x1a.tostadora.v1.SessionState\x12N\n" +
+	"\rWatchReadings\x12\".tostadora.v1.WatchReadingsRequest\x1a\x17.tostadora.v1.LiveFrame0\x01B\x1eZ\x1ctostadora_server/tostadorapbb\x06proto3"
+
+var (
+	file_proto_tostadora_proto_rawDescOnce sync.Once
+	file_proto_tostadora_proto_rawDescData []byte
+)
+
+func file_proto_tostadora_proto_rawDescGZIP() []byte {
+	file_proto_tostadora_proto_rawDescOnce.Do(func() {
+		file_proto_tostadora_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proto_tostadora_proto_rawDesc), len(file_proto_tostadora_proto_rawDesc)))
+	})
+	return file_proto_tostadora_proto_rawDescData
+}
+
+var file_proto_tostadora_proto_msgTypes = make([]protoimpl.MessageInfo, 17)
+var file_proto_tostadora_proto_goTypes = []any{
+	(*Session)(nil),               // 0: tostadora.v1.Session
+	(*Reading)(nil),               // 1: tostadora.v1.Reading
+	(*Mark)(nil),                  // 2: tostadora.v1.Mark
+	(*SessionState)(nil),          // 3: tostadora.v1.SessionState
+	(*ListSessionsRequest)(nil),   // 4: tostadora.v1.ListSessionsRequest
+	(*ListSessionsResponse)(nil),  // 5: tostadora.v1.ListSessionsResponse
+	(*GetSessionRequest)(nil),     // 6: tostadora.v1.GetSessionRequest
+	(*GetSessionResponse)(nil),    // 7: tostadora.v1.GetSessionResponse
+	(*DeleteSessionRequest)(nil),  // 8: tostadora.v1.DeleteSessionRequest
+	(*DeleteSessionResponse)(nil), // 9: tostadora.v1.DeleteSessionResponse
+	(*AddMarkRequest)(nil),        // 10: tostadora.v1.AddMarkRequest
+	(*StartSessionRequest)(nil),   // 11: tostadora.v1.StartSessionRequest
+	(*StopSessionRequest)(nil),    // 12: tostadora.v1.StopSessionRequest
+	(*WatchReadingsRequest)(nil),  // 13: tostadora.v1.WatchReadingsRequest
+	(*LiveFrame)(nil),             // 14: tostadora.v1.LiveFrame
+	nil,                           // 15: tostadora.v1.Reading.ChannelsEntry
+	nil,                           // 16: tostadora.v1.Mark.ChannelsEntry
+}
+var file_proto_tostadora_proto_depIdxs = []int32{
+	15, // 0: tostadora.v1.Reading.channels:type_name -> tostadora.v1.Reading.ChannelsEntry
+	16, // 1: tostadora.v1.Mark.channels:type_name -> tostadora.v1.Mark.ChannelsEntry
+	0,  // 2: tostadora.v1.ListSessionsResponse.sessions:type_name -> tostadora.v1.Session
+	0,  // 3: tostadora.v1.GetSessionResponse.session:type_name -> tostadora.v1.Session
+	1,  // 4: tostadora.v1.GetSessionResponse.readings:type_name -> tostadora.v1.Reading
+	2,  // 5: tostadora.v1.GetSessionResponse.marks:type_name -> tostadora.v1.Mark
+	1,  // 6: tostadora.v1.LiveFrame.reading:type_name -> tostadora.v1.Reading
+	2,  // 7: tostadora.v1.LiveFrame.mark:type_name -> tostadora.v1.Mark
+	3,  // 8: tostadora.v1.LiveFrame.session:type_name -> tostadora.v1.SessionState
+	4,  // 9: tostadora.v1.Tostadora.ListSessions:input_type -> tostadora.v1.ListSessionsRequest
+	6,  // 10: tostadora.v1.Tostadora.GetSession:input_type -> tostadora.v1.GetSessionRequest
+	8,  // 11: tostadora.v1.Tostadora.DeleteSession:input_type -> tostadora.v1.DeleteSessionRequest
+	10, // 12: tostadora.v1.Tostadora.AddMark:input_type -> tostadora.v1.AddMarkRequest
+	11, // 13: tostadora.v1.Tostadora.StartSession:input_type -> tostadora.v1.StartSessionRequest
+	12, // 14: tostadora.v1.Tostadora.StopSession:input_type -> tostadora.v1.StopSessionRequest
+	13, // 15: tostadora.v1.Tostadora.WatchReadings:input_type -> tostadora.v1.WatchReadingsRequest
+	5,  // 16: tostadora.v1.Tostadora.ListSessions:output_type -> tostadora.v1.ListSessionsResponse
+	7,  // 17: tostadora.v1.Tostadora.GetSession:output_type -> tostadora.v1.GetSessionResponse
+	9,  // 18: tostadora.v1.Tostadora.DeleteSession:output_type -> tostadora.v1.DeleteSessionResponse
+	2,  // 19: tostadora.v1.Tostadora.AddMark:output_type -> tostadora.v1.Mark
+	3,  // 20: tostadora.v1.Tostadora.StartSession:output_type -> tostadora.v1.SessionState
+	3,  // 21: tostadora.v1.Tostadora.StopSession:output_type -> tostadora.v1.SessionState
+	14, // 22: tostadora.v1.Tostadora.WatchReadings:output_type -> tostadora.v1.LiveFrame
+	16, // [16:23] is the sub-list for method output_type
+	9,  // [9:16] is the sub-list for method input_type
+	9,  // [9:9] is the sub-list for extension type_name
+	9,  // [9:9] is the sub-list for extension extendee
+	0,  // [0:9] is the sub-list for field type_name
+}
+
+func init() { file_proto_tostadora_proto_init() }
+func file_proto_tostadora_proto_init() {
+	if File_proto_tostadora_proto != nil {
+		return
+	}
+	file_proto_tostadora_proto_msgTypes[1].OneofWrappers = []any{}
+	file_proto_tostadora_proto_msgTypes[2].OneofWrappers = []any{}
+	file_proto_tostadora_proto_msgTypes[13].OneofWrappers = []any{}
+	file_proto_tostadora_proto_msgTypes[14].OneofWrappers = []any{
+		(*LiveFrame_Reading)(nil),
+		(*LiveFrame_Mark)(nil),
+		(*LiveFrame_Session)(nil),
+		(*LiveFrame_Json)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_tostadora_proto_rawDesc), len(file_proto_tostadora_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   17,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_proto_tostadora_proto_goTypes,
+		DependencyIndexes: file_proto_tostadora_proto_depIdxs,
+		MessageInfos:      file_proto_tostadora_proto_msgTypes,
+	}.Build()
+	File_proto_tostadora_proto = out.File
+	file_proto_tostadora_proto_goTypes = nil
+	file_proto_tostadora_proto_depIdxs = nil
+}
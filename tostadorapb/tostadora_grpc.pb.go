@@ -0,0 +1,378 @@
+// gRPC API of the roaster server. It mirrors the REST and WebSocket APIs: the same
+// permissions apply, with the login or API token sent as "authorization: Bearer <token>"
+// metadata.
+//
+// The Go code in tostadorapb is generated from this file with:
+//
+//	protoc --go_out=. --go_opt=module=tostadora_server \
+//	    --go-grpc_out=. --go-grpc_opt=module=tostadora_server proto/tostadora.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: proto/tostadora.proto
+
+package tostadorapb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Tostadora_ListSessions_FullMethodName  = "/tostadora.v1.Tostadora/ListSessions"
+	Tostadora_GetSession_FullMethodName    = "/tostadora.v1.Tostadora/GetSession"
+	Tostadora_DeleteSession_FullMethodName = "/tostadora.v1.Tostadora/DeleteSession"
+	Tostadora_AddMark_FullMethodName       = "/tostadora.v1.Tostadora/AddMark"
+	Tostadora_StartSession_FullMethodName  = "/tostadora.v1.Tostadora/StartSession"
+	Tostadora_StopSession_FullMethodName   = "/tostadora.v1.Tostadora/StopSession"
+	Tostadora_WatchReadings_FullMethodName = "/tostadora.v1.Tostadora/WatchReadings"
+)
+
+// TostadoraClient is the client API for Tostadora service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type TostadoraClient interface {
+	// ListSessions returns a page of the stored sessions (GET /api/v1/temp/roast_sessions).
+	ListSessions(ctx context.Context, in *ListSessionsRequest, opts ...grpc.CallOption) (*ListSessionsResponse, error)
+	// GetSession returns a session with its readings and marks (GET /api/v1/temp/roast_sessions/{id}).
+	GetSession(ctx context.Context, in *GetSessionRequest, opts ...grpc.CallOption) (*GetSessionResponse, error)
+	// DeleteSession moves a session to the trash (DELETE /api/v1/temp/roast_sessions/{id}).
+	DeleteSession(ctx context.Context, in *DeleteSessionRequest, opts ...grpc.CallOption) (*DeleteSessionResponse, error)
+	// AddMark stores a mark (POST /api/v1/temp/roast_sessions/mark), or marks the active
+	// session at the current reading when create_at is 0 (POST .../mark/now).
+	AddMark(ctx context.Context, in *AddMarkRequest, opts ...grpc.CallOption) (*Mark, error)
+	// StartSession starts recording a session (WebSocket "start").
+	StartSession(ctx context.Context, in *StartSessionRequest, opts ...grpc.CallOption) (*SessionState, error)
+	// StopSession stops the active session (WebSocket "stop").
+	StopSession(ctx context.Context, in *StopSessionRequest, opts ...grpc.CallOption) (*SessionState, error)
+	// WatchReadings streams the live frames broadcast to the WebSocket and SSE clients.
+	WatchReadings(ctx context.Context, in *WatchReadingsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[LiveFrame], error)
+}
+
+type tostadoraClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTostadoraClient(cc grpc.ClientConnInterface) TostadoraClient {
+	return &tostadoraClient{cc}
+}
+
+func (c *tostadoraClient) ListSessions(ctx context.Context, in *ListSessionsRequest, opts ...grpc.CallOption) (*ListSessionsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListSessionsResponse)
+	err := c.cc.Invoke(ctx, Tostadora_ListSessions_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tostadoraClient) GetSession(ctx context.Context, in *GetSessionRequest, opts ...grpc.CallOption) (*GetSessionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetSessionResponse)
+	err := c.cc.Invoke(ctx, Tostadora_GetSession_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tostadoraClient) DeleteSession(ctx context.Context, in *DeleteSessionRequest, opts ...grpc.CallOption) (*DeleteSessionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteSessionResponse)
+	err := c.cc.Invoke(ctx, Tostadora_DeleteSession_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tostadoraClient) AddMark(ctx context.Context, in *AddMarkRequest, opts ...grpc.CallOption) (*Mark, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Mark)
+	err := c.cc.Invoke(ctx, Tostadora_AddMark_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tostadoraClient) StartSession(ctx context.Context, in *StartSessionRequest, opts ...grpc.CallOption) (*SessionState, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SessionState)
+	err := c.cc.Invoke(ctx, Tostadora_StartSession_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tostadoraClient) StopSession(ctx context.Context, in *StopSessionRequest, opts ...grpc.CallOption) (*SessionState, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SessionState)
+	err := c.cc.Invoke(ctx, Tostadora_StopSession_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tostadoraClient) WatchReadings(ctx context.Context, in *WatchReadingsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[LiveFrame], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Tostadora_ServiceDesc.Streams[0], Tostadora_WatchReadings_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchReadingsRequest, LiveFrame]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Tostadora_WatchReadingsClient = grpc.ServerStreamingClient[LiveFrame]
+
+// TostadoraServer is the server API for Tostadora service.
+// All implementations must embed UnimplementedTostadoraServer
+// for forward compatibility.
+type TostadoraServer interface {
+	// ListSessions returns a page of the stored sessions (GET /api/v1/temp/roast_sessions).
+	ListSessions(context.Context, *ListSessionsRequest) (*ListSessionsResponse, error)
+	// GetSession returns a session with its readings and marks (GET /api/v1/temp/roast_sessions/{id}).
+	GetSession(context.Context, *GetSessionRequest) (*GetSessionResponse, error)
+	// DeleteSession moves a session to the trash (DELETE /api/v1/temp/roast_sessions/{id}).
+	DeleteSession(context.Context, *DeleteSessionRequest) (*DeleteSessionResponse, error)
+	// AddMark stores a mark (POST /api/v1/temp/roast_sessions/mark), or marks the active
+	// session at the current reading when create_at is 0 (POST .../mark/now).
+	AddMark(context.Context, *AddMarkRequest) (*Mark, error)
+	// StartSession starts recording a session (WebSocket "start").
+	StartSession(context.Context, *StartSessionRequest) (*SessionState, error)
+	// StopSession stops the active session (WebSocket "stop").
+	StopSession(context.Context, *StopSessionRequest) (*SessionState, error)
+	// WatchReadings streams the live frames broadcast to the WebSocket and SSE clients.
+	WatchReadings(*WatchReadingsRequest, grpc.ServerStreamingServer[LiveFrame]) error
+	mustEmbedUnimplementedTostadoraServer()
+}
+
+// UnimplementedTostadoraServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedTostadoraServer struct{}
+
+func (UnimplementedTostadoraServer) ListSessions(context.Context, *ListSessionsRequest) (*ListSessionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSessions not implemented")
+}
+func (UnimplementedTostadoraServer) GetSession(context.Context, *GetSessionRequest) (*GetSessionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSession not implemented")
+}
+func (UnimplementedTostadoraServer) DeleteSession(context.Context, *DeleteSessionRequest) (*DeleteSessionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteSession not implemented")
+}
+func (UnimplementedTostadoraServer) AddMark(context.Context, *AddMarkRequest) (*Mark, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddMark not implemented")
+}
+func (UnimplementedTostadoraServer) StartSession(context.Context, *StartSessionRequest) (*SessionState, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StartSession not implemented")
+}
+func (UnimplementedTostadoraServer) StopSession(context.Context, *StopSessionRequest) (*SessionState, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StopSession not implemented")
+}
+func (UnimplementedTostadoraServer) WatchReadings(*WatchReadingsRequest, grpc.ServerStreamingServer[LiveFrame]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchReadings not implemented")
+}
+func (UnimplementedTostadoraServer) mustEmbedUnimplementedTostadoraServer() {}
+func (UnimplementedTostadoraServer) testEmbeddedByValue()                   {}
+
+// UnsafeTostadoraServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TostadoraServer will
+// result in compilation errors.
+type UnsafeTostadoraServer interface {
+	mustEmbedUnimplementedTostadoraServer()
+}
+
+func RegisterTostadoraServer(s grpc.ServiceRegistrar, srv TostadoraServer) {
+	// If the following call pancis, it indicates UnimplementedTostadoraServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Tostadora_ServiceDesc, srv)
+}
+
+func _Tostadora_ListSessions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSessionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TostadoraServer).ListSessions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tostadora_ListSessions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TostadoraServer).ListSessions(ctx, req.(*ListSessionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tostadora_GetSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TostadoraServer).GetSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tostadora_GetSession_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TostadoraServer).GetSession(ctx, req.(*GetSessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tostadora_DeleteSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteSessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TostadoraServer).DeleteSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tostadora_DeleteSession_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TostadoraServer).DeleteSession(ctx, req.(*DeleteSessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tostadora_AddMark_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddMarkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TostadoraServer).AddMark(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tostadora_AddMark_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TostadoraServer).AddMark(ctx, req.(*AddMarkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tostadora_StartSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StartSessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TostadoraServer).StartSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tostadora_StartSession_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TostadoraServer).StartSession(ctx, req.(*StartSessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tostadora_StopSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StopSessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TostadoraServer).StopSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tostadora_StopSession_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TostadoraServer).StopSession(ctx, req.(*StopSessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tostadora_WatchReadings_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchReadingsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TostadoraServer).WatchReadings(m, &grpc.GenericServerStream[WatchReadingsRequest, LiveFrame]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Tostadora_WatchReadingsServer = grpc.ServerStreamingServer[LiveFrame]
+
+// Tostadora_ServiceDesc is the grpc.ServiceDesc for Tostadora service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Tostadora_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "tostadora.v1.Tostadora",
+	HandlerType: (*TostadoraServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListSessions",
+			Handler:    _Tostadora_ListSessions_Handler,
+		},
+		{
+			MethodName: "GetSession",
+			Handler:    _Tostadora_GetSession_Handler,
+		},
+		{
+			MethodName: "DeleteSession",
+			Handler:    _Tostadora_DeleteSession_Handler,
+		},
+		{
+			MethodName: "AddMark",
+			Handler:    _Tostadora_AddMark_Handler,
+		},
+		{
+			MethodName: "StartSession",
+			Handler:    _Tostadora_StartSession_Handler,
+		},
+		{
+			MethodName: "StopSession",
+			Handler:    _Tostadora_StopSession_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchReadings",
+			Handler:       _Tostadora_WatchReadings_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "proto/tostadora.proto",
+}
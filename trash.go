@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// trash_retention is how long deleted sessions stay in the trash before they are
+// purged; set with -trash-days.
+var trash_retention = 30 * 24 * time.Hour
+
+// PurgeExpiredTrash permanently deletes the sessions that have been in the trash for
+// longer than the retention period.
+func PurgeExpiredTrash() {
+	before := time.Now().Add(-trash_retention).UnixMilli()
+	for _, session_id := range session_data_provider.GetExpiredTrash(before) {
+		if err := session_data_provider.PurgeSession(session_id); err != nil {
+			log.Println("papelera:", err)
+			continue
+		}
+		log.Println("papelera: session purgada", session_id)
+		AuditAs("system", "", "session.purge", session_id, map[string]any{"reason": "retention"})
+	}
+}
+
+// RunTrashRetention purges expired sessions now and then every hour.
+func RunTrashRetention() {
+	for {
+		PurgeExpiredTrash()
+		time.Sleep(time.Hour)
+	}
+}
+
+// roastTrashHandler lists the sessions in the trash and when each will be purged.
+func roastTrashHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+
+	sessions := session_data_provider.GetTrash()
+	purge_at := map[string]int64{}
+	for _, s := range sessions {
+		purge_at[s.Id] = time.UnixMilli(s.DeletedAt).Add(trash_retention).UnixMilli()
+	}
+
+	json.NewEncoder(w).Encode(map[string]any{"sessions": sessions, "purge_at": purge_at, "retention_days": trash_retention.Hours() / 24})
+}
+
+// roastRestoreSessionHandler takes the session {id} out of the trash.
+func roastRestoreSessionHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+	session_id := r.PathValue("id")
+
+	if err := session_data_provider.RestoreSession(session_id); err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	Audit(r, "session.restore", session_id, nil)
+
+	json.NewEncoder(w).Encode(map[string]any{"status": true, "msg": "session restaurada"})
+}
+
+// roastPurgeSessionHandler permanently deletes the session {id}, which must be in the trash.
+func roastPurgeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+	session_id := r.PathValue("id")
+
+	purged, _ := session_data_provider.GetSessionById(session_id)
+	if err := session_data_provider.PurgeSession(session_id); err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	Audit(r, "session.purge", session_id, map[string]any{"name": purged.Name, "create_at": purged.CreateAt, "deleted_by": purged.DeletedBy})
+
+	json.NewEncoder(w).Encode(map[string]any{"status": true, "msg": "session eliminada definitivamente"})
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+// User is an account that can log into the REST and WebSocket APIs.
+type User struct {
+	Id        int64  `json:"id"`         // The unique ID of the user.
+	Username  string `json:"username"`   // The login name.
+	Role      string `json:"role"`       // "viewer", "operator" or "admin".
+	CreatedAt int64  `json:"created_at"` // The timestamp when the user was created (in milliseconds).
+
+	// Set when the request was authenticated with an API token instead of a login.
+	TokenId   int64    `json:"token_id,omitempty"`   // The ID of the API token.
+	TokenName string   `json:"token_name,omitempty"` // The name of the API token.
+	Scopes    []string `json:"scopes,omitempty"`     // The scopes of the API token.
+}
+
+// Actor returns the name recorded as the author of changes: the username, or
+// "token:<name>" for API tokens.
+func (this User) Actor() string {
+	if this.TokenId != 0 {
+		return "token:" + this.TokenName
+	}
+	return this.Username
+}
+
+// ApiToken is a long lived credential for scripts and integrations. Only the hash of
+// the token is stored.
+type ApiToken struct {
+	Id         int64    `json:"id"`           // The unique ID of the token.
+	Name       string   `json:"name"`         // What the token is for, e.g. "erp-sync".
+	Scopes     []string `json:"scopes"`       // What the token may do.
+	UserId     int64    `json:"user_id"`      // The user who created it; the token never gets more than its role.
+	Username   string   `json:"username"`     // The name of that user.
+	CreatedAt  int64    `json:"created_at"`   // When it was created (in milliseconds).
+	ExpiresAt  int64    `json:"expires_at"`   // When it expires (in milliseconds), 0 for never.
+	LastUsedAt int64    `json:"last_used_at"` // When it was last used (in milliseconds), 0 if never.
+	RevokedAt  int64    `json:"revoked_at"`   // When it was revoked (in milliseconds), 0 if active.
+}
+
+// UserDataProvider stores users and their login sessions.
+type UserDataProvider struct {
+	Db *sql.DB // The database connection.
+}
+
+// NewUserDataProvider creates a new UserDataProvider.
+func NewUserDataProvider(db *sql.DB) *UserDataProvider {
+	return &UserDataProvider{Db: db}
+}
+
+// CountUsers returns the number of registered users.
+func (this UserDataProvider) CountUsers() int {
+	var count int
+	if err := this.Db.QueryRow(`SELECT count(*) FROM users`).Scan(&count); err != nil {
+		log.Println("error al contar usuarios,", err)
+	}
+	return count
+}
+
+// CreateUser stores a new user with an already hashed password.
+func (this UserDataProvider) CreateUser(username string, password_hash string, role string) (User, error) {
+	user := User{Username: username, Role: role, CreatedAt: time.Now().UnixMilli()}
+
+	res, err := this.Db.Exec(`INSERT INTO users (username,password_hash,role,created_at) VALUES (?,?,?,?)`, username, password_hash, role, user.CreatedAt)
+	if err != nil {
+		log.Println("error al crear usuario", err)
+		return user, errors.New("error_create_user")
+	}
+	user.Id, _ = res.LastInsertId()
+	return user, nil
+}
+
+// CreateFirstUser stores a user only if there are no users yet, checking and inserting
+// in one statement so concurrent calls cannot both succeed.
+func (this UserDataProvider) CreateFirstUser(username string, password_hash string, role string) (User, error) {
+	user := User{Username: username, Role: role, CreatedAt: time.Now().UnixMilli()}
+
+	res, err := this.Db.Exec(`INSERT INTO users (username,password_hash,role,created_at)
+		SELECT ?,?,?,? WHERE NOT EXISTS (SELECT 1 FROM users)`, username, password_hash, role, user.CreatedAt)
+	if err != nil {
+		log.Println("error al crear usuario", err)
+		return user, errors.New("error_create_user")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return user, errors.New("ya hay usuarios")
+	}
+	user.Id, _ = res.LastInsertId()
+	return user, nil
+}
+
+// GetUserByName returns a user and its password hash.
+func (this UserDataProvider) GetUserByName(username string) (User, string, error) {
+	var user User
+	var password_hash string
+
+	err := this.Db.QueryRow(`SELECT id,username,role,created_at,password_hash FROM users WHERE username = ?`, username).
+		Scan(&user.Id, &user.Username, &user.Role, &user.CreatedAt, &password_hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, "", errors.New("usuario no encontrado")
+	}
+	if err != nil {
+		log.Println("error al obtener usuario,", err)
+		return user, "", errors.New("error_get_user")
+	}
+	return user, password_hash, nil
+}
+
+// GetUsers returns every user.
+func (this UserDataProvider) GetUsers() []User {
+	users := []User{}
+
+	rows, err := this.Db.Query(`SELECT id,username,role,created_at FROM users ORDER BY username`)
+	if err != nil {
+		log.Println("error al obtener usuarios,", err)
+		return users
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.Id, &user.Username, &user.Role, &user.CreatedAt); err != nil {
+			log.Println(err)
+			continue
+		}
+		users = append(users, user)
+	}
+	return users
+}
+
+// GetUserById returns a user by its ID.
+func (this UserDataProvider) GetUserById(user_id int64) (User, error) {
+	var user User
+
+	err := this.Db.QueryRow(`SELECT id,username,role,created_at FROM users WHERE id = ?`, user_id).
+		Scan(&user.Id, &user.Username, &user.Role, &user.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, errors.New("usuario no encontrado")
+	}
+	if err != nil {
+		log.Println("error al obtener usuario,", err)
+		return user, errors.New("error_get_user")
+	}
+	return user, nil
+}
+
+// CountRole returns the number of users with the given role.
+func (this UserDataProvider) CountRole(role string) int {
+	var count int
+	if err := this.Db.QueryRow(`SELECT count(*) FROM users WHERE role = ?`, role).Scan(&count); err != nil {
+		log.Println("error al contar usuarios,", err)
+	}
+	return count
+}
+
+// SetRole changes the role of a user.
+func (this UserDataProvider) SetRole(user_id int64, role string) error {
+	_, err := this.Db.Exec(`UPDATE users SET role = ? WHERE id = ?`, role, user_id)
+	if err != nil {
+		log.Println("error al cambiar rol", err)
+		return errors.New("error_set_role")
+	}
+	return nil
+}
+
+// SetPassword replaces the password hash of a user.
+func (this UserDataProvider) SetPassword(user_id int64, password_hash string) error {
+	_, err := this.Db.Exec(`UPDATE users SET password_hash = ? WHERE id = ?`, password_hash, user_id)
+	if err != nil {
+		log.Println("error al cambiar password", err)
+		return errors.New("error_set_password")
+	}
+	return nil
+}
+
+// CreateLogin stores a login session by the hash of its token.
+func (this UserDataProvider) CreateLogin(token_hash string, user_id int64, expires_at int64) error {
+	_, err := this.Db.Exec(`INSERT INTO logins (token_hash,user_id,created_at,expires_at) VALUES (?,?,?,?)`, token_hash, user_id, time.Now().UnixMilli(), expires_at)
+	if err != nil {
+		log.Println("error al crear login", err)
+		return errors.New("error_create_login")
+	}
+	return nil
+}
+
+// GetLoginUser returns the user of an unexpired login session.
+func (this UserDataProvider) GetLoginUser(token_hash string) (User, error) {
+	var user User
+
+	err := this.Db.QueryRow(`
+		SELECT users.id,users.username,users.role,users.created_at FROM logins
+		JOIN users ON users.id = logins.user_id
+		WHERE logins.token_hash = ? AND logins.expires_at > ?`, token_hash, time.Now().UnixMilli()).
+		Scan(&user.Id, &user.Username, &user.Role, &user.CreatedAt)
+	if err != nil {
+		return user, errors.New("login invalido o expirado")
+	}
+	return user, nil
+}
+
+// DeleteLogin ends a login session.
+func (this UserDataProvider) DeleteLogin(token_hash string) {
+	if _, err := this.Db.Exec(`DELETE FROM logins WHERE token_hash = ?`, token_hash); err != nil {
+		log.Println("error al eliminar login", err)
+	}
+}
+
+// CreateApiToken stores a new API token by its hash.
+func (this UserDataProvider) CreateApiToken(token ApiToken, token_hash string) (ApiToken, error) {
+	token.CreatedAt = time.Now().UnixMilli()
+
+	res, err := this.Db.Exec(`INSERT INTO api_tokens (name,token_hash,scopes,user_id,created_at,expires_at,last_used_at,revoked_at) VALUES (?,?,?,?,?,?,0,0)`,
+		token.Name, token_hash, strings.Join(token.Scopes, ","), token.UserId, token.CreatedAt, token.ExpiresAt)
+	if err != nil {
+		log.Println("error al crear token", err)
+		return token, errors.New("error_create_token")
+	}
+	token.Id, _ = res.LastInsertId()
+	return token, nil
+}
+
+// GetApiTokens returns the API tokens created by user_id, or every token when user_id is 0.
+func (this UserDataProvider) GetApiTokens(user_id int64) []ApiToken {
+	tokens := []ApiToken{}
+
+	rows, err := this.Db.Query(`
+		SELECT api_tokens.id,api_tokens.name,api_tokens.scopes,api_tokens.user_id,users.username,
+			api_tokens.created_at,api_tokens.expires_at,api_tokens.last_used_at,api_tokens.revoked_at
+		FROM api_tokens JOIN users ON users.id = api_tokens.user_id
+		WHERE ? = 0 OR api_tokens.user_id = ?
+		ORDER BY api_tokens.created_at DESC`, user_id, user_id)
+	if err != nil {
+		log.Println("error al obtener tokens,", err)
+		return tokens
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var token ApiToken
+		var scopes string
+		if err := rows.Scan(&token.Id, &token.Name, &scopes, &token.UserId, &token.Username, &token.CreatedAt, &token.ExpiresAt, &token.LastUsedAt, &token.RevokedAt); err != nil {
+			log.Println(err)
+			continue
+		}
+		token.Scopes = splitScopes(scopes)
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+// GetApiTokenUser returns the user of an active API token, with the scopes of the token,
+// and records the use.
+func (this UserDataProvider) GetApiTokenUser(token_hash string) (User, error) {
+	var user User
+	var scopes string
+	now := time.Now().UnixMilli()
+
+	err := this.Db.QueryRow(`
+		SELECT users.id,users.username,users.role,users.created_at,api_tokens.id,api_tokens.name,api_tokens.scopes
+		FROM api_tokens JOIN users ON users.id = api_tokens.user_id
+		WHERE api_tokens.token_hash = ? AND api_tokens.revoked_at = 0
+			AND (api_tokens.expires_at = 0 OR api_tokens.expires_at > ?)`, token_hash, now).
+		Scan(&user.Id, &user.Username, &user.Role, &user.CreatedAt, &user.TokenId, &user.TokenName, &scopes)
+	if err != nil {
+		return user, errors.New("token invalido, revocado o expirado")
+	}
+	user.Scopes = splitScopes(scopes)
+
+	if _, err := this.Db.Exec(`UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, now, user.TokenId); err != nil {
+		log.Println("error al actualizar uso del token", err)
+	}
+	return user, nil
+}
+
+// RevokeApiToken revokes a token. Unless user_id is 0 the token must belong to that user.
+func (this UserDataProvider) RevokeApiToken(token_id int64, user_id int64) error {
+	res, err := this.Db.Exec(`UPDATE api_tokens SET revoked_at = ? WHERE id = ? AND revoked_at = 0 AND (? = 0 OR user_id = ?)`,
+		time.Now().UnixMilli(), token_id, user_id, user_id)
+	if err != nil {
+		log.Println("error al revocar token", err)
+		return errors.New("error_revoke_token")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errors.New("token no encontrado")
+	}
+	return nil
+}
+
+// splitScopes parses the stored comma separated scopes.
+func splitScopes(scopes string) []string {
+	if scopes == "" {
+		return []string{}
+	}
+	return strings.Split(scopes, ",")
+}
+
+// Prepare creates the user tables if they don't already exist and drops expired logins.
+func (this UserDataProvider) Prepare() {
+
+	create_sql := `
+create table if NOT EXISTS users
+(
+	id integer PRIMARY KEY AUTOINCREMENT,
+	username text not null UNIQUE,
+	password_hash text not null,
+	created_at integer not null
+);
+
+create table if NOT EXISTS api_tokens
+(
+	id integer PRIMARY KEY AUTOINCREMENT,
+	name text not null,
+	token_hash text not null UNIQUE,
+	scopes text not null,
+	user_id integer not null,
+	created_at integer not null,
+	expires_at integer not null,
+	last_used_at integer not null,
+	revoked_at integer not null
+);
+
+create table if NOT EXISTS logins
+(
+	token_hash text PRIMARY KEY,
+	user_id integer not null,
+	created_at integer not null,
+	expires_at integer not null
+);
+	`
+
+	_, err := this.Db.Exec(create_sql)
+	if err != nil {
+		log.Println("error al crear las tablas de usuarios", err)
+	}
+
+	// Users created before roles existed keep the access they had; the oldest one
+	// becomes the administrator.
+	addColumn(this.Db, "users", "role", "text not null default 'operator'")
+	if this.CountUsers() > 0 && this.CountRole(RoleAdmin) == 0 {
+		if _, err := this.Db.Exec(`UPDATE users SET role = ? WHERE id = (SELECT min(id) FROM users)`, RoleAdmin); err != nil {
+			log.Println("error al asignar administrador", err)
+		}
+	}
+
+	if _, err := this.Db.Exec(`DELETE FROM logins WHERE expires_at <= ?`, time.Now().UnixMilli()); err != nil {
+		log.Println("error al limpiar logins", err)
+	}
+}
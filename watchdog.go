@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Incident levels.
+const (
+	IncidentWarning  = "warning"
+	IncidentCritical = "critical"
+)
+
+// WatchdogConfig holds the thresholds of the safety watchdog.
+type WatchdogConfig struct {
+	StaleWarnS       float64            `json:"stale_warn_s"`       // Seconds without samples before warning.
+	StaleCriticalS   float64            `json:"stale_critical_s"`   // Seconds without samples before tripping.
+	MaxJump          float64            `json:"max_jump"`           // Largest plausible change between samples, in degrees per second of roast.
+	JumpsToTrip      int                `json:"jumps_to_trip"`      // Consecutive implausible jumps before tripping.
+	OpenCircuitAbove float64            `json:"open_circuit_above"` // Readings at or above this mean a disconnected probe.
+	OpenCircuit      []float64          `json:"open_circuit"`       // Exact readings reported by disconnected probes.
+	OverTemp         map[string]float64 `json:"over_temp"`          // Trip temperature per channel ("bt" is the primary reading).
+	CheckMs          int64              `json:"check_ms"`           // How often the staleness is checked.
+}
+
+// DefaultWatchdogConfig returns thresholds for thermocouple probes on a drum roaster.
+// MAX6675/MAX31855 boards report NaN or ~1024°C (2047.75 raw) and DS18B20 -127 on open circuit.
+func DefaultWatchdogConfig() *WatchdogConfig {
+	return &WatchdogConfig{
+		StaleWarnS:       5,
+		StaleCriticalS:   15,
+		MaxJump:          25,
+		JumpsToTrip:      3,
+		OpenCircuitAbove: 1000,
+		OpenCircuit:      []float64{-127},
+		OverTemp:         map[string]float64{"bt": 240, "et": 320},
+		CheckMs:          1000,
+	}
+}
+
+// LoadWatchdogConfig reads watchdog thresholds from a JSON file; missing fields keep the defaults.
+func LoadWatchdogConfig(path string) (*WatchdogConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := DefaultWatchdogConfig()
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+	if config.CheckMs <= 0 {
+		config.CheckMs = 1000
+	}
+	if config.JumpsToTrip <= 0 {
+		config.JumpsToTrip = 1
+	}
+	return config, nil
+}
+
+// Incident is a watchdog trip as stored in the incident log.
+type Incident struct {
+	Id        int64   `json:"id"`
+	SessionId string  `json:"session_id,omitempty"` // The session active when it happened.
+	TimeStamp int64   `json:"timestamp"`            // When it happened (in milliseconds).
+	Kind      string  `json:"kind"`                 // "stale", "jump", "open_circuit" or "over_temp".
+	Level     string  `json:"level"`                // "warning" or "critical".
+	Channel   string  `json:"channel,omitempty"`    // The channel involved.
+	Value     float64 `json:"value"`                // The offending reading, or the seconds without data.
+	Msg       string  `json:"msg"`
+	Actions   string  `json:"actions"` // Comma separated actions taken: alert, mark, heat_off.
+}
+
+// Watchdog watches the live samples for stale data, implausible jumps, disconnected
+// probes and over-temperature, and escalates by alerting the clients, marking the
+// session and forcing the heat off.
+type Watchdog struct {
+	mu      sync.Mutex
+	config  *WatchdogConfig
+	last_ts int64
+	last    map[string]float64
+	jumps   map[string]int
+	tripped map[string]string // Active conditions and their level, by kind:channel.
+	started int64
+
+	time_scale func() float64 // Seconds of roast per second between sample timestamps.
+}
+
+// NewWatchdog creates a watchdog with the given thresholds. time_scale tells how fast
+// the sources run against the wall clock, so jumps are judged in roast time; nil means
+// they run in real time.
+func NewWatchdog(config *WatchdogConfig, time_scale func() float64) *Watchdog {
+	if time_scale == nil {
+		time_scale = func() float64 { return 1 }
+	}
+	return &Watchdog{
+		config:     config,
+		last:       map[string]float64{},
+		jumps:      map[string]int{},
+		tripped:    map[string]string{},
+		started:    time.Now().UnixMilli(),
+		time_scale: time_scale,
+	}
+}
+
+// sampleChannels returns the readings of a sample by channel; "bt" is the primary reading.
+func sampleChannels(temp TempType) map[string]float64 {
+	channels := map[string]float64{"bt": temp.Temp}
+	for name, value := range temp.Channels {
+		channels[name] = value
+	}
+	return channels
+}
+
+// OnSample is a pipeline subscriber checking every reading.
+func (w *Watchdog) OnSample(temp TempType) {
+	w.mu.Lock()
+	prev_ts := w.last_ts
+	w.last_ts = temp.TimeStamp
+	w.mu.Unlock()
+	scale := w.time_scale()
+
+	w.clear("stale", "")
+
+	for channel, value := range sampleChannels(temp) {
+		if w.isOpenCircuit(value) {
+			w.trip("open_circuit", IncidentCritical, channel, value, fmt.Sprintf("sonda %s desconectada (lectura %v)", channel, value))
+			continue
+		}
+		w.clear("open_circuit", channel)
+
+		if limit, ok := w.config.OverTemp[channel]; ok && value >= limit {
+			w.trip("over_temp", IncidentCritical, channel, value, fmt.Sprintf("%s %.1f sobre el limite de %.1f", channel, value, limit))
+		} else if ok && value < limit-5 {
+			w.clear("over_temp", channel)
+		}
+
+		w.mu.Lock()
+		prev, has_prev := w.last[channel]
+		w.last[channel] = value
+		jumps := 0
+		if has_prev && prev_ts != 0 && temp.TimeStamp > prev_ts {
+			// Degrees per second of roast: a simulator at 20x moves 20 times faster per wall second.
+			rate := math.Abs(value-prev) / (float64(temp.TimeStamp-prev_ts) / 1000 * scale)
+			if rate > w.config.MaxJump {
+				w.jumps[channel]++
+			} else {
+				w.jumps[channel] = 0
+			}
+			jumps = w.jumps[channel]
+		}
+		w.mu.Unlock()
+
+		switch {
+		case jumps >= w.config.JumpsToTrip:
+			w.trip("jump", IncidentCritical, channel, value, fmt.Sprintf("%s salta de forma implausible (%d lecturas seguidas)", channel, jumps))
+		case jumps > 0:
+			w.trip("jump", IncidentWarning, channel, value, fmt.Sprintf("%s salto implausible de %.1f a %.1f", channel, prev, value))
+		default:
+			w.clear("jump", channel)
+		}
+	}
+}
+
+// isOpenCircuit returns true for the readings of a disconnected probe.
+func (w *Watchdog) isOpenCircuit(value float64) bool {
+	if math.IsNaN(value) || math.IsInf(value, 0) || value >= w.config.OpenCircuitAbove {
+		return true
+	}
+	for _, v := range w.config.OpenCircuit {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Run checks for stale data until stop is closed.
+func (w *Watchdog) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Duration(w.config.CheckMs) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			w.checkStale()
+		}
+	}
+}
+
+// checkStale trips when no sample arrived for too long.
+func (w *Watchdog) checkStale() {
+	w.mu.Lock()
+	last := w.last_ts
+	if last == 0 {
+		last = w.started
+	}
+	w.mu.Unlock()
+
+	stale := float64(time.Now().UnixMilli()-last) / 1000
+
+	switch {
+	case stale >= w.config.StaleCriticalS:
+		w.trip("stale", IncidentCritical, "", stale, fmt.Sprintf("sin datos del sensor hace %.0f s", stale))
+	case stale >= w.config.StaleWarnS:
+		w.trip("stale", IncidentWarning, "", stale, fmt.Sprintf("sin datos del sensor hace %.0f s", stale))
+	}
+}
+
+// trip records and escalates a condition. A condition is only reported again when
+// its level rises.
+func (w *Watchdog) trip(kind string, level string, channel string, value float64, msg string) {
+	key := kind + ":" + channel
+
+	w.mu.Lock()
+	current := w.tripped[key]
+	if current == level || current == IncidentCritical {
+		w.mu.Unlock()
+		return
+	}
+	w.tripped[key] = level
+	w.mu.Unlock()
+
+	// NaN and Inf cannot be stored nor sent as JSON.
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		value = 0
+	}
+
+	incident := Incident{
+		TimeStamp: time.Now().UnixMilli(),
+		Kind:      kind,
+		Level:     level,
+		Channel:   channel,
+		Value:     value,
+		Msg:       msg,
+		Actions:   "alert",
+	}
+	active, has_session := session.Active()
+	if has_session {
+		incident.SessionId = active.Id
+	}
+
+	if level == IncidentCritical {
+		if has_session {
+			session_data_provider.SetMark(Mark{SessionId: active.Id, MarkName: "ALARMA: " + msg, CreatedAt: incident.TimeStamp, OnTemp: currentData().Temp, CreatedBy: "watchdog"})
+			incident.Actions += ",mark"
+			AuditAs("watchdog", "", "mark.create", active.Id, map[string]any{"mark_name": "ALARMA: " + msg})
+		}
+		if controller.HasDriver() {
+			follower.Stop()
+			controller.SetInterlock(msg)
+			incident.Actions += ",heat_off"
+			AuditAs("watchdog", "", "control.interlock", kind, map[string]any{"msg": msg})
+		}
+	}
+
+	log.Printf("watchdog %s: %s", level, msg)
+	incident.Id = session_data_provider.InsertIncident(incident)
+	send_data_to_clients(map[string]any{"type": "alarm", "incident": incident})
+}
+
+// clear forgets a resolved condition and, when it had tripped, tells the clients.
+func (w *Watchdog) clear(kind string, channel string) {
+	key := kind + ":" + channel
+
+	w.mu.Lock()
+	level, tripped := w.tripped[key]
+	delete(w.tripped, key)
+	critical := false
+	for _, l := range w.tripped {
+		critical = critical || l == IncidentCritical
+	}
+	w.mu.Unlock()
+
+	if !tripped {
+		return
+	}
+
+	log.Printf("watchdog: %s resuelto", key)
+	if level == IncidentCritical && !critical {
+		controller.SetInterlock("")
+	}
+	send_data_to_clients(map[string]any{"type": "alarm_cleared", "kind": kind, "channel": channel})
+}
+
+// incidentsHandler returns the incident log, optionally filtered by session_id.
+func incidentsHandler(w http.ResponseWriter, r *http.Request) {
+	enabeCORS(w)
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+
+	data := map[string]any{"incidents": session_data_provider.GetIncidents(r.URL.Query().Get("session_id"), limit)}
+	json.NewEncoder(w).Encode(data)
+}
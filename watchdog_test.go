@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestWatchdogJumpTimeScale(t *testing.T) {
+	tests := []struct {
+		name       string
+		time_scale func() float64
+		want       string
+	}{
+		// 30 degrees per wall second is 1.5 per second of a roast simulated at 20x.
+		{"simulated at 20x", func() float64 { return 20 }, ""},
+		{"real time", nil, IncidentCritical},
+		{"replayed at 1x", func() float64 { return 1 }, IncidentCritical},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTestDatabase(t)
+			w := NewWatchdog(DefaultWatchdogConfig(), test.time_scale)
+			for i := int64(0); i < 4; i++ {
+				w.OnSample(TempType{TimeStamp: 1000 + i*1000, Temp: 100 + float64(i)*30})
+			}
+			if got := w.tripped["jump:bt"]; got != test.want {
+				t.Errorf("jump level = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
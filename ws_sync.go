@@ -0,0 +1,314 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	broadcast_history_size = 4096 // Broadcast frames kept to resume clients.
+	sync_chunk_default     = 500  // Samples per sync_chunk frame.
+	sync_chunk_max         = 5000
+	ws_queue_size          = 1024             // Frames waiting for a WebSocket client before it is dropped as too slow.
+	ws_write_timeout       = 10 * time.Second // A client not taking a frame in this time is disconnected.
+)
+
+var errClientClosed = errors.New("cliente desconectado")
+
+// WSClient is a connected WebSocket client. Its frames are written in order by its own
+// goroutine, so a slow client never holds up the broadcasts.
+type WSClient struct {
+	conn   *websocket.Conn
+	frames chan []byte
+	quit   chan struct{} // Closed to stop the writer.
+	done   chan struct{} // Closed when the writer stopped.
+	once   sync.Once
+}
+
+// NewWSClient creates a client and starts its writer.
+func NewWSClient(conn *websocket.Conn) *WSClient {
+	c := &WSClient{conn: conn, frames: make(chan []byte, ws_queue_size), quit: make(chan struct{}), done: make(chan struct{})}
+	go c.writeLoop()
+	return c
+}
+
+// writeLoop writes the queued frames until the client is closed or a write fails.
+func (c *WSClient) writeLoop() {
+	defer close(c.done)
+	for {
+		select {
+		case <-c.quit:
+			return
+		case data := <-c.frames:
+			c.conn.SetWriteDeadline(time.Now().Add(ws_write_timeout))
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				log.Printf("Error al enviar a %s: %v", c.conn.RemoteAddr(), err)
+				c.Close()
+				return
+			}
+		}
+	}
+}
+
+// Send queues a frame, waiting for room in the queue.
+func (c *WSClient) Send(data []byte) error {
+	select {
+	case c.frames <- data:
+		return nil
+	case <-c.done:
+		return errClientClosed
+	}
+}
+
+// TrySend queues a frame, and reports false when the queue is full.
+func (c *WSClient) TrySend(data []byte) bool {
+	select {
+	case c.frames <- data:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops the writer and closes the connection, which ends the read loop.
+func (c *WSClient) Close() {
+	c.once.Do(func() {
+		close(c.quit)
+		c.conn.Close()
+	})
+}
+
+// BroadcastHistory numbers the broadcast frames and keeps the last ones.
+type BroadcastHistory struct {
+	seq    uint64
+	frames [][]byte // Ring of the last frames; frames[seq % size] holds frame seq.
+}
+
+// NewBroadcastHistory creates a history of the given size.
+func NewBroadcastHistory(size int) *BroadcastHistory {
+	return &BroadcastHistory{frames: make([][]byte, size)}
+}
+
+var broadcast_mu sync.Mutex // Held while a frame is numbered and queued, so frames reach every client in order.
+var broadcast_history = NewBroadcastHistory(broadcast_history_size)
+
+// Add numbers a JSON object frame, keeps it and returns it with its "seq".
+func (h *BroadcastHistory) Add(data []byte) []byte {
+	h.seq++
+	frame := withSeq(data, h.seq)
+	h.frames[h.seq%uint64(len(h.frames))] = frame
+	return frame
+}
+
+// Seq returns the number of the last frame.
+func (h *BroadcastHistory) Seq() uint64 {
+	return h.seq
+}
+
+// Since returns the frames after seq, and false when some of them are no longer kept.
+func (h *BroadcastHistory) Since(seq uint64) ([][]byte, bool) {
+	if seq >= h.seq {
+		return nil, true
+	}
+	if h.seq-seq > uint64(len(h.frames)) {
+		return nil, false
+	}
+	frames := make([][]byte, 0, h.seq-seq)
+	for s := seq + 1; s <= h.seq; s++ {
+		frames = append(frames, h.frames[s%uint64(len(h.frames))])
+	}
+	return frames, true
+}
+
+// withSeq adds the "seq" field to a JSON object.
+func withSeq(data []byte, seq uint64) []byte {
+	if len(data) < 2 || data[0] != '{' {
+		return data
+	}
+	frame := make([]byte, 0, len(data)+24)
+	frame = append(frame, `{"seq":`...)
+	frame = strconv.AppendUint(frame, seq, 10)
+	if len(data) > 2 {
+		frame = append(frame, ',')
+	}
+	return append(frame, data[1:]...)
+}
+
+// currentSeq returns the number of the last broadcast.
+func currentSeq() uint64 {
+	broadcast_mu.Lock()
+	defer broadcast_mu.Unlock()
+	return broadcast_history.Seq()
+}
+
+// writeMessage queues a text frame for a client, in order with the broadcasts.
+func writeMessage(conn *websocket.Conn, data []byte) error {
+	mu.RLock()
+	client := clients[conn]
+	mu.RUnlock()
+	if client == nil {
+		return errClientClosed
+	}
+	return client.Send(data)
+}
+
+// writeWS writes a frame to a client as JSON.
+func writeWS(conn *websocket.Conn, data any) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Error json a %s\n", err)
+		return err
+	}
+	err = writeMessage(conn, jsonData)
+	if err != nil {
+		log.Printf("Error al enviar a %s: %v", conn.RemoteAddr(), err)
+	}
+	return err
+}
+
+// After returns the buffered samples taken after ts.
+func (l *LiveSamples) After(ts int64) []TempType {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var samples []TempType
+	for _, sample := range l.samples {
+		if sample.TimeStamp > ts {
+			samples = append(samples, sample)
+		}
+	}
+	return samples
+}
+
+// resumeClient queues for a client the broadcast frames after seq, as they were sent,
+// after a resume_response. Frames are queued without waiting, in order with the live
+// broadcasts; frames no longer kept, or more than fit in the queue, need a sync. A
+// client that cannot even take the response is closed.
+func resumeClient(client *WSClient, seq uint64) {
+	broadcast_mu.Lock()
+	defer broadcast_mu.Unlock()
+
+	frames, ok := broadcast_history.Since(seq)
+	response := map[string]any{"type": "resume_response", "error": false, "seq": broadcast_history.Seq(), "replayed": len(frames)}
+	switch {
+	case !ok:
+		response["msg"] = "faltan frames que ya no se guardan, use sync"
+	case len(frames) >= cap(client.frames)-len(client.frames):
+		ok = false
+		response["msg"] = "demasiados frames para reanudar, use sync"
+	}
+	if !ok {
+		response["error"] = true
+		response["resync"] = true
+		response["replayed"] = 0
+	}
+
+	data, _ := json.Marshal(response)
+	if !client.TrySend(data) {
+		client.Close()
+		return
+	}
+	if !ok {
+		return
+	}
+	for _, frame := range frames {
+		if !client.TrySend(frame) {
+			client.Close()
+			return
+		}
+	}
+}
+
+// syncClient sends a client the samples of the active session taken after since (a
+// timestamp in milliseconds, 0 for all) in sync_chunk frames of chunk samples, between
+// a sync_begin and a sync_end with the marks after mark_id and the controls and PID
+// log after since. Both carry the broadcast seq read before the samples: live frames
+// after it may repeat samples of the chunks, which clients drop by timestamp.
+func syncClient(conn *websocket.Conn, since int64, mark_id int64, chunk int) {
+	active, ok := session.Active()
+	if !ok {
+		writeWS(conn, map[string]any{"type": "sync_begin", "error": true, "has_session": false, "msg": "no hay session de tostado iniciada"})
+		return
+	}
+	if chunk <= 0 {
+		chunk = sync_chunk_default
+	}
+	chunk = min(chunk, sync_chunk_max)
+
+	session_id := active.Id
+	seq := currentSeq()
+
+	temps := session_data_provider.GetMeasurements(session_id, MeasurementQuery{From: since + 1})
+	// Samples are stored after they are broadcast; the newest may not be stored yet.
+	last := since
+	if len(temps) > 0 {
+		last = temps[len(temps)-1].TimeStamp
+	}
+	for _, sample := range live_samples.After(max(last, active.CreateAt-1)) {
+		temps = append(temps, &sample)
+	}
+
+	chunks := (len(temps) + chunk - 1) / chunk
+	err := writeWS(conn, map[string]any{
+		"type":               "sync_begin",
+		"error":              false,
+		"has_session":        true,
+		"session_id":         session_id,
+		"session_name":       active.Name,
+		"session_created_at": active.CreateAt,
+		"since":              since,
+		"seq":                seq,
+		"total":              len(temps),
+		"chunks":             chunks,
+	})
+	if err != nil {
+		return
+	}
+
+	for i := 0; i < chunks; i++ {
+		end := min((i+1)*chunk, len(temps))
+		if writeWS(conn, map[string]any{"type": "sync_chunk", "session_id": session_id, "index": i, "temps": temps[i*chunk : end]}) != nil {
+			return
+		}
+	}
+
+	marks := []Mark{}
+	for _, mark := range session_data_provider.GetMarksOfSessions(session_id) {
+		if mark.Id > mark_id {
+			marks = append(marks, mark)
+		}
+	}
+	controls := []ControlState{}
+	for _, state := range session_data_provider.GetControlsOfSession(session_id) {
+		if state.TimeStamp > since {
+			controls = append(controls, state)
+		}
+	}
+	pid_log := []PIDLog{}
+	for _, entry := range session_data_provider.GetPIDLogOfSession(session_id) {
+		if entry.TimeStamp > since {
+			pid_log = append(pid_log, entry)
+		}
+	}
+
+	last_ts := since
+	if len(temps) > 0 {
+		last_ts = temps[len(temps)-1].TimeStamp
+	}
+	writeWS(conn, map[string]any{
+		"type":           "sync_end",
+		"session_id":     session_id,
+		"seq":            seq,
+		"last_timestamp": last_ts,
+		"marks":          marks,
+		"controls":       controls,
+		"control":        controller.State(),
+		"pid":            pid_log,
+	})
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// historyWith returns a history of the given size after adding n frames.
+func historyWith(size, n int) *BroadcastHistory {
+	h := NewBroadcastHistory(size)
+	for i := 1; i <= n; i++ {
+		h.Add([]byte(fmt.Sprintf(`{"n":%d}`, i)))
+	}
+	return h
+}
+
+func TestBroadcastHistorySince(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int
+		added  int
+		since  uint64
+		want   []string
+		wantOk bool
+	}{
+		{"empty", 4, 0, 0, nil, true},
+		{"up to date", 4, 3, 3, nil, true},
+		{"ahead", 4, 3, 9, nil, true},
+		{"from the start", 4, 3, 0, []string{`{"seq":1,"n":1}`, `{"seq":2,"n":2}`, `{"seq":3,"n":3}`}, true},
+		{"last one", 4, 3, 2, []string{`{"seq":3,"n":3}`}, true},
+		// The ring wrapped around: frames 7 to 10 are kept in slots 3, 0, 1 and 2.
+		{"wrapped, whole ring", 4, 10, 6, []string{`{"seq":7,"n":7}`, `{"seq":8,"n":8}`, `{"seq":9,"n":9}`, `{"seq":10,"n":10}`}, true},
+		{"wrapped, across the end", 4, 10, 8, []string{`{"seq":9,"n":9}`, `{"seq":10,"n":10}`}, true},
+		{"wrapped, overwritten", 4, 10, 5, nil, false},
+		{"wrapped, from the start", 4, 10, 0, nil, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := historyWith(test.size, test.added)
+			frames, ok := h.Since(test.since)
+			if ok != test.wantOk {
+				t.Fatalf("ok = %v, want %v", ok, test.wantOk)
+			}
+			var got []string
+			for _, frame := range frames {
+				got = append(got, string(frame))
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("frames = %q, want %q", got, test.want)
+			}
+			if h.Seq() != uint64(test.added) {
+				t.Errorf("seq = %d, want %d", h.Seq(), test.added)
+			}
+		})
+	}
+}
+
+func TestWithSeq(t *testing.T) {
+	tests := []struct{ data, want string }{
+		{`{"type":"temp"}`, `{"seq":7,"type":"temp"}`},
+		{`{}`, `{"seq":7}`},
+		{`[1,2]`, `[1,2]`},
+		{`"x"`, `"x"`},
+	}
+	for _, test := range tests {
+		if got := string(withSeq([]byte(test.data), 7)); got != test.want {
+			t.Errorf("withSeq(%s) = %s, want %s", test.data, got, test.want)
+		}
+	}
+}
+
+// stalledClient returns a client whose queue holds size frames, queued frames already
+// in it, and that never drains it: its writer is not started.
+func stalledClient(t *testing.T, size int, queued int) *WSClient {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conn, err := upgrader.Upgrade(w, r, nil); err == nil {
+			t.Cleanup(func() { conn.Close() })
+		}
+	}))
+	t.Cleanup(server.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	client := &WSClient{conn: conn, frames: make(chan []byte, size), quit: make(chan struct{}), done: make(chan struct{})}
+	for i := 0; i < queued; i++ {
+		client.frames <- []byte(`{}`)
+	}
+	return client
+}
+
+func TestResumeClientNeverBlocks(t *testing.T) {
+	tests := []struct {
+		name       string
+		queued     int
+		since      uint64
+		wantResync bool
+		wantFrames []string
+		wantClosed bool
+	}{
+		{"replayed", 0, 8, false, []string{`{"seq":9,"n":9}`, `{"seq":10,"n":10}`}, false},
+		{"up to date", 0, 10, false, nil, false},
+		{"more than fit in the queue", 4, 6, true, nil, false},
+		{"no longer kept", 0, 1, true, nil, false},
+		{"queue full", 8, 8, false, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			history := broadcast_history
+			broadcast_history = historyWith(8, 10)
+			t.Cleanup(func() { broadcast_history = history })
+			client := stalledClient(t, 8, test.queued)
+
+			done := make(chan struct{})
+			go func() {
+				resumeClient(client, test.since)
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("resumeClient blocked on a client that does not drain")
+			}
+
+			select {
+			case <-client.quit:
+				if !test.wantClosed {
+					t.Fatal("client closed")
+				}
+				return
+			default:
+				if test.wantClosed {
+					t.Fatal("client not closed")
+				}
+			}
+
+			queued := make([][]byte, 0, len(client.frames))
+			for len(client.frames) > 0 {
+				queued = append(queued, <-client.frames)
+			}
+			queued = queued[test.queued:]
+			var response struct {
+				Type   string
+				Seq    uint64
+				Resync bool
+			}
+			if err := json.Unmarshal(queued[0], &response); err != nil || response.Type != "resume_response" {
+				t.Fatalf("first frame = %s, want a resume_response", queued[0])
+			}
+			if response.Seq != 10 || response.Resync != test.wantResync {
+				t.Errorf("response = %s, want seq 10 and resync %v", queued[0], test.wantResync)
+			}
+			var got []string
+			for _, frame := range queued[1:] {
+				got = append(got, string(frame))
+			}
+			if !slices.Equal(got, test.wantFrames) {
+				t.Errorf("frames = %q, want %q", got, test.wantFrames)
+			}
+		})
+	}
+}